@@ -1,65 +1,145 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 
-	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"nenvoy.com/cmd/vngen/app/pkg/api"
+	"nenvoy.com/pkg/auth"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/events"
+	"nenvoy.com/pkg/job"
+	"nenvoy.com/pkg/pki"
 	"nenvoy.com/pkg/utils/handle"
 	"nenvoy.com/pkg/utils/printing"
 )
 
 func init() {
 	// Api port flag
-	apiCmd.PersistentFlags().IntVarP(&port, "port", "p", 8000, "Specify the port number to be used for the rest api")
+	apiCmd.PersistentFlags().IntVarP(&port, "port", "p", 8000, "Specify the port number to be used for the rest api, api_port of the config by default")
+	apiCmd.PersistentFlags().StringVarP(&apiAddress, "address", "a", "", "Address to listen on, every interface by default")
+	apiCmd.PersistentFlags().BoolVar(&apiNoAuth, "no-auth", false, "Serve every request as an admin without an api token, only safe on a trusted address")
+
+	// Api tls flags
+	apiCmd.PersistentFlags().BoolVar(&apiTLS, "tls", false, "Serve the rest api over https")
+	apiCmd.PersistentFlags().BoolVar(&apiClientAuth, "client-auth", false, "Require client certificates issued by the vngen CA, implies --tls")
+	apiCmd.PersistentFlags().StringVar(&apiTLSCert, "tls-cert", "", "Server certificate to serve instead of one issued by the vngen CA")
+	apiCmd.PersistentFlags().StringVar(&apiTLSKey, "tls-key", "", "Key of the server certificate given with --tls-cert")
+	apiCmd.PersistentFlags().StringSliceVar(&apiTLSHosts, "tls-host", []string{}, "Names and addresses to issue the server certificate for, as well as localhost")
 
 	baseCmd.AddCommand(apiCmd)
 }
 
 var (
-	port int
+	port          int
+	apiAddress    string
+	apiNoAuth     bool
+	apiTLS        bool
+	apiClientAuth bool
+	apiTLSCert    string
+	apiTLSKey     string
+	apiTLSHosts   []string
 
 	apiCmd = &cobra.Command{
-		Use:   "api",
-		Short: "Run the rest api",
-		Long:  `Run the rest api`,
+		Use:         "api",
+		Annotations: map[string]string{localOnly: "true"},
+		Short:       "Run the rest api",
+		Long: `Run the rest api
+
+With --tls the api is served over https. The server certificate is issued
+by a CA kept in the pki directory of the app directory, which is created on
+first use, unless a certificate is given with --tls-cert and --tls-key. With --client-auth
+clients must present a certificate issued by the CA, see vngen pki.
+
+Requests are authenticated with api tokens, see vngen token, unless the api
+is run with --no-auth.`,
 		Run: func(cmd *cobra.Command, args []string) {
 
-			printing.PrintInfo(fmt.Sprintf("Running rest api on http://localhost:%d", port))
-			// Distribute binaries and handle the setup
-
-			r := mux.NewRouter()
-
-			// Handle the building of the deployment
-			r.HandleFunc("/build", api.Build).Methods("PUT")
-
-			// Handle the starting of the deployment or host
-			r.HandleFunc("/start/{resource}/{name}", api.Start).Methods("POST")
-
-			// Handle the stopping of the deployment or host
-			r.HandleFunc("/stop/{resource}/{name}", api.Stop).Methods("POST")
-
-			// Handle the restarting of the deployment or host
-			r.HandleFunc("/restart/{resource}/{name}", api.Restart).Methods("POST")
-
-			// Handle the destroying of the deployment or host
-			r.HandleFunc("/destroy/{resource}/{name}", api.Destroy).Methods("POST")
-
-			// Handle the getting of the host details
-			r.HandleFunc("/hosts", api.GetHosts)
-
-			// Handle the getting of the network details
-			r.HandleFunc("/networks", api.GetNetworks)
+			// The config picks the port unless it is given
+			if !cmd.Flags().Changed("port") {
+				port = config.Get().APIPort
+			}
+
+			addr := fmt.Sprintf("%s:%d", apiAddress, port)
+			host := apiAddress
+			if host == "" {
+				host = "localhost"
+			}
+
+			// Requests need a token unless authentication is turned off
+			if apiNoAuth {
+				printing.PrintWarning("Authentication is turned off, anyone who can reach the api can manage every deployment")
+			} else if toks, err := auth.GetTokens(); err == nil && len(toks) == 0 {
+				printing.PrintWarning("No api tokens exist yet, create one with vngen token create")
+			}
+
+			// Jobs left running by a previous server will never finish
+			handle.Error(job.Recover())
+
+			// Publish libvirt's domain and network events on /api/v1/events
+			go events.WatchLibvirt(context.Background())
+
+			// Serve every route of the api under /api/v1
+			server := &http.Server{Addr: addr, Handler: api.NewRouter(!apiNoAuth)}
+
+			if !apiTLS && !apiClientAuth {
+				printing.PrintInfo(fmt.Sprintf("Running rest api on http://%s", net.JoinHostPort(host, fmt.Sprint(port))))
+				handle.Error(server.ListenAndServe())
+				return
+			}
+
+			tlsConfig, err := apiTLSConfig()
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+			server.TLSConfig = tlsConfig
+
+			printing.PrintInfo(fmt.Sprintf("Running rest api on https://%s", net.JoinHostPort(host, fmt.Sprint(port))))
+			if apiClientAuth {
+				printing.PrintInfo("Requiring client certificates issued by " + pki.Default().CACert())
+			}
+			handle.Error(server.ListenAndServeTLS("", ""))
+		},
+	}
+)
 
-			// Get the IP of a particular host
-			r.HandleFunc("/details/{host}", api.GetHost)
+// apiTLSConfig - loads the server certificate given, or issues one from the vngen CA
+func apiTLSConfig() (tlsConfig *tls.Config, err error) {
+	p := pki.Default()
 
-			// Get the IP of a particular host
-			r.HandleFunc("/details/{host}/ipv4", api.GetHostIP)
+	if (apiTLSCert == "") != (apiTLSKey == "") {
+		return nil, errors.New("--tls-cert and --tls-key must be given together")
+	}
 
-			handle.Error(http.ListenAndServe(fmt.Sprintf(":%d", port), r))
-		},
+	certPath, keyPath := apiTLSCert, apiTLSKey
+	if certPath == "" {
+		dnsNames, ips := []string{}, []net.IP{}
+		for _, name := range apiTLSHosts {
+			if ip := net.ParseIP(name); ip != nil {
+				ips = append(ips, ip)
+			} else {
+				dnsNames = append(dnsNames, name)
+			}
+		}
+
+		err = p.EnsureServer(dnsNames, ips)
+		if err != nil {
+			return nil, err
+		}
+		certPath, keyPath = p.ServerCert()
+	} else if apiClientAuth {
+		// Client certificates are still checked against the vngen CA
+		err = p.EnsureCA()
+		if err != nil {
+			return nil, err
+		}
 	}
-)
+
+	return p.ServerTLSConfig(certPath, keyPath, apiClientAuth)
+}
@@ -2,8 +2,10 @@ package cmd
 
 import (
 	"errors"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/config"
 	"nenvoy.com/pkg/topology"
 	"nenvoy.com/pkg/utils/handle"
 	"nenvoy.com/pkg/utils/printing"
@@ -12,13 +14,20 @@ import (
 )
 
 func init() {
+	// Build flags
+	buildCmd.Flags().BoolVar(&buildSkipChecks, "skip-checks", false, "Build without first running the checks of vngen doctor")
+
 	baseCmd.AddCommand(buildCmd)
 }
 
+var buildSkipChecks bool
+
 var buildCmd = &cobra.Command{
 	Use:   "build <path/to/template>",
 	Short: "Build a network from a YAML template file",
-	Long:  `Build a network from a YAML template file`,
+	Long: `Build a network from a YAML template file
+
+The checks of vngen doctor run first, and the build stops if any fail.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		//Sepcify the username for connecting
@@ -28,6 +37,21 @@ var buildCmd = &cobra.Command{
 		}
 
 		printing.PrintInfo("Building network from template " + args[0])
+		// Upload the template when running remotely
+		if remote != nil {
+			handle.Error(remoteBuild(args[0]))
+			return
+		}
+
+		// Stop before a missing binary or libvirt fails the build halfway
+		if !buildSkipChecks {
+			err := preflight()
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+		}
+
 		// Distribute binaries and handle the setup
 		handle.Error(buildNetwork(args))
 	},
@@ -36,8 +60,8 @@ var buildCmd = &cobra.Command{
 func buildNetwork(args []string) (err error) {
 
 	// Create relevent directories as needed
-	appDir := "/var/lib/nenvn"
-	dirs := []string{appDir, appDir + "/machines", appDir + "/images"}
+	appDir := config.Get().AppDir
+	dirs := []string{appDir, filepath.Join(appDir, "machines"), filepath.Join(appDir, "images")}
 	err = files.CreateDirectories(dirs)
 	if err != nil {
 		return err
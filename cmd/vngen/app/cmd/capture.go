@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/capture"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/pcap"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+func init() {
+	// Capture flags
+	captureCmd.Flags().StringVarP(&captureFile, "write", "w", "", "File to write packets to, - for stdout")
+	captureCmd.Flags().StringVarP(&captureOpts.Filter, "filter", "f", "", "Filter expression, e.g. \"tcp port 22 and host 20.0.0.2\"")
+	captureCmd.Flags().StringVar(&captureOpts.Format, "format", pcap.FormatPcap, "Capture file format, pcap or pcapng")
+	captureCmd.Flags().IntVarP(&captureOpts.Count, "count", "c", 0, "Stop after this many packets")
+	captureCmd.Flags().IntVarP(&captureOpts.SnapLen, "snaplen", "s", pcap.DefaultSnapLen, "Maximum bytes captured per packet")
+
+	baseCmd.AddCommand(captureCmd)
+}
+
+var (
+	captureFile string
+	captureOpts capture.Options
+
+	captureCmd = &cobra.Command{
+		Use:   "capture <network|host:iface> -w <file>",
+		Short: "Capture packets on a network bridge or host interface",
+		Long: `Capture packets on a network bridge or host interface
+
+The target is either a network name or host:iface, where iface is the tap
+device, the attached network or the interface index. Packets are written in
+pcap or pcapng format until interrupted or --count packets are captured.`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify network or host:iface, see help for more details"))
+				return
+			}
+
+			if captureFile == "" {
+				handle.Error(errors.New("Need to specify an output file with -w, see help for more details"))
+				return
+			}
+
+			// Infer the format from the file extension unless given
+			if !cmd.Flags().Changed("format") && strings.HasSuffix(captureFile, ".pcapng") {
+				captureOpts.Format = pcap.FormatPcapNG
+			}
+
+			handle.Error(capturePackets(args[0]))
+		},
+	}
+)
+
+// capturePackets - captures on the target until interrupted
+func capturePackets(target string) (err error) {
+	// Messages would corrupt the capture when writing to stdout
+	quiet := captureFile == "-"
+
+	var out io.Writer = os.Stdout
+	if !quiet {
+		f, err := os.Create(captureFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	// Stop capturing on interrupt
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if !quiet {
+		printing.PrintInfo(fmt.Sprintf("Capturing on %s, press Ctrl+C to stop", target))
+	}
+
+	// Stream the capture from the server when running remotely
+	if remote != nil {
+		err = remoteCapture(ctx, target, out)
+		if err == nil && !quiet {
+			printing.PrintSuccess(fmt.Sprintf("Captured %s to %s", target, captureFile))
+		}
+		return err
+	}
+
+	count, err := capture.Run(ctx, target, captureOpts, out)
+	if err != nil {
+		return err
+	}
+
+	if !quiet {
+		printing.PrintSuccess(fmt.Sprintf("Captured %d packets to %s", count, captureFile))
+	}
+
+	return nil
+}
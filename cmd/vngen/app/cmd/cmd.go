@@ -1,12 +1,11 @@
 package cmd
 
 import (
-	"errors"
 	"os"
 
 	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/config"
 	"nenvoy.com/pkg/utils/handle"
-	"nenvoy.com/pkg/utils/root"
 )
 
 var (
@@ -22,30 +21,32 @@ var (
 )
 
 // Execute executes the nenadm command.
+//
+// Root is checked before each command runs, see connect, as commands run
+// on an api server with --server need none.
 func Execute() error {
-	// Check running as root
-	root, err := root.AsRoot()
-
-	if err != nil {
-		handle.Error(err)
-	}
-
-	if !root {
-		handle.Error(errors.New("permission error: root required"))
-		os.Exit(1)
-	}
 	return baseCmd.Execute()
 }
 
 func init() {
-	// cobra.OnInitialize(readConfig)
-	// baseCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "cluster config file (default is config.yaml)")
+	cobra.OnInitialize(readConfig)
+	baseCmd.PersistentFlags().StringVar(&cfgFile, "config", configPath(), "Config file, settings can also be given as VNGEN_<SETTING> (env VNGEN_CONFIG)")
 }
 
-// Reads the config file
-// func readConfig() {
-// 	// err := config.ReadConfig(&cfgFile)
-// 	// if err != nil {
-// 	// 	printing.PrintWarning(err.Error())
-// 	// }
-// }
+// configPath - returns the config file given by the environment, or the default
+func configPath() string {
+	if path := os.Getenv("VNGEN_CONFIG"); path != "" {
+		return path
+	}
+	return config.DefaultPath
+}
+
+// readConfig - Reads the config file and the environment before any command runs
+func readConfig() {
+	c, err := config.Load(cfgFile)
+	if err != nil {
+		handle.Error(err)
+		os.Exit(1)
+	}
+	config.Set(c)
+}
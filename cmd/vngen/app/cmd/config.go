@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/utils/handle"
+)
+
+func init() {
+	configCmd.AddCommand(configViewCmd)
+	baseCmd.AddCommand(configCmd)
+}
+
+var (
+	configCmd = &cobra.Command{
+		Use:   "config <view>",
+		Short: "Show the settings vngen runs with",
+		Long: `Show the settings vngen runs with
+
+Settings are read from /etc/vngen/config.yaml, or the file given with
+--config or VNGEN_CONFIG, and each can be overridden with an environment
+variable of its name, e.g. VNGEN_APP_DIR or VNGEN_LIBVIRT_URI.`,
+		// Viewing the settings changes nothing, so root is not needed
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	configViewCmd = &cobra.Command{
+		Use:   "view",
+		Short: "Print the effective settings",
+		Long:  `Print the effective settings, after the config file and environment are applied, as YAML`,
+		Run: func(cmd *cobra.Command, args []string) {
+			handle.Error(viewConfig())
+		},
+	}
+)
+
+// viewConfig - prints the settings of the running process and where they were read from
+func viewConfig() (err error) {
+	buf, err := yaml.Marshal(config.Get())
+	if err != nil {
+		return err
+	}
+
+	source := cfgFile
+	if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
+		source = fmt.Sprintf("%s does not exist, using defaults", cfgFile)
+	}
+
+	fmt.Printf("# %s\n%s", source, buf)
+	return nil
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/client"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+func init() {
+	contextCmd.AddCommand(contextSetCmd)
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextRmCmd)
+	contextCmd.AddCommand(contextLsCmd)
+	baseCmd.AddCommand(contextCmd)
+}
+
+var (
+	contextCmd = &cobra.Command{
+		Use:   "context <set|use|rm|ls>",
+		Short: "Manage the api servers commands run on",
+		Long: `Manage the api servers commands run on
+
+Contexts name an api server with the token and certificates it is called
+with, and are kept in ~/.config/vngen/contexts.yaml. While a context is in
+use build, get, describe, start, stop, restart, destroy, resolve and capture run on
+its server rather than against libvirt on this machine, and need no root.
+Use the local context to run them here again. --server and VNGEN_SERVER
+override the context, and --context or VNGEN_CONTEXT pick another one for
+a single command.`,
+		// Contexts are the user's own, so root is not needed
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	}
+
+	contextSetCmd = &cobra.Command{
+		Use:   "set <name> --server <address>",
+		Short: "Add or replace a context",
+		Long:  `Add or replace a context from --server, --token, --ca, --cert and --key, e.g. vngen context set lab --server https://vngen.example.com:8000 --token vngen_... --ca ca.crt`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify the name of the context, see help for more details"))
+				return
+			}
+			if args[0] == localContext {
+				handle.Error(fmt.Errorf("%s is the name of this machine, see help for more details", localContext))
+				return
+			}
+			if remoteServer == "" {
+				handle.Error(errors.New("Need to specify the server with --server, see help for more details"))
+				return
+			}
+
+			handle.Error(updateContexts(func(contexts *client.Contexts) error {
+				contexts.Set(client.Context{Name: args[0], Server: remoteServer, Token: remoteToken, CA: remoteCA, Cert: remoteCert, Key: remoteKey})
+				if contexts.Current == "" {
+					contexts.Current = args[0]
+				}
+				printing.PrintSuccess(fmt.Sprintf("Set context %s", args[0]))
+				return nil
+			}))
+		},
+	}
+
+	contextUseCmd = &cobra.Command{
+		Use:   "use <name|local>",
+		Short: "Run commands on the context's server from now on",
+		Long:  `Run commands on the context's server from now on, or on this machine with local`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify the name of the context, see help for more details"))
+				return
+			}
+
+			handle.Error(updateContexts(func(contexts *client.Contexts) error {
+				if _, ok := contexts.Get(args[0]); !ok && args[0] != localContext {
+					return fmt.Errorf("context %s not found", args[0])
+				}
+				contexts.Current = args[0]
+				printing.PrintSuccess(fmt.Sprintf("Using context %s", args[0]))
+				return nil
+			}))
+		},
+	}
+
+	contextRmCmd = &cobra.Command{
+		Use:   "rm <name>",
+		Short: "Remove a context",
+		Long:  `Remove a context, running commands on this machine if it was in use`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify the name of the context, see help for more details"))
+				return
+			}
+
+			handle.Error(updateContexts(func(contexts *client.Contexts) error {
+				if !contexts.Remove(args[0]) {
+					return fmt.Errorf("context %s not found", args[0])
+				}
+				printing.PrintSuccess(fmt.Sprintf("Removed context %s", args[0]))
+				return nil
+			}))
+		},
+	}
+
+	contextLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List the contexts",
+		Long:  `List the contexts, marking the one in use`,
+		Run: func(cmd *cobra.Command, args []string) {
+			handle.Error(listContexts())
+		},
+	}
+)
+
+// updateContexts - loads the user's contexts, changes them and saves them
+func updateContexts(change func(contexts *client.Contexts) error) (err error) {
+	path, err := client.DefaultContextsPath()
+	if err != nil {
+		return err
+	}
+
+	contexts, err := client.LoadContexts(path)
+	if err != nil {
+		return err
+	}
+
+	err = change(&contexts)
+	if err != nil {
+		return err
+	}
+
+	return contexts.Save(path)
+}
+
+// listContexts - prints the user's contexts
+func listContexts() (err error) {
+	path, err := client.DefaultContextsPath()
+	if err != nil {
+		return err
+	}
+
+	contexts, err := client.LoadContexts(path)
+	if err != nil {
+		return err
+	}
+
+	// Create the table and print the contexts
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "Current\tName\tServer\tToken\t")
+
+	current := contexts.Current
+	if current == "" {
+		current = localContext
+	}
+	all := append([]client.Context{{Name: localContext, Server: "-"}}, contexts.Contexts...)
+	for _, ctx := range all {
+		mark := ""
+		if ctx.Name == current {
+			mark = "*"
+		}
+		token := "-"
+		if ctx.Token != "" {
+			token = "set"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", mark, ctx.Name, ctx.Server, token)
+	}
+	w.Flush()
+
+	return nil
+}
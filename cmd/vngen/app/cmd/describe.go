@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/cmd/vngen/app/pkg/details"
+	"nenvoy.com/pkg/client"
+	"nenvoy.com/pkg/utils/handle"
+)
+
+func init() {
+	// Describe flags
+	describeCmd.Flags().BoolVar(&describeXML, "xml", false, "Also print the libvirt XML of a host or network")
+
+	baseCmd.AddCommand(describeCmd)
+}
+
+var (
+	describeXML bool
+
+	describeCmd = &cobra.Command{
+		Use:   "describe <host|network|deployment> <name>",
+		Short: "Show everything known about a host, network or deployment",
+		Long: `Show everything known about a host, network or deployment
+
+Hosts are shown with their disks and the image they are backed by, their
+interfaces with MACs and addresses, and the networks they are attached to.
+Networks are shown with the hosts on them, and deployments with their
+hosts and networks. Each ends with its recent events, which are kept while
+the api server runs and by local commands. --xml adds the libvirt XML of a
+host or network.`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 2 {
+				handle.Error(errors.New("Need to specify host, network or deployment and its name, see help for more details"))
+				return
+			}
+
+			handle.Error(describe(args[0], args[1]))
+		},
+	}
+)
+
+// describe - prints everything known about the named host, network or deployment
+func describe(kind string, name string) (err error) {
+	ctx := context.Background()
+
+	switch kind {
+	case "host":
+		hst, err := describeHost(ctx, name)
+		if err != nil {
+			return err
+		}
+		printHostDescription(os.Stdout, hst)
+	case "network":
+		netwk, err := describeNetwork(ctx, name)
+		if err != nil {
+			return err
+		}
+		printNetworkDescription(os.Stdout, netwk)
+	case "deployment":
+		if describeXML {
+			return errors.New("--xml describes a host or network, deployments have no libvirt XML")
+		}
+		dep, err := describeDeployment(ctx, name)
+		if err != nil {
+			return err
+		}
+		printDeploymentDescription(os.Stdout, dep)
+	default:
+		return fmt.Errorf("cannot describe %s, expected host, network or deployment", kind)
+	}
+
+	return nil
+}
+
+// describeHost - returns the description of a host, from the server when running remotely
+func describeHost(ctx context.Context, name string) (hst client.HostDescription, err error) {
+	if remote != nil {
+		return remote.DescribeHost(ctx, name, describeXML)
+	}
+
+	local, err := details.DescribeHost(name, describeXML)
+	if err != nil {
+		return hst, err
+	}
+	return hst, convert(local, &hst)
+}
+
+// describeNetwork - returns the description of a network, from the server when running remotely
+func describeNetwork(ctx context.Context, name string) (netwk client.NetworkDescription, err error) {
+	if remote != nil {
+		return remote.DescribeNetwork(ctx, name, describeXML)
+	}
+
+	local, err := details.DescribeNetwork(name, describeXML)
+	if err != nil {
+		return netwk, err
+	}
+	return netwk, convert(local, &netwk)
+}
+
+// describeDeployment - returns the description of a deployment, from the server when running remotely
+func describeDeployment(ctx context.Context, name string) (dep client.DeploymentDescription, err error) {
+	if remote != nil {
+		return remote.DescribeDeployment(ctx, name)
+	}
+
+	local, err := details.DescribeDeployment(name)
+	if err != nil {
+		return dep, err
+	}
+	return dep, convert(local, &dep)
+}
+
+// printHostDescription - prints the host's fields, disks, interfaces, networks, events and XML
+func printHostDescription(out io.Writer, hst client.HostDescription) {
+	w := tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", hst.Name)
+	fmt.Fprintf(w, "Deployment:\t%s\n", hst.Deployment)
+	fmt.Fprintf(w, "State:\t%s\n", orDash(hst.State))
+	fmt.Fprintf(w, "Role:\t%s\n", orDash(hst.Role))
+	fmt.Fprintf(w, "Image:\t%s\n", hst.Image)
+	fmt.Fprintf(w, "CPUs:\t%d\n", hst.CPUs)
+	fmt.Fprintf(w, "RAM:\t%d\n", hst.RAM)
+	fmt.Fprintf(w, "Storage:\t%s\n", hst.HDSpace)
+	fmt.Fprintf(w, "Username:\t%s\n", hst.Username)
+	fmt.Fprintf(w, "Networks:\t%s\n", orDash(strings.Join(hst.Networks, ", ")))
+	w.Flush()
+
+	fmt.Fprintln(out, "\nDisks:")
+	w = tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "  Device\tFile\tFormat\tBacking Image\t")
+	for _, disk := range hst.Disks {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", disk.Device, disk.File, disk.Format, orDash(disk.BackingImage))
+	}
+	w.Flush()
+
+	fmt.Fprintln(out, "\nInterfaces:")
+	w = tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "  Index\tName\tType\tNetwork\tDevice\tMacAddr\tAddress\tIPv4\tIPv6\t")
+	for _, iface := range hst.Interfaces {
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", iface.Index, orDash(iface.Name), iface.Type, orDash(iface.Network), orDash(iface.Device),
+			iface.MacAddress, orDash(iface.Address), orDash(iface.IPv4), orDash(iface.IPv6))
+	}
+	w.Flush()
+
+	printEvents(out, hst.Events, false)
+	printXML(out, hst.XML)
+}
+
+// printNetworkDescription - prints the network's fields, hosts, events and XML
+func printNetworkDescription(out io.Writer, netwk client.NetworkDescription) {
+	w := tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", netwk.Name)
+	fmt.Fprintf(w, "Deployment:\t%s\n", netwk.Deployment)
+	fmt.Fprintf(w, "State:\t%s\n", netwk.State)
+	fmt.Fprintf(w, "Type:\t%s\n", netwk.Type)
+	fmt.Fprintf(w, "Bridge:\t%s\n", orDash(netwk.BridgeName))
+	fmt.Fprintf(w, "IP:\t%s\n", orDash(netwk.IP))
+	fmt.Fprintf(w, "Netmask:\t%s\n", orDash(netwk.Netmask))
+	fmt.Fprintf(w, "DHCP Range:\t%s\n", formatRange(netwk.DHCPLower, netwk.DHCPUpper))
+	fmt.Fprintf(w, "IPv6:\t%s\n", formatIPv6(netwk.IPv6, fmt.Sprint(netwk.IPv6Prefix), netwk.IPv6Mode, netwk.IPv6DHCPLower, netwk.IPv6DHCPUpper))
+	fmt.Fprintf(w, "MTU:\t%d\n", netwk.MTU)
+	fmt.Fprintf(w, "Domain:\t%s\n", orDash(netwk.Domain))
+	fmt.Fprintf(w, "Hosts:\t%s\n", orDash(strings.Join(netwk.Hosts, ", ")))
+	w.Flush()
+
+	printEvents(out, netwk.Events, false)
+	printXML(out, netwk.XML)
+}
+
+// printDeploymentDescription - prints the deployment's fields, hosts, networks and events
+func printDeploymentDescription(out io.Writer, dep client.DeploymentDescription) {
+	w := tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", dep.Name)
+	fmt.Fprintf(w, "Owner:\t%s\n", orDash(dep.Owner))
+	fmt.Fprintf(w, "State:\t%s\n", dep.State)
+	fmt.Fprintf(w, "Created:\t%s\n", dep.CreatedAt.Local().Format("2006-01-02 15:04"))
+	w.Flush()
+
+	fmt.Fprintln(out, "\nHosts:")
+	w = tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "  Name\tState\tImage\tRAM\tCPU\tStorage\t")
+	for _, hst := range dep.Hosts {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%d\t%d\t%s\n", hst.Name, orDash(hst.State), hst.Image, hst.RAM, hst.CPUs, hst.HDSpace)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out, "\nNetworks:")
+	w = tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(w, "  Name\tState\tType\tIP\tDHCP Range\t")
+	for _, netwk := range dep.Networks {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%s\n", netwk.Name, netwk.State, netwk.Type, orDash(netwk.IP), formatRange(netwk.DHCPLower, netwk.DHCPUpper))
+	}
+	w.Flush()
+
+	printEvents(out, dep.Events, true)
+}
+
+// printEvents - prints the recent events, with the object each is about when they are of several
+func printEvents(out io.Writer, events []client.Event, withObject bool) {
+	if len(events) == 0 {
+		fmt.Fprintln(out, "\nEvents: <none>")
+		return
+	}
+
+	fmt.Fprintln(out, "\nEvents:")
+	w := tabwriter.NewWriter(out, 1, 1, 2, ' ', 0)
+	if withObject {
+		fmt.Fprintln(w, "  Time\tObject\tAction\tDetail\t")
+	} else {
+		fmt.Fprintln(w, "  Time\tAction\tDetail\t")
+	}
+	for _, e := range events {
+		when := e.Time.Local().Format("2006-01-02 15:04:05")
+		if withObject {
+			fmt.Fprintf(w, "  %s\t%s/%s\t%s\t%s\n", when, e.Kind, e.Name, e.Action, e.Detail)
+		} else {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", when, e.Action, e.Detail)
+		}
+	}
+	w.Flush()
+}
+
+// printXML - prints the libvirt XML, if it was asked for
+func printXML(out io.Writer, xml string) {
+	if xml == "" {
+		return
+	}
+
+	fmt.Fprintf(out, "\nXML:\n%s\n", strings.TrimRight(xml, "\n"))
+}
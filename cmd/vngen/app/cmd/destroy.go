@@ -28,6 +28,12 @@ var destroyCmd = &cobra.Command{
 		}
 
 		printing.PrintInfo(fmt.Sprintf("Destroying %s %s", args[0], args[1]))
+		// Ask the server when running remotely
+		if remote != nil {
+			handle.Error(remoteAction("destroy", args[0], args[1]))
+			return
+		}
+
 		// Get the hosts
 		if args[0] == "host" {
 			handle.Error(topology.DestroyHost(args[1]))
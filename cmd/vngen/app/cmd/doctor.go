@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/doctor"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+func init() {
+	baseCmd.AddCommand(doctorCmd)
+}
+
+// statusColours - how each status of a check is printed
+var statusColours = map[string]string{
+	doctor.StatusOK:      "\033[1;32m%s\033[0m",
+	doctor.StatusWarning: "\033[1;33m%s\033[0m",
+	doctor.StatusFailed:  "\033[1;31m%s\033[0m",
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check this machine can build deployments",
+	Long: `Check this machine can build deployments
+
+Checks qemu-img and cloud-localds are installed, and ovs-vsctl and iptables
+for the templates that need them, that the emulator in the config exists,
+that /dev/kvm can be opened, that libvirt can be connected to and is recent
+enough, that there is free space in the app directory, and that libvirt's
+default network does not overlap the machine's interfaces or vngen's
+networks. Each check that does not pass is printed with how to fix it.
+The same checks run before every build, locally or on the api server.`,
+	Annotations: map[string]string{localOnly: "true"},
+	Run: func(cmd *cobra.Command, args []string) {
+		results := doctor.Run(config.Get())
+		printResults(results, true)
+
+		if doctor.Failed(results) {
+			handle.Error(fmt.Errorf("%d checks failed", countFailed(results)))
+			return
+		}
+		printing.PrintSuccess("This machine can build deployments")
+	},
+}
+
+// preflight - runs the doctor's checks before a build, printing only those that did not pass
+func preflight() (err error) {
+	results := doctor.Run(config.Get())
+	printResults(results, false)
+
+	if doctor.Failed(results) {
+		return fmt.Errorf("%d checks failed, fix them or build anyway with --skip-checks", countFailed(results))
+	}
+	return nil
+}
+
+// printResults - prints the checks with how to fix those that did not pass, leaving out those that passed unless all is set
+func printResults(results []doctor.Result, all bool) {
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
+	for _, result := range results {
+		if result.Status == doctor.StatusOK && !all {
+			continue
+		}
+
+		// Every first cell holds the same escapes, so the columns line up
+		status := fmt.Sprintf(statusColours[result.Status], fmt.Sprintf("%-7s", result.Status))
+		fmt.Fprintf(w, "%s\t%s\t%s\n", status, result.Check, result.Message)
+		if result.Remedy != "" {
+			blank := fmt.Sprintf(statusColours[result.Status], strings.Repeat(" ", 7))
+			fmt.Fprintf(w, "%s\t\t-> %s\n", blank, result.Remedy)
+		}
+	}
+	w.Flush()
+}
+
+// countFailed - returns the number of checks that failed
+func countFailed(results []doctor.Result) (failed int) {
+	for _, result := range results {
+		if result.Status == doctor.StatusFailed {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/topology"
+	"nenvoy.com/pkg/utils/handle"
+)
+
+func init() {
+	// Firewall flags
+	firewallApplyCmd.Flags().StringVarP(&firewallNetwork, "network", "n", "", "Network of the interface to apply to, all interfaces by default")
+
+	firewallCmd.AddCommand(firewallShowCmd)
+	firewallCmd.AddCommand(firewallApplyCmd)
+	baseCmd.AddCommand(firewallCmd)
+}
+
+var (
+	firewallNetwork string
+
+	firewallCmd = &cobra.Command{
+		Use:         "firewall <show|apply>",
+		Annotations: map[string]string{localOnly: "true"},
+		Short:       "Show or change the firewall of a host",
+		Long:        `Show or change the firewall of a host`,
+	}
+
+	firewallShowCmd = &cobra.Command{
+		Use:   "show <host>",
+		Short: "Show the firewall rules of a host's interfaces",
+		Long:  `Show the firewall rules of a host's interfaces`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify a host, see help for more details"))
+				return
+			}
+
+			handle.Error(showFirewall(args[0]))
+		},
+	}
+
+	firewallApplyCmd = &cobra.Command{
+		Use:   "apply <host> <file>",
+		Short: "Replace the firewall of a host from a file",
+		Long: `Replace the firewall of a host from a file
+
+The file holds the firewall section of a host in the template, with the
+ingress and egress policies and the rules. Running hosts pick up the change
+immediately.`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 2 {
+				handle.Error(errors.New("Need to specify a host and firewall file, see help for more details"))
+				return
+			}
+
+			handle.Error(applyFirewall(args[0], args[1]))
+		},
+	}
+)
+
+// applyFirewall - reads the firewall file and applies it to the host
+func applyFirewall(name string, filename string) (err error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	def := structs.FirewallDefinition{}
+	err = yaml.Unmarshal(buf, &def)
+	if err != nil {
+		return fmt.Errorf("in file %q: %v", filename, err)
+	}
+
+	return topology.SetFirewall(name, firewallNetwork, def)
+}
+
+// showFirewall - prints the firewall rules of each of the host's interfaces
+func showFirewall(name string) (err error) {
+	hst, err := host.GetHostByName(name)
+	if err != nil {
+		return err
+	}
+	if hst.Name == "" {
+		return fmt.Errorf("host %s not found", name)
+	}
+
+	ifaces, err := hst.GetInterfaces()
+	if err != nil {
+		return err
+	}
+
+	// Create the table and print the rules
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "Network\tAction\tDirection\tProtocol\tPort\tCIDR\t")
+
+	for _, iface := range ifaces {
+		def, err := iface.GetFirewall()
+		if err != nil {
+			return err
+		}
+		if def == nil {
+			fmt.Fprintf(w, "%s\tallow\tinout\tall\t-\t-\n", iface.Network)
+			continue
+		}
+
+		for _, rule := range def.Rules {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", iface.Network, rule.Action, rule.Direction, rule.Protocol, orDash(rule.Port), orDash(rule.CIDR))
+		}
+		fmt.Fprintf(w, "%s\t%s\tin\tall\t-\t-\n", iface.Network, def.Ingress)
+		fmt.Fprintf(w, "%s\t%s\tout\tall\t-\t-\n", iface.Network, def.Egress)
+	}
+	w.Flush()
+
+	return nil
+}
+
+// orDash - returns the value, or - when it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
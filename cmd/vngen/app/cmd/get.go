@@ -1,15 +1,17 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"text/tabwriter"
+	"strconv"
+	"time"
 
-	"nenvoy.com/pkg/deployment"
-
-	"nenvoy.com/pkg/host"
-	"nenvoy.com/pkg/network"
+	"nenvoy.com/cmd/vngen/app/pkg/details"
+	"nenvoy.com/pkg/client"
+	"nenvoy.com/pkg/utils/output"
 
 	"github.com/spf13/cobra"
 	"nenvoy.com/pkg/utils/handle"
@@ -17,113 +19,304 @@ import (
 )
 
 func init() {
+	// Get flags
+	getCmd.Flags().StringVarP(&getOutput, "output", "o", "", "Output format, json, yaml, wide, name or custom-columns=HEADER:.Field,...")
+	getCmd.Flags().StringVarP(&getSelector, "selector", "l", "", "Only objects whose fields match, e.g. state=running,image!=ubuntu")
+	getCmd.Flags().StringVarP(&getDeployment, "deployment", "d", "", "Only objects in the deployment")
+	getCmd.Flags().BoolVarP(&getWatch, "watch", "w", false, "Redraw the table whenever hosts or networks change, highlighting what changed")
+
 	baseCmd.AddCommand(getCmd)
 }
 
-var getCmd = &cobra.Command{
-	Use:   "get <hosts|networks|ips>",
-	Short: "Return objects from the database",
-	Long:  `Return objects from the database`,
-	Run: func(cmd *cobra.Command, args []string) {
+var (
+	getOutput     string
+	getSelector   string
+	getDeployment string
+	getWatch      bool
 
-		//Sepcify the username for connecting
-		if len(args) != 1 {
-			handle.Error(errors.New("Need to specify hosts, networks or ips, see help for more details"))
-			return
-		}
+	getCmd = &cobra.Command{
+		Use:   "get <hosts|networks|ips|deployments>",
+		Short: "Return objects from the database",
+		Long: `Return objects from the database
 
-		printing.PrintInfo(fmt.Sprintf("Getting %s", args[0]))
-		// Get the hosts
-		if args[0] == "hosts" {
-			handle.Error(getHosts())
-		} else if args[0] == "networks" {
-			handle.Error(getNetworks())
-		} else if args[0] == "ips" {
-			handle.Error(getIPs())
-		}
+Objects are printed as a table, or with -o as json or yaml the same as the
+api answers with, wide with every column, name or custom-columns, e.g.
+-o custom-columns=NAME:.Name,STATE:.State. Select objects by their fields
+with -l, e.g. -l state=running,image!=ubuntu, and by deployment with -d.
+
+With -w the table is redrawn whenever libvirt reports a host or network
+changing state, and for a minute after while hosts boot and lease their
+addresses. Rows that changed or appeared are highlighted.`,
+		Run: func(cmd *cobra.Command, args []string) {
 
+			//Sepcify the username for connecting
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify hosts, networks, ips or deployments, see help for more details"))
+				return
+			}
+
+			handle.Error(get(args[0]))
+		},
+	}
+)
+
+// getter - the kind of objects get lists, the columns of their table and how to list them
+type getter struct {
+	kind    string
+	columns []output.Column
+	list    func(ctx context.Context) (interface{}, error)
+	// deploymentField - the field -d matches, Deployment unless set
+	deploymentField string
+	// key - identifies a row between redraws of --watch, its Name unless set
+	key func(row output.Item) string
+}
+
+// rowKey - returns what identifies the row between redraws of --watch
+func (g getter) rowKey(row output.Item) string {
+	if g.key != nil {
+		return g.key(row)
+	}
+	return row.Get("Name")
+}
+
+// getters - what get can list
+var getters = map[string]getter{
+	"hosts": {
+		kind: "host",
+		columns: []output.Column{
+			{Header: "Name", Field: "Name"},
+			{Header: "VMState", Field: "State"},
+			{Header: "Image", Field: "Image"},
+			{Header: "RAM", Field: "RAM"},
+			{Header: "CPU", Field: "CPUs"},
+			{Header: "Storage", Field: "HDSpace"},
+			{Header: "Deployment", Field: "Deployment"},
+			{Header: "Username", Field: "Username", Wide: true},
+		},
+		list: func(ctx context.Context) (interface{}, error) { return listHosts(ctx) },
+	},
+	"networks": {
+		kind: "network",
+		columns: []output.Column{
+			{Header: "Name", Field: "Name"},
+			{Header: "Type", Field: "Type"},
+			{Header: "IP", Field: "IP"},
+			{Header: "DHCP Range", Value: func(i output.Item) string { return formatRange(i.Get("DHCPLower"), i.Get("DHCPUpper")) }},
+			{Header: "IPv6", Value: func(i output.Item) string {
+				return formatIPv6(i.Get("IPv6"), i.Get("IPv6Prefix"), i.Get("IPv6Mode"), i.Get("IPv6DHCPLower"), i.Get("IPv6DHCPUpper"))
+			}},
+			{Header: "Domain", Value: func(i output.Item) string { return orDash(i.Get("Domain")) }},
+			{Header: "Deployment", Field: "Deployment"},
+			{Header: "State", Field: "State", Wide: true},
+			{Header: "Netmask", Field: "Netmask", Wide: true},
+			{Header: "MTU", Field: "MTU", Wide: true},
+			{Header: "Bridge", Field: "BridgeName", Wide: true},
+		},
+		list: func(ctx context.Context) (interface{}, error) { return listNetworks(ctx) },
+	},
+	"ips": {
+		kind: "host",
+		columns: []output.Column{
+			{Header: "Name", Field: "Name"},
+			{Header: "Interface", Field: "Interface"},
+			{Header: "MacAddr", Field: "MacAddress"},
+			{Header: "IPv4", Field: "IPv4"},
+			{Header: "IPv6", Field: "IPv6"},
+			{Header: "Deployment", Field: "Deployment"},
+		},
+		list: func(ctx context.Context) (interface{}, error) { return listIPs(ctx) },
+		key:  func(row output.Item) string { return row.Get("Name") + "/" + row.Get("MacAddress") },
+	},
+	"deployments": {
+		kind: "deployment",
+		columns: []output.Column{
+			{Header: "Name", Field: "Name"},
+			{Header: "Hosts", Value: func(i output.Item) string { return countOf(i, "Hosts") }},
+			{Header: "Networks", Value: func(i output.Item) string { return countOf(i, "Networks") }},
+			{Header: "State", Field: "State"},
+			{Header: "Created", Value: func(i output.Item) string { return formatTime(i.Get("CreatedAt")) }},
+			{Header: "Owner", Value: func(i output.Item) string { return orDash(i.Get("Owner")) }, Wide: true},
+		},
+		list:            func(ctx context.Context) (interface{}, error) { return listDeployments(ctx) },
+		deploymentField: "Name",
 	},
 }
 
-func getHosts() (err error) {
+// hostAddress - the addresses of a host's interface, a row of get ips
+type hostAddress struct {
+	Name       string
+	Interface  string
+	MacAddress string
+	IPv4       string
+	IPv6       string
+	Deployment string
+}
 
-	// Get all the hosts from the database
-	hosts, err := host.GetHosts()
+// get - prints the objects in the format and matching the filters given
+func get(what string) (err error) {
+	g, ok := getters[what]
+	if !ok {
+		return fmt.Errorf("cannot get %s, expected hosts, networks, ips or deployments", what)
+	}
+
+	printer, err := output.NewPrinter(getOutput, g.kind, g.columns)
 	if err != nil {
 		return err
 	}
-
-	// Create the table and print the hosts
-	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
-	fmt.Fprintln(w, "Name\tVMState\tImage\tRAM\tCPU\tStorage\tDeployment\t")
-
-	for _, host := range hosts {
-		// Get the deployment name
-		dep, err := deployment.GetDeploymentByID(host.DeploymentID)
-		if err != nil {
-			return err
-		}
-		state, err := host.GetHostState()
-		if err != nil {
-			return err
+	selector, err := output.ParseSelector(getSelector)
+	if err != nil {
+		return err
+	}
+	if getDeployment != "" {
+		field := g.deploymentField
+		if field == "" {
+			field = "Deployment"
 		}
+		selector = append(selector, output.Requirement{Field: field, Equals: true, Value: getDeployment})
+	}
 
-		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n", host.Name, state, host.Image, host.RAM, host.CPUs, host.HDSpace, dep.Name)
+	if getWatch {
+		return watch(what, g, printer, selector)
 	}
-	w.Flush()
 
-	return nil
-}
+	// Messages would corrupt the output of scripts
+	if printer.IsTable() {
+		printing.PrintInfo(fmt.Sprintf("Getting %s", what))
+	}
 
-func getNetworks() (err error) {
-	// Get all the hosts from the database
-	networks, err := network.GetNetworks()
+	items, err := g.list(context.Background())
+	if err != nil {
+		return err
+	}
+	items, err = output.Select(items, selector)
 	if err != nil {
 		return err
 	}
 
-	// Create the table and print the hosts
-	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
-	fmt.Fprintln(w, "Name\tType\tIP\tDHCP Range\tDeployment\t")
+	return printer.Print(os.Stdout, items)
+}
 
-	for _, network := range networks {
-		// Get the deployment name
-		dep, err := deployment.GetDeploymentByID(network.DeploymentID)
-		if err != nil {
-			return err
-		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", network.Name, network.Type, network.IP, fmt.Sprintf("%s - %s", network.DHCPLower, network.DHCPUpper), dep.Name)
+// listHosts - returns the details of every host, from the server when running remotely
+func listHosts(ctx context.Context) (hosts []client.HostDetails, err error) {
+	if remote != nil {
+		return remote.GetHosts(ctx)
 	}
-	w.Flush()
 
-	return nil
+	local, err := details.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+	return hosts, convert(local, &hosts)
 }
 
-// getIPs - Get the IPs of machines in a deployment
-func getIPs() (err error) {
-	// Get all the hosts from the database
-	hosts, err := host.GetHosts()
+// listNetworks - returns the details of every network, from the server when running remotely
+func listNetworks(ctx context.Context) (networks []client.NetworkDetails, err error) {
+	if remote != nil {
+		return remote.GetNetworks(ctx)
+	}
+
+	local, err := details.GetNetworks()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return networks, convert(local, &networks)
+}
+
+// listDeployments - returns the details of every deployment, from the server when running remotely
+func listDeployments(ctx context.Context) (deps []client.DeploymentDetails, err error) {
+	if remote != nil {
+		return remote.GetDeployments(ctx)
 	}
 
-	// Create the table and print the hosts
-	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
-	fmt.Fprintln(w, "Name\tInterface\tMacAddr\tIPs\tDeployment\t")
+	local, err := details.GetDeployments()
+	if err != nil {
+		return nil, err
+	}
+	return deps, convert(local, &deps)
+}
+
+// listIPs - returns the addresses of every host's interfaces, from the server when running remotely
+func listIPs(ctx context.Context) (rows []hostAddress, err error) {
+	hosts, err := listHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	rows = []hostAddress{}
 	for _, hst := range hosts {
-		dep, err := deployment.GetDeploymentByID(hst.DeploymentID)
-		if err != nil {
-			return err
+		// Hosts that are not running have no addresses
+		ifaces := []client.InterfaceAddresses{}
+		if hst.State == "running" {
+			ifaces, err = hostIPs(ctx, hst.Name)
+			if err != nil {
+				return nil, err
+			}
 		}
-		ifaces, err := hst.GetHostIfaces()
 		if len(ifaces) == 0 {
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", hst.Name, "", "", "", dep.Name)
+			rows = append(rows, hostAddress{Name: hst.Name, Deployment: hst.Deployment})
 		}
 		for _, iface := range ifaces {
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", hst.Name, iface.Name, iface.MacAddress, iface.IPv4, dep.Name)
+			rows = append(rows, hostAddress{Name: hst.Name, Interface: iface.Name, MacAddress: iface.MacAddress, IPv4: iface.IPv4, IPv6: iface.IPv6, Deployment: hst.Deployment})
 		}
 	}
-	w.Flush()
-	return nil
+
+	return rows, nil
+}
+
+// hostIPs - returns the addresses of the host's interfaces, from the server when running remotely
+func hostIPs(ctx context.Context, name string) (ifaces []client.InterfaceAddresses, err error) {
+	if remote != nil {
+		return remote.GetHostIPs(ctx, name)
+	}
+
+	local, err := details.GetHostIP(name)
+	if err != nil {
+		return nil, err
+	}
+	return ifaces, convert(local, &ifaces)
+}
+
+// convert - copies details collected locally into the types the api answers with, so both print the same
+func convert(local interface{}, out interface{}) (err error) {
+	buf, err := json.Marshal(local)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(buf, out)
+}
+
+// countOf - returns the number of objects in the list field
+func countOf(i output.Item, field string) string {
+	list, _ := i[field].([]interface{})
+	return strconv.Itoa(len(list))
+}
+
+// formatTime - returns the RFC 3339 time to the minute, in local time
+func formatTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// formatRange - returns the DHCP range, or - if the network has none
+func formatRange(lower string, upper string) string {
+	if lower == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%s - %s", lower, upper)
+}
+
+// formatIPv6 - returns the IPv6 prefix, mode and DHCP range, or - if the network has none
+func formatIPv6(ip string, prefix string, mode string, lower string, upper string) string {
+	if ip == "" {
+		return "-"
+	}
+	ipv6 := fmt.Sprintf("%s/%s %s", ip, prefix, mode)
+	if lower != "" {
+		ipv6 += fmt.Sprintf(" %s - %s", lower, upper)
+	}
+	return ipv6
 }
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/pki"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+func init() {
+	pkiCmd.AddCommand(pkiIssueClientCmd)
+	baseCmd.AddCommand(pkiCmd)
+}
+
+var (
+	pkiCmd = &cobra.Command{
+		Use:         "pki <issue-client>",
+		Annotations: map[string]string{localOnly: "true"},
+		Short:       "Manage the certificates of the rest api",
+		Long: `Manage the certificates of the rest api
+
+The CA, server certificate and client certificates are kept in pki in the
+app directory, /var/lib/nenvn unless configured. The CA is created the first time the api is run with
+--tls.`,
+	}
+
+	pkiIssueClientCmd = &cobra.Command{
+		Use:   "issue-client <name>",
+		Short: "Issue a client certificate for the rest api",
+		Long:  `Issue a client certificate signed by the vngen CA, for use with vngen api --client-auth`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify the name of the client, see help for more details"))
+				return
+			}
+
+			p := pki.Default()
+			certPath, keyPath, err := p.IssueClient(args[0])
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+
+			printing.PrintSuccess(fmt.Sprintf("Issued a client certificate for %s", args[0]))
+			fmt.Printf("Certificate: %s\nKey:         %s\nCA:          %s\n", certPath, keyPath, p.CACert())
+		},
+	}
+)
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/topology"
+	"nenvoy.com/pkg/utils/handle"
+)
+
+func init() {
+	// Port flags
+	portAddCmd.Flags().StringVarP(&portNetwork, "network", "n", "", "Network of the interface to forward to, the first interface with an ip by default")
+
+	portCmd.AddCommand(portAddCmd)
+	portCmd.AddCommand(portRmCmd)
+	portCmd.AddCommand(portLsCmd)
+	baseCmd.AddCommand(portCmd)
+}
+
+var (
+	portNetwork string
+
+	portCmd = &cobra.Command{
+		Use:         "port <add|rm|ls>",
+		Annotations: map[string]string{localOnly: "true"},
+		Short:       "Forward ports on the hypervisor to hosts",
+		Long: `Forward ports on the hypervisor to hosts
+
+Connections to a port on any of the hypervisor's addresses are forwarded to
+the fixed ip of a host interface, so the host must have an interface with an
+ip set in the template.`,
+	}
+
+	portAddCmd = &cobra.Command{
+		Use:   "add <host> <hostport>[:<guestport>][/<tcp|udp>]",
+		Short: "Forward a hypervisor port to a host",
+		Long:  `Forward a hypervisor port to a host, e.g. vngen port add web 8080:80/tcp`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 2 {
+				handle.Error(errors.New("Need to specify the host and port, see help for more details"))
+				return
+			}
+
+			portDef, err := parsePort(args[1])
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+			portDef.Network = portNetwork
+
+			handle.Error(topology.AddPort(args[0], portDef))
+		},
+	}
+
+	portRmCmd = &cobra.Command{
+		Use:   "rm <host> <hostport>[/<tcp|udp>]",
+		Short: "Remove the forward of a hypervisor port to a host",
+		Long:  `Remove the forward of a hypervisor port to a host`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 2 {
+				handle.Error(errors.New("Need to specify the host and port, see help for more details"))
+				return
+			}
+
+			portDef, err := parsePort(args[1])
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+
+			handle.Error(topology.RemovePort(args[0], portDef.Protocol, portDef.HostPort))
+		},
+	}
+
+	portLsCmd = &cobra.Command{
+		Use:   "ls [host]",
+		Short: "List the ports forwarded to hosts",
+		Long:  `List the ports forwarded to all hosts or a single host`,
+		Run: func(cmd *cobra.Command, args []string) {
+			handle.Error(listPorts(args))
+		},
+	}
+)
+
+// parsePort - parses hostport[:guestport][/protocol]
+func parsePort(spec string) (portDef structs.PortDefinition, err error) {
+	portDef.Protocol = "tcp"
+	if i := strings.Index(spec, "/"); i >= 0 {
+		portDef.Protocol = strings.ToLower(spec[i+1:])
+		spec = spec[:i]
+	}
+
+	ports := strings.SplitN(spec, ":", 2)
+	portDef.HostPort, err = strconv.Atoi(ports[0])
+	if err != nil {
+		return portDef, fmt.Errorf("invalid port %q", ports[0])
+	}
+	if len(ports) == 2 {
+		portDef.GuestPort, err = strconv.Atoi(ports[1])
+		if err != nil {
+			return portDef, fmt.Errorf("invalid guest port %q", ports[1])
+		}
+	}
+
+	return portDef, nil
+}
+
+// listPorts - prints the port forwards of the named hosts, or of all hosts
+func listPorts(names []string) (err error) {
+	hosts := []host.Host{}
+	if len(names) == 0 {
+		hosts, err = host.GetHosts()
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		hst, err := host.GetHostByName(name)
+		if err != nil {
+			return err
+		}
+		if hst.Name == "" {
+			return fmt.Errorf("host %s not found", name)
+		}
+		hosts = append(hosts, hst)
+	}
+
+	// Create the table and print the ports
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "Host\tProtocol\tHost Port\tGuest\tNetwork\tActive\tDeployment\t")
+
+	for _, hst := range hosts {
+		ports, err := hst.GetPorts()
+		if err != nil {
+			return err
+		}
+		if len(ports) == 0 {
+			continue
+		}
+
+		// Get the deployment name
+		dep, err := deployment.GetDeploymentByID(hst.DeploymentID)
+		if err != nil {
+			return err
+		}
+
+		for _, port := range ports {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s:%d\t%s\t%t\t%s\n", hst.Name, port.Protocol, port.HostPort, port.GuestIP, port.GuestPort, port.Network, port.Active(), dep.Name)
+		}
+	}
+	w.Flush()
+
+	return nil
+}
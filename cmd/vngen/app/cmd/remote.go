@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/client"
+	"nenvoy.com/pkg/events"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/printing"
+	"nenvoy.com/pkg/utils/root"
+)
+
+// localOnly - the annotation of commands that change the server itself, which only run on it
+const localOnly = "local-only"
+
+// localContext - the context name that runs commands against libvirt on this machine
+const localContext = "local"
+
+// jobInterval - how often a remote job is polled for its progress
+const jobInterval = time.Second
+
+func init() {
+	// Remote flags, defaulting to the environment
+	baseCmd.PersistentFlags().StringVar(&remoteServer, "server", os.Getenv("VNGEN_SERVER"), "Address of a vngen api server to run the command on, e.g. https://vngen.example.com:8000 (env VNGEN_SERVER)")
+	baseCmd.PersistentFlags().StringVar(&remoteToken, "token", os.Getenv("VNGEN_TOKEN"), "Api token of the server (env VNGEN_TOKEN)")
+	baseCmd.PersistentFlags().StringVar(&remoteContextName, "context", os.Getenv("VNGEN_CONTEXT"), "Context of the server to use instead of the current one, see vngen context (env VNGEN_CONTEXT)")
+	baseCmd.PersistentFlags().StringVar(&remoteCA, "ca", "", "CA to trust the https server with")
+	baseCmd.PersistentFlags().StringVar(&remoteCert, "cert", "", "Client certificate to present to the https server")
+	baseCmd.PersistentFlags().StringVar(&remoteKey, "key", "", "Key of the client certificate")
+
+	baseCmd.PersistentPreRun = connect
+}
+
+var (
+	remoteServer      string
+	remoteToken       string
+	remoteContextName string
+	remoteCA          string
+	remoteCert        string
+	remoteKey         string
+
+	// remote - the client of the api server commands run on, nil when they run locally
+	remote *client.Client
+)
+
+// connect - picks the server the command runs on, requiring root to run it locally
+func connect(cmd *cobra.Command, args []string) {
+	ctx, err := remoteContext()
+	if err != nil {
+		handle.Error(err)
+		os.Exit(1)
+	}
+
+	// Local mode drives libvirt directly
+	if ctx.Server == "" {
+		isRoot, err := root.AsRoot()
+		if err != nil {
+			handle.Error(err)
+		}
+		if !isRoot {
+			handle.Error(errors.New("permission error: root required"))
+			os.Exit(1)
+		}
+
+		// Keep what happens for describe to show later
+		events.Keep()
+		return
+	}
+
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[localOnly] != "" {
+			handle.Error(fmt.Errorf("vngen %s only runs on the server, not through the api", c.Name()))
+			os.Exit(1)
+		}
+	}
+
+	remote, err = ctx.Client()
+	if err != nil {
+		handle.Error(err)
+		os.Exit(1)
+	}
+}
+
+// remoteContext - returns the server given by the flags, or the chosen context, which is empty in local mode
+func remoteContext() (ctx client.Context, err error) {
+	if remoteServer != "" {
+		ctx = client.Context{Server: remoteServer}
+	} else {
+		path, err := client.DefaultContextsPath()
+		if err != nil {
+			return ctx, err
+		}
+		contexts, err := client.LoadContexts(path)
+		if err != nil {
+			return ctx, err
+		}
+
+		name := remoteContextName
+		if name == "" {
+			name = contexts.Current
+		}
+		if name == "" || name == localContext {
+			return client.Context{}, nil
+		}
+
+		var ok bool
+		ctx, ok = contexts.Get(name)
+		if !ok {
+			return ctx, fmt.Errorf("context %s not found in %s", name, path)
+		}
+	}
+
+	// Flags override what the context holds
+	if remoteToken != "" {
+		ctx.Token = remoteToken
+	}
+	if remoteCA != "" {
+		ctx.CA = remoteCA
+	}
+	if remoteCert != "" {
+		ctx.Cert, ctx.Key = remoteCert, remoteKey
+	}
+
+	return ctx, nil
+}
+
+// remoteBuild - uploads the YAML template to the server and follows the build
+func remoteBuild(path string) (err error) {
+	template, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	j, err := remote.CreateDeployment(ctx, template, "application/yaml")
+	if err != nil {
+		return err
+	}
+
+	return followJob(ctx, j)
+}
+
+// remoteAction - runs the action on a host, or a deployment in the background following its job
+func remoteAction(action string, kind string, name string) (err error) {
+	ctx := context.Background()
+
+	switch kind {
+	case "host":
+		hostActions := map[string]func(context.Context, string) (client.ActionResponse, error){
+			"start":   remote.StartHost,
+			"stop":    remote.StopHost,
+			"restart": remote.RestartHost,
+			"destroy": remote.DestroyHost,
+		}
+		_, err = hostActions[action](ctx, name)
+		if err != nil {
+			return err
+		}
+		printing.PrintSuccess(fmt.Sprintf("Ran %s on host %s", action, name))
+	case "deployment":
+		deploymentActions := map[string]func(context.Context, string) (client.Job, error){
+			"start":   remote.StartDeployment,
+			"stop":    remote.StopDeployment,
+			"restart": remote.RestartDeployment,
+			"destroy": remote.DestroyDeployment,
+		}
+		j, err := deploymentActions[action](ctx, name)
+		if err != nil {
+			return err
+		}
+		return followJob(ctx, j)
+	default:
+		return fmt.Errorf("unknown kind %s, expected host or deployment", kind)
+	}
+
+	return nil
+}
+
+// followJob - prints the steps of the job on the server as they happen until it finishes
+func followJob(ctx context.Context, j client.Job) (err error) {
+	printing.PrintInfo(fmt.Sprintf("Running %s of %s as job %d on the server", j.Kind, j.Target, j.ID))
+
+	printed := 0
+	for {
+		j, err = remote.GetJob(ctx, j.ID)
+		if err != nil {
+			return err
+		}
+
+		// Logs are timestamped lines, only the new ones are printed
+		lines := []string{}
+		if j.Logs != "" {
+			lines = strings.Split(j.Logs, "\n")
+		}
+		for _, line := range lines[printed:] {
+			if i := strings.Index(line, " "); i >= 0 {
+				line = line[i+1:]
+			}
+			printing.PrintInfo(fmt.Sprintf("[%3d%%] %s", j.Progress, line))
+		}
+		printed = len(lines)
+
+		if j.Finished() {
+			break
+		}
+		time.Sleep(jobInterval)
+	}
+
+	if j.Status != "succeeded" {
+		return errors.Errorf("%s of %s %s: %s", j.Kind, j.Target, j.Status, j.Error)
+	}
+	printing.PrintSuccess(fmt.Sprintf("Finished %s of %s", j.Kind, j.Target))
+
+	return nil
+}
+
+// remoteResolve - prints the answers for the name from the server
+func remoteResolve(name string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	answers, err := remote.Resolve(ctx, name, resolveType, resolveNetwork)
+	if err != nil {
+		return err
+	}
+
+	for _, answer := range answers.Answers {
+		fmt.Println(answer)
+	}
+
+	return nil
+}
+
+// remoteCapture - streams a capture from the server to out until ctx is done
+func remoteCapture(ctx context.Context, target string, out io.Writer) (err error) {
+	stream, err := remote.Capture(ctx, target, client.CaptureOptions{Filter: captureOpts.Filter, Format: captureOpts.Format, Count: captureOpts.Count})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	_, err = io.Copy(out, stream)
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	return err
+}
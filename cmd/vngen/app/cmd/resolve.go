@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/network"
+	"nenvoy.com/pkg/utils/handle"
+)
+
+func init() {
+	// Resolve flags
+	resolveCmd.Flags().StringVarP(&resolveType, "type", "t", network.RecordA, "Record type, A, AAAA, CNAME or SRV")
+	resolveCmd.Flags().StringVarP(&resolveNetwork, "network", "n", "", "Network to query, found from the name's domain by default")
+
+	baseCmd.AddCommand(resolveCmd)
+}
+
+var (
+	resolveType    string
+	resolveNetwork string
+
+	resolveCmd = &cobra.Command{
+		Use:   "resolve <name>",
+		Short: "Resolve a name using the DNS of a vngen network",
+		Long: `Resolve a name using the DNS of a vngen network
+
+Hosts are registered as <host>.<deployment>.<domain>, where the domain is
+vngen unless set in the template. The query is sent to the dnsmasq of the
+network serving the name's domain, or of the network given with --network.
+SRV names are given as _service._protocol.<deployment>.<domain>.`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify a name to resolve, see help for more details"))
+				return
+			}
+
+			if remote != nil {
+				handle.Error(remoteResolve(args[0]))
+				return
+			}
+
+			handle.Error(resolveName(args[0]))
+		},
+	}
+)
+
+// resolveName - prints the answers for the name
+func resolveName(name string) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	answers, err := network.Resolve(ctx, name, resolveType, resolveNetwork)
+	if err != nil {
+		return err
+	}
+
+	for _, answer := range answers {
+		fmt.Println(answer)
+	}
+
+	return nil
+}
@@ -28,6 +28,12 @@ var restartCmd = &cobra.Command{
 		}
 
 		printing.PrintInfo(fmt.Sprintf("Restarting %s %s", args[0], args[1]))
+		// Ask the server when running remotely
+		if remote != nil {
+			handle.Error(remoteAction("restart", args[0], args[1]))
+			return
+		}
+
 		// Get the hosts
 		if args[0] == "host" {
 			handle.Error(topology.RestartHost(args[1]))
@@ -28,6 +28,12 @@ var startCmd = &cobra.Command{
 		}
 
 		printing.PrintInfo(fmt.Sprintf("Starting %s %s", args[0], args[1]))
+		// Ask the server when running remotely
+		if remote != nil {
+			handle.Error(remoteAction("start", args[0], args[1]))
+			return
+		}
+
 		// Get the hosts
 		if args[0] == "host" {
 			handle.Error(topology.StartHost(args[1]))
@@ -28,6 +28,12 @@ var stopCmd = &cobra.Command{
 		}
 
 		printing.PrintInfo(fmt.Sprintf("Stopping %s %s", args[0], args[1]))
+		// Ask the server when running remotely
+		if remote != nil {
+			handle.Error(remoteAction("stop", args[0], args[1]))
+			return
+		}
+
 		// Get the hosts
 		if args[0] == "host" {
 			handle.Error(topology.StopHost(args[1]))
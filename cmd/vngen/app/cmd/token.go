@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"nenvoy.com/pkg/auth"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+func init() {
+	// Token flags
+	tokenCreateCmd.Flags().StringVarP(&tokenRole, "role", "r", auth.RoleViewer, "Role of the token, viewer, operator or admin")
+
+	tokenCmd.AddCommand(tokenCreateCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+	tokenCmd.AddCommand(tokenLsCmd)
+	baseCmd.AddCommand(tokenCmd)
+}
+
+var (
+	tokenRole string
+
+	tokenCmd = &cobra.Command{
+		Use:         "token <create|revoke|ls>",
+		Annotations: map[string]string{localOnly: "true"},
+		Short:       "Manage the tokens of the rest api",
+		Long: `Manage the tokens of the rest api
+
+Requests to the api send a token as Authorization: Bearer <token>. Viewers
+can read everything, operators can also build deployments and capture
+traffic, and start, stop, restart and destroy the deployments they built.
+Admins manage every deployment.`,
+	}
+
+	tokenCreateCmd = &cobra.Command{
+		Use:   "create <user>",
+		Short: "Create a token for a user",
+		Long:  `Create a token for a user, e.g. vngen token create alice --role operator. The token is only shown once.`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify the user, see help for more details"))
+				return
+			}
+
+			tok, secret, err := auth.CreateToken(args[0], tokenRole)
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+
+			printing.PrintSuccess(fmt.Sprintf("Created %s token %d for %s, it will not be shown again", tok.Role, tok.ID, tok.User))
+			fmt.Println(secret)
+		},
+	}
+
+	tokenRevokeCmd = &cobra.Command{
+		Use:   "revoke <id>",
+		Short: "Revoke a token",
+		Long:  `Revoke a token by the id shown by vngen token ls`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			if len(args) != 1 {
+				handle.Error(errors.New("Need to specify the id of the token, see help for more details"))
+				return
+			}
+
+			id, err := strconv.ParseUint(args[0], 10, 32)
+			if err != nil {
+				handle.Error(fmt.Errorf("invalid token id %q", args[0]))
+				return
+			}
+
+			err = auth.RevokeToken(uint(id))
+			if err != nil {
+				handle.Error(err)
+				return
+			}
+
+			printing.PrintSuccess(fmt.Sprintf("Revoked token %d", id))
+		},
+	}
+
+	tokenLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List the tokens",
+		Long:  `List the tokens that have not been revoked`,
+		Run: func(cmd *cobra.Command, args []string) {
+			handle.Error(listTokens())
+		},
+	}
+)
+
+// listTokens - prints every token that has not been revoked
+func listTokens() (err error) {
+	toks, err := auth.GetTokens()
+	if err != nil {
+		return err
+	}
+
+	// Create the table and print the tokens
+	w := tabwriter.NewWriter(os.Stdout, 1, 1, 1, ' ', 0)
+	fmt.Fprintln(w, "ID\tUser\tRole\tCreated\t")
+
+	for _, tok := range toks {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", tok.ID, tok.User, tok.Role, tok.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+
+	return nil
+}
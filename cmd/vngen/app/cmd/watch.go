@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"nenvoy.com/pkg/client"
+	"nenvoy.com/pkg/events"
+	"nenvoy.com/pkg/utils/output"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+const (
+	// settleInterval - how often the table is redrawn while hosts settle after an event
+	settleInterval = 3 * time.Second
+	// settleTime - how long hosts are given to boot and lease addresses after an event
+	settleTime = time.Minute
+	// highlightFor - how long changed rows stay highlighted
+	highlightFor = 10 * time.Second
+	// reconnectDelay - how long to wait before streaming the server's events again
+	reconnectDelay = 5 * time.Second
+	// clearScreen - moves the cursor home and clears the terminal
+	clearScreen = "\033[H\033[2J"
+)
+
+// watchKinds - the events that can change what get lists
+var watchKinds = []string{events.KindHost, events.KindNetwork, events.KindDeployment}
+
+// watcher - redraws the table of a getter, highlighting the rows that changed
+type watcher struct {
+	what     string
+	getter   getter
+	printer  *output.Printer
+	selector output.Selector
+	// values - the cells of each row last drawn, by the row's key
+	values map[string][]string
+	// changed - when each row last changed
+	changed map[string]time.Time
+	drawn   bool
+}
+
+// watch - redraws the table whenever libvirt or the server reports a change, until interrupted
+//
+// Hosts get their addresses after they start, which raises no event, so the
+// table is also redrawn every few seconds for a while after each event.
+func watch(what string, g getter, printer *output.Printer, selector output.Selector) (err error) {
+	if !printer.IsTable() && !strings.HasPrefix(printer.Format, output.FormatCustomColumns) {
+		return fmt.Errorf("--watch redraws a table, it cannot print -o %s", printer.Format)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Stop cleanly on ctrl-c
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Events only say something changed, bursts are drawn once
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+	if remote != nil {
+		go streamEvents(ctx, notify)
+	} else {
+		go watchEvents(ctx, notify)
+	}
+
+	w := &watcher{what: what, getter: g, printer: printer, selector: selector, values: map[string][]string{}, changed: map[string]time.Time{}}
+	w.draw(ctx)
+
+	ticker := time.NewTicker(settleInterval)
+	defer ticker.Stop()
+	settleUntil := time.Now().Add(settleTime)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+			settleUntil = time.Now().Add(settleTime)
+			w.draw(ctx)
+		case now := <-ticker.C:
+			if now.Before(settleUntil) {
+				w.draw(ctx)
+			}
+		}
+	}
+}
+
+// watchEvents - notifies of libvirt's lifecycle events on this machine, without keeping them
+func watchEvents(ctx context.Context, notify func()) {
+	b := events.NewBroker()
+	filter := events.Filter{Deployment: getDeployment, Kinds: watchKinds}
+	sub := b.Subscribe(filter, 0)
+	defer func() { b.Unsubscribe(sub) }()
+	go b.WatchLibvirt(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-sub.C:
+			if !ok {
+				// Fell behind, the next draw catches up
+				sub = b.Subscribe(filter, 0)
+			}
+			notify()
+		}
+	}
+}
+
+// streamEvents - notifies of the server's events, streaming them again from the last one when the stream breaks
+func streamEvents(ctx context.Context, notify func()) {
+	lastID := uint64(0)
+	for ctx.Err() == nil {
+		stream, err := remote.Events(ctx, client.EventOptions{Deployment: getDeployment, Kinds: watchKinds, LastID: lastID})
+		if err == nil {
+			for {
+				e, err := stream.Next()
+				if err != nil {
+					break
+				}
+				lastID = e.ID
+				notify()
+			}
+			stream.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// draw - lists the objects again and redraws the table, highlighting new and changed rows
+func (w *watcher) draw(ctx context.Context) {
+	now := time.Now()
+	buf := bytes.Buffer{}
+	lines, keys, err := w.render(ctx, &buf)
+
+	fmt.Print(clearScreen)
+	fmt.Printf("Watching %s, updated %s, ctrl-c to stop\n\n", w.what, now.Format("15:04:05"))
+	if err != nil {
+		printing.PrintError(err.Error())
+		return
+	}
+
+	for i, line := range lines {
+		// The first line is the header
+		if i > 0 && i <= len(keys) && now.Sub(w.changed[keys[i-1]]) < highlightFor {
+			fmt.Printf(printing.NoticeColour, line)
+			continue
+		}
+		fmt.Println(line)
+	}
+}
+
+// render - prints the table into buf and returns its lines with the key of each row, noting the rows that changed
+func (w *watcher) render(ctx context.Context, buf *bytes.Buffer) (lines []string, keys []string, err error) {
+	items, err := w.getter.list(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, err = output.Select(items, w.selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := output.Items(items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = w.printer.Print(buf, items)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rows that appear or whose cells differ from the last draw have changed
+	now := time.Now()
+	values := map[string][]string{}
+	for _, row := range rows {
+		key := w.getter.rowKey(row)
+		cells := []string{}
+		for _, column := range w.printer.Columns {
+			cells = append(cells, row.Column(column))
+		}
+
+		previous, seen := w.values[key]
+		if w.drawn && (!seen || strings.Join(previous, "\t") != strings.Join(cells, "\t")) {
+			w.changed[key] = now
+		}
+		values[key] = cells
+		keys = append(keys, key)
+	}
+	for key := range w.changed {
+		if _, ok := values[key]; !ok {
+			delete(w.changed, key)
+		}
+	}
+	w.values = values
+	w.drawn = true
+
+	return strings.Split(strings.TrimRight(buf.String(), "\n"), "\n"), keys, nil
+}
@@ -1,34 +1,43 @@
 package actions
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"nenvoy.com/pkg/errdefs"
 	"nenvoy.com/pkg/topology"
 
 	structs "nenvoy.com/pkg/constants"
 )
 
-// Build - takes a JSON template file and builds it
-func Build(template []byte) (err error) {
-	vnDef := structs.VirtualNetworkDefinition{}
+// Formats a template can be uploaded in
+const (
+	// FormatJSON - the JSON form of the template
+	FormatJSON = "json"
+	// FormatYAML - the YAML template built from the command line
+	FormatYAML = "yaml"
+)
 
-	// Unmarhsal the JSON template
-	err = json.Unmarshal(template, &vnDef)
-	if err != nil {
-		return err
+// ParseTemplate - takes a JSON or YAML template file to be built for the owner, checking its deployment name is free
+func ParseTemplate(template []byte, format string, owner string) (vnDef structs.VirtualNetworkDefinition, err error) {
+	// Unmarhsal the template in its format
+	switch format {
+	case FormatJSON:
+		err = json.Unmarshal(template, &vnDef)
+	case FormatYAML:
+		err = yaml.Unmarshal(template, &vnDef)
+	default:
+		return vnDef, errdefs.Invalidf("unknown template format %q", format)
 	}
-
-	fmt.Println(vnDef)
-
-	// Build the template
-	err = topology.Build(vnDef)
 	if err != nil {
-		return err
+		return vnDef, errdefs.Invalid(errors.Wrap(err, "invalid template"))
 	}
+	vnDef.Deployment.Owner = owner
 
-	return nil
-
+	// Deployment names are required and unique
+	return vnDef, topology.CheckDeploymentName(vnDef.Deployment.DeploymentName)
 }
 
 // Start - Starts either a deployment or host
@@ -104,3 +113,24 @@ func Destroy(name string, resource string) (err error) {
 
 	return nil
 }
+
+// BuildDeployment - builds the parsed template, reporting its progress until ctx is cancelled
+func BuildDeployment(ctx context.Context, vnDef structs.VirtualNetworkDefinition, progress topology.Progress) (err error) {
+	return topology.BuildContext(ctx, vnDef, progress)
+}
+
+// RunDeployment - runs start, stop, restart or destroy on a deployment, reporting its progress until ctx is cancelled
+func RunDeployment(ctx context.Context, action string, name string, progress topology.Progress) (err error) {
+	switch action {
+	case "start":
+		return topology.StartDeploymentContext(ctx, name, progress)
+	case "stop":
+		return topology.StopDeploymentContext(ctx, name, progress)
+	case "restart":
+		return topology.RestartDeploymentContext(ctx, name, progress)
+	case "destroy":
+		return topology.DestroyDeploymentContext(ctx, name, progress)
+	}
+
+	return errdefs.Invalidf("unknown action %s", action)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"nenvoy.com/pkg/auth"
+	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/errdefs"
+)
+
+// tokenKey - the context key of the token a request was authenticated with
+type tokenKey struct{}
+
+// anonymous - the token of every request when authentication is turned off
+var anonymous = auth.Token{Role: auth.RoleAdmin}
+
+// authenticator - returns the middleware authenticating requests by their bearer token
+//
+// With authenticate unset every request is let through as an admin, which
+// is only safe when the api cannot be reached by anyone else.
+func authenticator(authenticate bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tok := anonymous
+			if authenticate {
+				header := r.Header.Get("Authorization")
+				if !strings.HasPrefix(header, "Bearer ") {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					writeCode(w, errdefs.KindUnauthorized, "Authentication required", "send an api token as Authorization: Bearer <token>")
+					return
+				}
+
+				var err error
+				tok, err = auth.Authenticate(strings.TrimPrefix(header, "Bearer "))
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", "Bearer")
+					writeError(w, err, "Authentication failed")
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, tok)))
+		})
+	}
+}
+
+// requireRole - only lets requests through when their token has the role
+func requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok := requestToken(r)
+		if !tok.Allows(role) {
+			writeCode(w, errdefs.KindForbidden, "Forbidden", "the "+role+" role is required, "+tok.User+" is a "+tok.Role)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requestToken - returns the token the request was authenticated with
+func requestToken(r *http.Request) auth.Token {
+	tok, ok := r.Context().Value(tokenKey{}).(auth.Token)
+	if !ok {
+		return auth.Token{}
+	}
+	return tok
+}
+
+// authorise - checks the request's token can manage the deployment
+func authorise(r *http.Request, depName string) (err error) {
+	tok := requestToken(r)
+	if tok.Allows(auth.RoleAdmin) {
+		return nil
+	}
+
+	dep, err := deployment.GetDeploymentByName(depName)
+	if err != nil {
+		return err
+	}
+	if !tok.CanManage(dep.Owner) {
+		return errdefs.Forbiddenf("deployment %s is not owned by %s", depName, tok.User)
+	}
+
+	return nil
+}
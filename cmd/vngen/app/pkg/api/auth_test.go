@@ -0,0 +1,88 @@
+package api_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nenvoy.com/cmd/vngen/app/pkg/api"
+	"nenvoy.com/pkg/auth"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/network"
+)
+
+// TestViewerPassword - never answers with the passwords of the guests
+func TestViewerPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen-api")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	previous := config.Get()
+	defer config.Set(previous)
+	c := previous
+	c.AppDir = dir
+	c.DBPath = filepath.Join(dir, "main.db")
+	config.Set(c)
+
+	db, err := database.NewSession()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	err = db.AutoMigrate(&host.Host{}, &host.Interface{}, &host.PortForward{}, &network.Network{}, &deployment.Deployment{})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	dep := deployment.Deployment{Name: "lab", Owner: "alice"}
+	err = db.Create(&dep).Error
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	err = db.Create(&host.Host{Name: "web", Image: "ubuntu", Username: "ubuntu", Password: "hunter2", DeploymentID: dep.ID}).Error
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	_, secret, err := auth.CreateToken("bob", auth.RoleViewer)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	srv := httptest.NewServer(api.NewRouter(true))
+	defer srv.Close()
+
+	answered := 0
+	for _, path := range []string{"/hosts", "/hosts/web", "/hosts/web/describe", "/deployments", "/deployments/lab", "/deployments/lab/describe"} {
+		req, err := http.NewRequest("GET", srv.URL+api.Prefix+path, nil)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		// Hosts are described from libvirt, which may not be running
+		if resp.StatusCode != http.StatusOK {
+			continue
+		}
+		answered++
+		if strings.Contains(string(body), "hunter2") || strings.Contains(string(body), "Password") {
+			t.Errorf("GET %s sent the password to a viewer: %s", path, body)
+		}
+	}
+	if answered == 0 {
+		t.Skip("libvirt is not available to describe the hosts")
+	}
+}
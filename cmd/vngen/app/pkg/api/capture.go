@@ -0,0 +1,99 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"nenvoy.com/cmd/vngen/app/pkg/details"
+	"nenvoy.com/pkg/capture"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/utils/handle"
+	"nenvoy.com/pkg/utils/pcap"
+)
+
+// flushWriter - flushes every write so packets reach the client immediately
+type flushWriter struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func (fw flushWriter) Write(p []byte) (n int, err error) {
+	n, err = fw.w.Write(p)
+	fw.f.Flush()
+	return n, err
+}
+
+// Capture - streams a packet capture of a network or host:iface
+func Capture(w http.ResponseWriter, r *http.Request) {
+	// Get the variables
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+
+	opts := capture.Options{
+		Filter:  query.Get("filter"),
+		Format:  query.Get("format"),
+		SnapLen: pcap.DefaultSnapLen,
+	}
+	if count := query.Get("count"); count != "" {
+		c, err := strconv.Atoi(count)
+		if err != nil {
+			writeCode(w, errdefs.KindInvalid, fmt.Sprintf("Invalid packet count %s", count), err.Error())
+			return
+		}
+		opts.Count = c
+	}
+
+	if opts.Format != "" && opts.Format != pcap.FormatPcap && opts.Format != pcap.FormatPcapNG {
+		writeCode(w, errdefs.KindInvalid, fmt.Sprintf("Invalid capture format %s", opts.Format), "expected pcap or pcapng")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeCode(w, errdefs.KindInternal, "Streaming not supported", "")
+		return
+	}
+
+	// Only whoever can manage the deployment may see its traffic
+	depName, err := captureDeployment(vars["target"])
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to capture on %s", vars["target"]))
+		return
+	}
+	err = authorise(r, depName)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to capture on %s", vars["target"]))
+		return
+	}
+
+	// Open the socket before committing to a streamed response, so a bad filter or interface is reported as an error
+	session, err := capture.Open(vars["target"], opts)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to capture on %s", vars["target"]))
+		return
+	}
+	defer session.Close()
+
+	// Write the capture headers
+	w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+	if opts.Format == pcap.FormatPcapNG {
+		w.Header().Set("Content-Type", "application/x-pcapng")
+	}
+	w.WriteHeader(200)
+
+	// Capture until the client disconnects
+	_, err = session.Run(r.Context(), flushWriter{w: w, f: flusher})
+	handle.Error(err)
+}
+
+// captureDeployment - returns the deployment of the network or host:iface being captured on
+func captureDeployment(target string) (depName string, err error) {
+	parts := strings.SplitN(target, ":", 2)
+	if len(parts) == 1 {
+		return details.NetworkDeployment(target)
+	}
+	return details.HostDeployment(parts[0])
+}
@@ -1,189 +1,330 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strings"
 
 	"nenvoy.com/cmd/vngen/app/pkg/actions"
-	"nenvoy.com/pkg/utils/handle"
 
 	"github.com/gorilla/mux"
 	"nenvoy.com/cmd/vngen/app/pkg/details"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/doctor"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/job"
 )
 
-//Build - builds the virtual network
+// Resource kinds that can be started, stopped, restarted and destroyed
+const (
+	kindHost       = "host"
+	kindDeployment = "deployment"
+)
+
+// templateFormats - the template format of each content type a deployment can be uploaded as
+var templateFormats = map[string]string{
+	"":                   actions.FormatJSON,
+	"application/json":   actions.FormatJSON,
+	"application/yaml":   actions.FormatYAML,
+	"application/x-yaml": actions.FormatYAML,
+	"text/yaml":          actions.FormatYAML,
+	"text/x-yaml":        actions.FormatYAML,
+}
+
+//Build - builds the virtual network from a JSON or YAML template in the background, answering with the job building it
 func Build(w http.ResponseWriter, r *http.Request) {
+	// The Content-Type says how the template is written, JSON if unset
+	mediaType := ""
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			writeCode(w, codeBadRequest, "Error reading template", err.Error())
+			return
+		}
+	}
+	format, ok := templateFormats[mediaType]
+	if !ok {
+		writeCode(w, codeUnsupportedMediaType, "Error reading template", fmt.Sprintf("templates are uploaded as application/json or application/yaml, not %s", mediaType))
+		return
+	}
+
 	// Read the http request body
 	b, err := ioutil.ReadAll(r.Body)
-	handle.Error(err)
 	if err != nil {
-		w.WriteHeader(400)
-		w.Write([]byte("Error reading template"))
+		writeCode(w, codeBadRequest, "Error reading template", err.Error())
 		return
 	}
 
-	err = actions.Build(b)
-	handle.Error(err)
+	// Deployments are owned by the user building them
+	owner := requestToken(r).User
+	vnDef, err := actions.ParseTemplate(b, format, owner)
 	if err != nil {
-		w.WriteHeader(400)
-		w.Write([]byte("Error building template"))
+		writeError(w, err, "Error building template")
 		return
 	}
 
-	w.WriteHeader(200)
-	w.Write([]byte("Successfuly built template"))
-}
-
-func Start(w http.ResponseWriter, r *http.Request) {
-	// Get the variables
-	vars := mux.Vars(r)
-
-	if vars["resource"] != "host" && vars["resource"] != "deployment" {
-		w.WriteHeader(404)
-		w.Write([]byte(fmt.Sprintf("Can only start host or deployment, not %s", vars["resource"])))
+	// Builds on a machine that fails the doctor's checks stop part way through
+	results := doctor.Run(config.Get())
+	if doctor.Failed(results) {
+		writeCode(w, errdefs.KindInternal, fmt.Sprintf("Error building deployment %s, the server failed its checks", vnDef.Deployment.DeploymentName), failedChecks(results))
 		return
 	}
 
-	err := actions.Start(vars["name"], vars["resource"])
+	j, err := job.Run("build", vnDef.Deployment.DeploymentName, owner, func(ctx context.Context, tracker *job.Tracker) error {
+		return actions.BuildDeployment(ctx, vnDef, tracker)
+	})
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte(fmt.Sprintf("Failed to start %s %s", vars["resource"], vars["name"])))
+		writeError(w, err, fmt.Sprintf("Error building deployment %s", vnDef.Deployment.DeploymentName))
 		return
 	}
 
-	w.WriteHeader(200)
-	w.Write([]byte(fmt.Sprintf("Successfuly started %s %s", vars["resource"], vars["name"])))
+	writeJob(w, j)
+}
+
+// failedChecks - describes the checks that failed with how to fix them
+func failedChecks(results []doctor.Result) string {
+	failed := []string{}
+	for _, result := range results {
+		if result.Status == doctor.StatusFailed {
+			failed = append(failed, fmt.Sprintf("%s: %s, %s", result.Check, result.Message, result.Remedy))
+		}
+	}
+
+	return strings.Join(failed, "; ")
+}
+
+// StartHost - starts a host
+func StartHost(w http.ResponseWriter, r *http.Request) {
+	runAction(w, r, kindHost, "start", actions.Start)
+}
+
+// StopHost - stops a host
+func StopHost(w http.ResponseWriter, r *http.Request) {
+	runAction(w, r, kindHost, "stop", actions.Stop)
+}
+
+// RestartHost - restarts a host
+func RestartHost(w http.ResponseWriter, r *http.Request) {
+	runAction(w, r, kindHost, "restart", actions.Restart)
+}
+
+// DestroyHost - destroys a host
+func DestroyHost(w http.ResponseWriter, r *http.Request) {
+	runAction(w, r, kindHost, "destroy", actions.Destroy)
+}
+
+// StartDeployment - starts every host of a deployment in the background
+func StartDeployment(w http.ResponseWriter, r *http.Request) {
+	runJob(w, r, "start")
+}
+
+// StopDeployment - stops every host of a deployment in the background
+func StopDeployment(w http.ResponseWriter, r *http.Request) {
+	runJob(w, r, "stop")
+}
+
+// RestartDeployment - restarts every host of a deployment in the background
+func RestartDeployment(w http.ResponseWriter, r *http.Request) {
+	runJob(w, r, "restart")
+}
+
+// DestroyDeployment - destroys a deployment with its hosts and networks in the background
+func DestroyDeployment(w http.ResponseWriter, r *http.Request) {
+	runJob(w, r, "destroy")
 }
 
-func Stop(w http.ResponseWriter, r *http.Request) {
+// runAction - runs the action on the named host or deployment and describes the result
+func runAction(w http.ResponseWriter, r *http.Request, kind string, action string, run func(name string, resource string) error) {
 	// Get the variables
-	vars := mux.Vars(r)
-	if vars["resource"] != "host" && vars["resource"] != "deployment" {
-		w.WriteHeader(404)
-		w.Write([]byte(fmt.Sprintf("Can only stop host or deployment, not %s", vars["resource"])))
+	name := mux.Vars(r)["name"]
+
+	// Check the object exists first so a missing one is a 404, hosts whose domain is gone can still be destroyed
+	depName, err := actionDeployment(kind, name)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to %s %s %s", action, kind, name))
 		return
 	}
 
-	err := actions.Stop(vars["name"], vars["resource"])
+	// Hosts are managed by whoever can manage their deployment
+	err = authorise(r, depName)
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte(fmt.Sprintf("Failed to stop %s %s", vars["resource"], vars["name"])))
+		writeError(w, err, fmt.Sprintf("Failed to %s %s %s", action, kind, name))
 		return
 	}
 
-	w.WriteHeader(200)
-	w.Write([]byte(fmt.Sprintf("Successfuly stopped %s %s", vars["resource"], vars["name"])))
+	err = run(name, kind)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to %s %s %s", action, kind, name))
+		return
+	}
+
+	// Destroyed objects have nothing left to describe
+	resp := ActionResponse{Kind: kind, Name: name, Action: action}
+	if action != "destroy" {
+		resp.Object, err = describe(kind, name)
+		if err != nil {
+			writeError(w, err, fmt.Sprintf("Ran %s on %s %s but could not collect its details", action, kind, name))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func Restart(w http.ResponseWriter, r *http.Request) {
-	// Get the variables
-	vars := mux.Vars(r)
+// actionDeployment - returns the deployment of the named host or deployment from the database, or a not found error
+func actionDeployment(kind string, name string) (depName string, err error) {
+	if kind == kindHost {
+		return details.HostDeployment(name)
+	}
+
+	dep, err := deployment.GetDeploymentByName(name)
+	if err != nil {
+		return "", err
+	}
+	return dep.Name, nil
+}
+
+// describe - returns the details of the named host or deployment
+func describe(kind string, name string) (interface{}, error) {
+	if kind == kindHost {
+		return details.GetHost(name)
+	}
+	return details.GetDeployment(name)
+}
 
-	if vars["resource"] != "host" && vars["resource"] != "deployment" {
-		w.WriteHeader(404)
-		w.Write([]byte(fmt.Sprintf("Can only restart host or deployment, not %s", vars["resource"])))
+// GetHosts - returns the details of every host
+func GetHosts(w http.ResponseWriter, r *http.Request) {
+	resp, err := details.GetHosts()
+	if err != nil {
+		writeError(w, err, "Error collecting details")
 		return
 	}
 
-	err := actions.Restart(vars["name"], vars["resource"])
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetNetworks - returns every network
+func GetNetworks(w http.ResponseWriter, r *http.Request) {
+	resp, err := details.GetNetworks()
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte(fmt.Sprintf("Failed to restart %s %s", vars["resource"], vars["name"])))
+		writeError(w, err, "Error collecting details")
 		return
 	}
 
-	w.WriteHeader(200)
-	w.Write([]byte(fmt.Sprintf("Successfuly restarted %s %s", vars["resource"], vars["name"])))
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func Destroy(w http.ResponseWriter, r *http.Request) {
+// GetHost - returns the details of a host
+func GetHost(w http.ResponseWriter, r *http.Request) {
+
 	// Get the variables
 	vars := mux.Vars(r)
+	resp, err := details.GetHost(vars["name"])
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Error collecting details of host %s", vars["name"]))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
 
-	if vars["resource"] != "host" && vars["resource"] != "deployment" {
-		w.WriteHeader(404)
-		w.Write([]byte(fmt.Sprintf("Can only destroy host or deployment, not %s", vars["resource"])))
+// GetHostIP - returns the addresses of a host's interfaces
+func GetHostIP(w http.ResponseWriter, r *http.Request) {
+
+	// Get the variables
+	vars := mux.Vars(r)
+	resp, err := details.GetHostIP(vars["name"])
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Error collecting addresses of host %s", vars["name"]))
 		return
 	}
 
-	err := actions.Destroy(vars["name"], vars["resource"])
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetDeployments - returns the details of every deployment with its hosts and networks
+func GetDeployments(w http.ResponseWriter, r *http.Request) {
+	resp, err := details.GetDeployments()
 	if err != nil {
-		w.WriteHeader(500)
-		w.Write([]byte(fmt.Sprintf("Failed to destroy %s %s", vars["resource"], vars["name"])))
+		writeError(w, err, "Error collecting details")
 		return
 	}
 
-	w.WriteHeader(200)
-	w.Write([]byte(fmt.Sprintf("Successfuly destroyed %s %s", vars["resource"], vars["name"])))
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func GetHosts(w http.ResponseWriter, r *http.Request) {
-	resp, err := details.GetHosts()
+// GetDeployment - returns the details of a deployment with its hosts and networks
+func GetDeployment(w http.ResponseWriter, r *http.Request) {
 
+	// Get the variables
+	vars := mux.Vars(r)
+	resp, err := details.GetDeployment(vars["name"])
 	if err != nil {
-		w.WriteHeader(400)
-		w.Write([]byte("Error collecting details"))
+		writeError(w, err, fmt.Sprintf("Error collecting details of deployment %s", vars["name"]))
 		return
 	}
 
-	// Write the application type headers
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-
-	w.WriteHeader(200)
-	w.Write(resp)
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func GetNetworks(w http.ResponseWriter, r *http.Request) {
-	resp, err := details.GetNetworks()
+// DescribeHost - returns everything known about a host, with its libvirt XML if xml=true
+func DescribeHost(w http.ResponseWriter, r *http.Request) {
 
+	// Get the variables
+	vars := mux.Vars(r)
+	resp, err := details.DescribeHost(vars["name"], r.URL.Query().Get("xml") == "true")
 	if err != nil {
-		w.WriteHeader(400)
-		w.Write([]byte("Error collecting details"))
+		writeError(w, err, fmt.Sprintf("Error describing host %s", vars["name"]))
 		return
 	}
 
-	// Write the application type headers
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-
-	w.WriteHeader(200)
-	w.Write(resp)
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func GetHost(w http.ResponseWriter, r *http.Request) {
+// DescribeNetwork - returns everything known about a network, with its libvirt XML if xml=true
+func DescribeNetwork(w http.ResponseWriter, r *http.Request) {
 
 	// Get the variables
 	vars := mux.Vars(r)
-	resp, err := details.GetHost(vars["host"])
-
+	resp, err := details.DescribeNetwork(vars["name"], r.URL.Query().Get("xml") == "true")
 	if err != nil {
-		w.WriteHeader(400)
-		w.Write([]byte("Error collecting details"))
+		writeError(w, err, fmt.Sprintf("Error describing network %s", vars["name"]))
 		return
 	}
 
-	// Write the application type headers
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-
-	w.WriteHeader(200)
-	w.Write(resp)
+	writeJSON(w, http.StatusOK, resp)
 }
 
-func GetHostIP(w http.ResponseWriter, r *http.Request) {
+// DescribeDeployment - returns everything known about a deployment
+func DescribeDeployment(w http.ResponseWriter, r *http.Request) {
 
 	// Get the variables
 	vars := mux.Vars(r)
-	resp, err := details.GetHostIP(vars["host"])
-
+	resp, err := details.DescribeDeployment(vars["name"])
 	if err != nil {
-		w.WriteHeader(400)
-		w.Write([]byte("Error collecting details"))
+		writeError(w, err, fmt.Sprintf("Error describing deployment %s", vars["name"]))
 		return
 	}
 
-	// Write the application type headers
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Resolve - looks up a name on the vngen network serving it
+func Resolve(w http.ResponseWriter, r *http.Request) {
+
+	// Get the variables
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	resp, err := details.Resolve(vars["name"], query.Get("type"), query.Get("network"))
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Error resolving %s", vars["name"]))
+		return
+	}
 
-	w.WriteHeader(200)
-	w.Write(resp)
+	writeJSON(w, http.StatusOK, resp)
 }
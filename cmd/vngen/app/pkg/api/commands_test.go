@@ -0,0 +1,26 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nenvoy.com/cmd/vngen/app/pkg/api"
+	"nenvoy.com/pkg/client"
+)
+
+// TestCreateDeploymentContentType - refuses templates that are not JSON or YAML
+func TestCreateDeploymentContentType(t *testing.T) {
+	srv := httptest.NewServer(api.NewRouter(false))
+	defer srv.Close()
+
+	_, err := client.New(srv.URL).CreateDeployment(context.Background(), []byte("<deployment/>"), "application/xml")
+	apiErr, ok := err.(*client.Error)
+	if !ok {
+		t.Fatalf("expected an api error, got %v", err)
+	}
+	if apiErr.Status != http.StatusUnsupportedMediaType || apiErr.Code != "unsupported_media_type" {
+		t.Errorf("unexpected error %d %s", apiErr.Status, apiErr.Code)
+	}
+}
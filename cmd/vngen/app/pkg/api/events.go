@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/events"
+)
+
+// heartbeat - how often an idle stream is written to, so proxies keep it open
+const heartbeat = 15 * time.Second
+
+// Events - streams the changes to hosts, networks, deployments and jobs as server-sent events
+//
+// Events are filtered with ?deployment= and ?kind=, a comma separated list.
+// Clients reconnecting with Last-Event-ID get the recent events they missed.
+func Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeCode(w, errdefs.KindInternal, "Error streaming events", "the connection cannot be streamed to")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := events.Filter{Deployment: query.Get("deployment")}
+	if kinds := query.Get("kind"); kinds != "" {
+		filter.Kinds = strings.Split(kinds, ",")
+	}
+
+	after := uint64(0)
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		id, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			writeCode(w, codeBadRequest, "Error streaming events", fmt.Sprintf("invalid Last-Event-ID %q", lastID))
+			return
+		}
+		after = id
+	}
+
+	sub := events.Subscribe(filter, after)
+	defer events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-sub.C:
+			// The stream fell behind, the client reconnects from the last id
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Kind, data)
+		}
+		flusher.Flush()
+	}
+}
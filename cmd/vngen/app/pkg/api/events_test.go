@@ -0,0 +1,38 @@
+package api_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nenvoy.com/cmd/vngen/app/pkg/api"
+	"nenvoy.com/pkg/client"
+	"nenvoy.com/pkg/events"
+)
+
+// TestEvents - streams events to the client, filtered by deployment
+func TestEvents(t *testing.T) {
+	srv := httptest.NewServer(api.NewRouter(false))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.New(srv.URL).Events(ctx, client.EventOptions{Deployment: "lab"})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer stream.Close()
+
+	events.Publish(events.Event{Kind: events.KindHost, Name: "db1", Deployment: "prod", Action: "started"})
+	events.Publish(events.Event{Kind: events.KindHost, Name: "web1", Deployment: "lab", Action: "started"})
+
+	e, err := stream.Next()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if e.Name != "web1" || e.Action != "started" || e.Deployment != "lab" {
+		t.Errorf("unexpected event %+v", e)
+	}
+}
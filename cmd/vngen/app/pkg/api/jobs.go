@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"nenvoy.com/cmd/vngen/app/pkg/actions"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/job"
+)
+
+// runJob - starts the action on the named deployment in the background and answers with its job
+func runJob(w http.ResponseWriter, r *http.Request, action string) {
+	// Get the variables
+	name := mux.Vars(r)["name"]
+
+	// Check the deployment exists and may be managed first so a missing one is a 404
+	err := authorise(r, name)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to %s deployment %s", action, name))
+		return
+	}
+
+	j, err := job.Run(action, name, requestToken(r).User, func(ctx context.Context, tracker *job.Tracker) error {
+		return actions.RunDeployment(ctx, action, name, tracker)
+	})
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to %s deployment %s", action, name))
+		return
+	}
+
+	writeJob(w, j)
+}
+
+// writeJob - answers that the job was accepted, and where to follow it
+func writeJob(w http.ResponseWriter, j job.Job) {
+	w.Header().Set("Location", fmt.Sprintf("%s/jobs/%d", Prefix, j.ID))
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// GetJob - returns the status, progress and logs of a job
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	id, err := jobID(r)
+	if err != nil {
+		writeError(w, err, "Error collecting job")
+		return
+	}
+
+	j, err := job.GetJob(id)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Error collecting job %d", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, j)
+}
+
+// CancelJob - asks a running job to stop at its next step
+func CancelJob(w http.ResponseWriter, r *http.Request) {
+	id, err := jobID(r)
+	if err != nil {
+		writeError(w, err, "Failed to cancel job")
+		return
+	}
+
+	// Jobs are cancelled by whoever could manage what they run on
+	j, err := job.GetJob(id)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to cancel job %d", id))
+		return
+	}
+	if !requestToken(r).CanManage(j.Owner) {
+		writeError(w, errdefs.Forbiddenf("job %d was not started by %s", id, requestToken(r).User), fmt.Sprintf("Failed to cancel job %d", id))
+		return
+	}
+
+	j, err = job.Cancel(id)
+	if err != nil {
+		writeError(w, err, fmt.Sprintf("Failed to cancel job %d", id))
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// jobID - returns the id of the job in the path
+func jobID(r *http.Request) (id uint, err error) {
+	n, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		return 0, errdefs.Invalidf("invalid job id %q", mux.Vars(r)["id"])
+	}
+
+	return uint(n), nil
+}
@@ -0,0 +1,2252 @@
+package api
+
+import (
+	"net/http"
+)
+
+// SpecPath - the path the OpenAPI document is served on
+const SpecPath = "/api/openapi.json"
+
+// Spec - returns the OpenAPI 3 document describing every route of the api
+func Spec() []byte {
+	return []byte(openAPISpec)
+}
+
+// OpenAPI - serves the OpenAPI document
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	// Write the application type headers
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(Spec())
+}
+
+// openAPISpec - kept in step with NewRouter and the response types by TestSpec
+const openAPISpec = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "vngen",
+    "description": "Builds and manages virtual networks of QEMU/KVM hosts",
+    "version": "1"
+  },
+  "paths": {
+    "/api/openapi.json": {
+      "get": {
+        "operationId": "getOpenAPI",
+        "summary": "Returns this document",
+        "tags": [
+          "meta"
+        ],
+        "responses": {
+          "200": {
+            "description": "The OpenAPI document",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object"
+                }
+              }
+            }
+          }
+        },
+        "security": []
+      }
+    },
+    "/api/v1/build": {
+      "post": {
+        "operationId": "build",
+        "summary": "Builds a deployment from a template, the same as POST /api/v1/deployments",
+        "tags": [
+          "deployments"
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/Template"
+              }
+            },
+            "application/yaml": {
+              "schema": {
+                "$ref": "#/components/schemas/Template"
+              }
+            }
+          }
+        },
+        "responses": {
+          "202": {
+            "description": "The build was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "The template could not be read",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "415": {
+            "description": "The template is not JSON or YAML",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/build": {
+      "put": {
+        "operationId": "legacyBuild",
+        "summary": "Builds a deployment from a template, served for clients from before /api/v1",
+        "tags": [
+          "deployments"
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/Template"
+              }
+            },
+            "application/yaml": {
+              "schema": {
+                "$ref": "#/components/schemas/Template"
+              }
+            }
+          }
+        },
+        "responses": {
+          "202": {
+            "description": "The build was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "The template could not be read",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "415": {
+            "description": "The template is not JSON or YAML",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/deployments": {
+      "get": {
+        "operationId": "getDeployments",
+        "summary": "Returns every deployment with its hosts and networks",
+        "tags": [
+          "deployments"
+        ],
+        "responses": {
+          "200": {
+            "description": "Every deployment",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/DeploymentDetails"
+                  }
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      },
+      "post": {
+        "operationId": "createDeployment",
+        "summary": "Builds a deployment from a JSON or YAML template, chosen by the Content-Type",
+        "tags": [
+          "deployments"
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/Template"
+              }
+            },
+            "application/yaml": {
+              "schema": {
+                "$ref": "#/components/schemas/Template"
+              }
+            }
+          }
+        },
+        "responses": {
+          "202": {
+            "description": "The build was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "The template could not be read",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "415": {
+            "description": "The template is not JSON or YAML",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/deployments/{name}": {
+      "get": {
+        "operationId": "getDeployment",
+        "summary": "Returns a deployment with its hosts and networks",
+        "tags": [
+          "deployments"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The deployment with its hosts and networks",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/DeploymentDetails"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      },
+      "delete": {
+        "operationId": "destroyDeployment",
+        "summary": "Destroys a deployment with its hosts and networks in the background",
+        "tags": [
+          "deployments"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "202": {
+            "description": "The job was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/deployments/{name}/start": {
+      "post": {
+        "operationId": "startDeployment",
+        "summary": "Starts every host of a deployment in the background",
+        "tags": [
+          "deployments"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "202": {
+            "description": "The job was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/deployments/{name}/stop": {
+      "post": {
+        "operationId": "stopDeployment",
+        "summary": "Stops every host of a deployment in the background",
+        "tags": [
+          "deployments"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "202": {
+            "description": "The job was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/deployments/{name}/restart": {
+      "post": {
+        "operationId": "restartDeployment",
+        "summary": "Restarts every host of a deployment in the background",
+        "tags": [
+          "deployments"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "202": {
+            "description": "The job was started, follow it at the Location",
+            "headers": {
+              "Location": {
+                "description": "The path of the job",
+                "schema": {
+                  "type": "string"
+                }
+              }
+            },
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/deployments/{name}/describe": {
+      "get": {
+        "operationId": "describeDeployment",
+        "summary": "Returns a deployment with the recent events of it, its hosts, networks and jobs",
+        "tags": [
+          "deployments"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The deployment with its recent events",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/DeploymentDescription"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts/{name}/describe": {
+      "get": {
+        "operationId": "describeHost",
+        "summary": "Returns a host with its disks, interfaces, networks and recent events",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "xml",
+            "in": "query",
+            "description": "Adds the libvirt XML",
+            "schema": {
+              "type": "boolean"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host with its recent events",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/HostDescription"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/networks/{name}/describe": {
+      "get": {
+        "operationId": "describeNetwork",
+        "summary": "Returns a network with the hosts on it and its recent events",
+        "tags": [
+          "networks"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "xml",
+            "in": "query",
+            "description": "Adds the libvirt XML",
+            "schema": {
+              "type": "boolean"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The network with its recent events",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/NetworkDescription"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/jobs/{id}": {
+      "get": {
+        "operationId": "getJob",
+        "summary": "Returns the status, progress and logs of a job",
+        "tags": [
+          "jobs"
+        ],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The job",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/jobs/{id}/cancel": {
+      "post": {
+        "operationId": "cancelJob",
+        "summary": "Asks a running job to stop at its next step",
+        "tags": [
+          "jobs"
+        ],
+        "parameters": [
+          {
+            "name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer"
+            }
+          }
+        ],
+        "responses": {
+          "202": {
+            "description": "The job, cancelling until it stops",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Job"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "409": {
+            "$ref": "#/components/responses/Conflict"
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts": {
+      "get": {
+        "operationId": "getHosts",
+        "summary": "Returns every host",
+        "tags": [
+          "hosts"
+        ],
+        "responses": {
+          "200": {
+            "description": "Every host",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/HostDetails"
+                  }
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts/{name}": {
+      "get": {
+        "operationId": "getHost",
+        "summary": "Returns a host",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/HostDetails"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      },
+      "delete": {
+        "operationId": "destroyHost",
+        "summary": "Destroys a host",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host the action was run on",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ActionResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts/{name}/ipv4": {
+      "get": {
+        "operationId": "getHostIPs",
+        "summary": "Returns the addresses of a host's interfaces",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host's interfaces",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/InterfaceAddresses"
+                  }
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts/{name}/start": {
+      "post": {
+        "operationId": "startHost",
+        "summary": "Starts a host",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host the action was run on",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ActionResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts/{name}/stop": {
+      "post": {
+        "operationId": "stopHost",
+        "summary": "Stops a host",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host the action was run on",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ActionResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/hosts/{name}/restart": {
+      "post": {
+        "operationId": "restartHost",
+        "summary": "Restarts a host",
+        "tags": [
+          "hosts"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The host the action was run on",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ActionResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/networks": {
+      "get": {
+        "operationId": "getNetworks",
+        "summary": "Returns every network",
+        "tags": [
+          "networks"
+        ],
+        "responses": {
+          "200": {
+            "description": "Every network",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/NetworkDetails"
+                  }
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/capture/{target}": {
+      "get": {
+        "operationId": "capture",
+        "summary": "Streams a packet capture of a network or host:iface",
+        "tags": [
+          "networks"
+        ],
+        "parameters": [
+          {
+            "name": "target",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "filter",
+            "in": "query",
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "format",
+            "in": "query",
+            "schema": {
+              "type": "string",
+              "enum": [
+                "pcap",
+                "pcapng"
+              ]
+            }
+          },
+          {
+            "name": "count",
+            "in": "query",
+            "schema": {
+              "type": "integer"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The captured packets until the client disconnects",
+            "content": {
+              "application/vnd.tcpdump.pcap": {
+                "schema": {
+                  "type": "string",
+                  "format": "binary"
+                }
+              },
+              "application/x-pcapng": {
+                "schema": {
+                  "type": "string",
+                  "format": "binary"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/events": {
+      "get": {
+        "operationId": "events",
+        "summary": "Streams the changes to hosts, networks, deployments and jobs as server-sent events",
+        "tags": [
+          "events"
+        ],
+        "parameters": [
+          {
+            "name": "deployment",
+            "in": "query",
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "kind",
+            "in": "query",
+            "description": "A comma separated list of host, network, deployment and job",
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "Last-Event-ID",
+            "in": "header",
+            "description": "Replays the recent events after the id",
+            "schema": {
+              "type": "integer"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "Each event as id, event set to its kind, and data holding the Event as JSON, until the client disconnects",
+            "content": {
+              "text/event-stream": {
+                "schema": {
+                  "$ref": "#/components/schemas/Event"
+                }
+              }
+            }
+          },
+          "400": {
+            "description": "The Last-Event-ID is invalid",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    },
+    "/api/v1/resolve/{name}": {
+      "get": {
+        "operationId": "resolve",
+        "summary": "Resolves a name on the network serving it",
+        "tags": [
+          "networks"
+        ],
+        "parameters": [
+          {
+            "name": "name",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "string"
+            }
+          },
+          {
+            "name": "type",
+            "in": "query",
+            "schema": {
+              "type": "string",
+              "enum": [
+                "A",
+                "AAAA",
+                "CNAME",
+                "SRV"
+              ]
+            }
+          },
+          {
+            "name": "network",
+            "in": "query",
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The answers",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ResolveDetails"
+                }
+              }
+            }
+          },
+          "401": {
+            "$ref": "#/components/responses/Unauthorized"
+          },
+          "403": {
+            "$ref": "#/components/responses/Forbidden"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "422": {
+            "$ref": "#/components/responses/Invalid"
+          },
+          "500": {
+            "$ref": "#/components/responses/Internal"
+          }
+        }
+      }
+    }
+  },
+  "security": [
+    {
+      "bearerAuth": []
+    }
+  ],
+  "components": {
+    "securitySchemes": {
+      "bearerAuth": {
+        "type": "http",
+        "scheme": "bearer",
+        "description": "An api token created with vngen token create"
+      }
+    },
+    "responses": {
+      "Unauthorized": {
+        "description": "No valid api token was sent",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "Forbidden": {
+        "description": "The token's role or user does not allow the request",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "NotFound": {
+        "description": "The object does not exist",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "Conflict": {
+        "description": "The object already exists or is in use by another job",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "Invalid": {
+        "description": "The request is invalid",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "Internal": {
+        "description": "The server failed",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      }
+    },
+    "schemas": {
+      "ErrorResponse": {
+        "type": "object",
+        "properties": {
+          "code": {
+            "type": "string",
+            "enum": [
+              "bad_request",
+              "unauthorized",
+              "forbidden",
+              "not_found",
+              "conflict",
+              "invalid",
+              "unsupported_media_type",
+              "internal",
+              "method_not_allowed"
+            ]
+          },
+          "message": {
+            "type": "string"
+          },
+          "details": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "code",
+          "message"
+        ]
+      },
+      "Job": {
+        "type": "object",
+        "properties": {
+          "ID": {
+            "type": "integer"
+          },
+          "CreatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "UpdatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "DeletedAt": {
+            "type": "string",
+            "format": "date-time",
+            "nullable": true
+          },
+          "Kind": {
+            "type": "string",
+            "enum": [
+              "build",
+              "start",
+              "stop",
+              "restart",
+              "destroy"
+            ]
+          },
+          "Target": {
+            "type": "string"
+          },
+          "Owner": {
+            "type": "string"
+          },
+          "Status": {
+            "type": "string",
+            "enum": [
+              "pending",
+              "running",
+              "cancelling",
+              "succeeded",
+              "failed",
+              "cancelled"
+            ]
+          },
+          "Progress": {
+            "type": "integer",
+            "minimum": 0,
+            "maximum": 100
+          },
+          "Logs": {
+            "type": "string"
+          },
+          "Error": {
+            "type": "string"
+          },
+          "FinishedAt": {
+            "type": "string",
+            "format": "date-time",
+            "nullable": true
+          }
+        }
+      },
+      "Event": {
+        "type": "object",
+        "properties": {
+          "id": {
+            "type": "integer"
+          },
+          "time": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "kind": {
+            "type": "string",
+            "enum": [
+              "host",
+              "network",
+              "deployment",
+              "job"
+            ]
+          },
+          "name": {
+            "type": "string"
+          },
+          "deployment": {
+            "type": "string"
+          },
+          "action": {
+            "type": "string"
+          },
+          "detail": {
+            "type": "string"
+          }
+        },
+        "required": [
+          "id",
+          "time",
+          "kind",
+          "name",
+          "action"
+        ]
+      },
+      "ActionResponse": {
+        "type": "object",
+        "properties": {
+          "kind": {
+            "type": "string",
+            "enum": [
+              "host"
+            ]
+          },
+          "name": {
+            "type": "string"
+          },
+          "action": {
+            "type": "string",
+            "enum": [
+              "start",
+              "stop",
+              "restart",
+              "destroy"
+            ]
+          },
+          "object": {
+            "description": "The host after the action, left out on destroy",
+            "allOf": [
+              {
+                "$ref": "#/components/schemas/HostDetails"
+              }
+            ]
+          }
+        },
+        "required": [
+          "kind",
+          "name",
+          "action"
+        ]
+      },
+      "HostDetails": {
+        "type": "object",
+        "properties": {
+          "Name": {
+            "type": "string"
+          },
+          "Image": {
+            "type": "string"
+          },
+          "State": {
+            "type": "string"
+          },
+          "RAM": {
+            "type": "integer"
+          },
+          "CPUs": {
+            "type": "integer"
+          },
+          "Username": {
+            "type": "string"
+          },
+          "HDSpace": {
+            "type": "string"
+          },
+          "Deployment": {
+            "type": "string"
+          }
+        }
+      },
+      "InterfaceAddresses": {
+        "type": "object",
+        "properties": {
+          "Name": {
+            "type": "string"
+          },
+          "MacAddress": {
+            "type": "string"
+          },
+          "IPv4": {
+            "type": "string"
+          },
+          "IPv6": {
+            "type": "string"
+          }
+        }
+      },
+      "DeploymentDetails": {
+        "type": "object",
+        "properties": {
+          "Name": {
+            "type": "string"
+          },
+          "Owner": {
+            "type": "string"
+          },
+          "State": {
+            "type": "string",
+            "enum": [
+              "running",
+              "off",
+              "partial",
+              "empty"
+            ],
+            "description": "running or off when every host is, partial when they differ, empty without hosts"
+          },
+          "CreatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "Hosts": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/HostDetails"
+            }
+          },
+          "Networks": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/NetworkDetails"
+            }
+          }
+        }
+      },
+      "DiskDetails": {
+        "type": "object",
+        "properties": {
+          "Device": {
+            "type": "string"
+          },
+          "File": {
+            "type": "string"
+          },
+          "Format": {
+            "type": "string"
+          },
+          "BackingImage": {
+            "type": "string",
+            "description": "The image the disk is an overlay of, empty for the cloud-init seed"
+          }
+        }
+      },
+      "InterfaceDetails": {
+        "type": "object",
+        "properties": {
+          "Index": {
+            "type": "integer"
+          },
+          "Type": {
+            "type": "string",
+            "enum": [
+              "network",
+              "udp"
+            ]
+          },
+          "Network": {
+            "type": "string"
+          },
+          "Name": {
+            "type": "string",
+            "description": "The name given inside the guest"
+          },
+          "Device": {
+            "type": "string",
+            "description": "The tap device, while the host runs"
+          },
+          "MacAddress": {
+            "type": "string"
+          },
+          "Address": {
+            "type": "string",
+            "description": "The static address configured inside the guest"
+          },
+          "IPv4": {
+            "type": "string"
+          },
+          "IPv6": {
+            "type": "string"
+          }
+        }
+      },
+      "ResolveDetails": {
+        "type": "object",
+        "properties": {
+          "Name": {
+            "type": "string"
+          },
+          "Type": {
+            "type": "string"
+          },
+          "Answers": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          }
+        }
+      },
+      "DNSRecord": {
+        "type": "object",
+        "properties": {
+          "name": {
+            "type": "string"
+          },
+          "type": {
+            "type": "string"
+          },
+          "value": {
+            "type": "string"
+          },
+          "protocol": {
+            "type": "string"
+          },
+          "port": {
+            "type": "integer"
+          },
+          "priority": {
+            "type": "integer"
+          },
+          "weight": {
+            "type": "integer"
+          }
+        }
+      },
+      "Network": {
+        "type": "object",
+        "properties": {
+          "ID": {
+            "type": "integer"
+          },
+          "CreatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "UpdatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "DeletedAt": {
+            "type": "string",
+            "format": "date-time",
+            "nullable": true
+          },
+          "Name": {
+            "type": "string"
+          },
+          "IP": {
+            "type": "string"
+          },
+          "DHCPLower": {
+            "type": "string"
+          },
+          "DHCPUpper": {
+            "type": "string"
+          },
+          "Netmask": {
+            "type": "string"
+          },
+          "Type": {
+            "type": "string"
+          },
+          "HostBridge": {
+            "type": "string"
+          },
+          "HostDev": {
+            "type": "string"
+          },
+          "MacvtapMode": {
+            "type": "string"
+          },
+          "IPv6": {
+            "type": "string"
+          },
+          "IPv6Prefix": {
+            "type": "integer"
+          },
+          "IPv6Mode": {
+            "type": "string"
+          },
+          "IPv6DHCPLower": {
+            "type": "string"
+          },
+          "IPv6DHCPUpper": {
+            "type": "string"
+          },
+          "MTU": {
+            "type": "integer"
+          },
+          "STP": {
+            "type": "string"
+          },
+          "Delay": {
+            "type": "integer"
+          },
+          "BridgeName": {
+            "type": "string"
+          },
+          "NATPortStart": {
+            "type": "integer"
+          },
+          "NATPortEnd": {
+            "type": "integer"
+          },
+          "Domain": {
+            "type": "string"
+          },
+          "Records": {
+            "type": "array",
+            "nullable": true,
+            "items": {
+              "$ref": "#/components/schemas/DNSRecord"
+            }
+          },
+          "DeploymentID": {
+            "type": "integer"
+          }
+        }
+      },
+      "Template": {
+        "type": "object",
+        "description": "A deployment template, the YAML template described in the README, or its JSON form",
+        "properties": {
+          "deployment": {
+            "type": "object",
+            "properties": {
+              "name": {
+                "type": "string"
+              }
+            },
+            "required": [
+              "name"
+            ]
+          },
+          "ipam": {
+            "type": "object"
+          },
+          "dns": {
+            "type": "object"
+          },
+          "networks": {
+            "type": "array",
+            "items": {
+              "type": "object"
+            }
+          },
+          "links": {
+            "type": "array",
+            "items": {}
+          },
+          "hosts": {
+            "type": "array",
+            "items": {
+              "type": "object"
+            }
+          }
+        },
+        "required": [
+          "deployment"
+        ]
+      },
+      "NetworkDetails": {
+        "type": "object",
+        "properties": {
+          "ID": {
+            "type": "integer"
+          },
+          "CreatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "UpdatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "DeletedAt": {
+            "type": "string",
+            "format": "date-time",
+            "nullable": true
+          },
+          "Name": {
+            "type": "string"
+          },
+          "IP": {
+            "type": "string"
+          },
+          "DHCPLower": {
+            "type": "string"
+          },
+          "DHCPUpper": {
+            "type": "string"
+          },
+          "Netmask": {
+            "type": "string"
+          },
+          "Type": {
+            "type": "string"
+          },
+          "HostBridge": {
+            "type": "string"
+          },
+          "HostDev": {
+            "type": "string"
+          },
+          "MacvtapMode": {
+            "type": "string"
+          },
+          "IPv6": {
+            "type": "string"
+          },
+          "IPv6Prefix": {
+            "type": "integer"
+          },
+          "IPv6Mode": {
+            "type": "string"
+          },
+          "IPv6DHCPLower": {
+            "type": "string"
+          },
+          "IPv6DHCPUpper": {
+            "type": "string"
+          },
+          "MTU": {
+            "type": "integer"
+          },
+          "STP": {
+            "type": "string"
+          },
+          "Delay": {
+            "type": "integer"
+          },
+          "BridgeName": {
+            "type": "string"
+          },
+          "NATPortStart": {
+            "type": "integer"
+          },
+          "NATPortEnd": {
+            "type": "integer"
+          },
+          "Domain": {
+            "type": "string"
+          },
+          "Records": {
+            "type": "array",
+            "nullable": true,
+            "items": {
+              "$ref": "#/components/schemas/DNSRecord"
+            }
+          },
+          "DeploymentID": {
+            "type": "integer"
+          },
+          "State": {
+            "type": "string",
+            "enum": [
+              "active",
+              "inactive"
+            ],
+            "description": "Whether libvirt is running the network"
+          },
+          "Deployment": {
+            "type": "string"
+          }
+        }
+      },
+      "HostDescription": {
+        "type": "object",
+        "properties": {
+          "Name": {
+            "type": "string"
+          },
+          "Image": {
+            "type": "string"
+          },
+          "State": {
+            "type": "string"
+          },
+          "RAM": {
+            "type": "integer"
+          },
+          "CPUs": {
+            "type": "integer"
+          },
+          "Username": {
+            "type": "string"
+          },
+          "HDSpace": {
+            "type": "string"
+          },
+          "Deployment": {
+            "type": "string"
+          },
+          "Role": {
+            "type": "string"
+          },
+          "Disks": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/DiskDetails"
+            }
+          },
+          "Interfaces": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/InterfaceDetails"
+            }
+          },
+          "Networks": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          },
+          "XML": {
+            "type": "string",
+            "description": "The libvirt XML, only with xml=true"
+          },
+          "Events": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Event"
+            }
+          }
+        }
+      },
+      "NetworkDescription": {
+        "type": "object",
+        "properties": {
+          "ID": {
+            "type": "integer"
+          },
+          "CreatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "UpdatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "DeletedAt": {
+            "type": "string",
+            "format": "date-time",
+            "nullable": true
+          },
+          "Name": {
+            "type": "string"
+          },
+          "IP": {
+            "type": "string"
+          },
+          "DHCPLower": {
+            "type": "string"
+          },
+          "DHCPUpper": {
+            "type": "string"
+          },
+          "Netmask": {
+            "type": "string"
+          },
+          "Type": {
+            "type": "string"
+          },
+          "HostBridge": {
+            "type": "string"
+          },
+          "HostDev": {
+            "type": "string"
+          },
+          "MacvtapMode": {
+            "type": "string"
+          },
+          "IPv6": {
+            "type": "string"
+          },
+          "IPv6Prefix": {
+            "type": "integer"
+          },
+          "IPv6Mode": {
+            "type": "string"
+          },
+          "IPv6DHCPLower": {
+            "type": "string"
+          },
+          "IPv6DHCPUpper": {
+            "type": "string"
+          },
+          "MTU": {
+            "type": "integer"
+          },
+          "STP": {
+            "type": "string"
+          },
+          "Delay": {
+            "type": "integer"
+          },
+          "BridgeName": {
+            "type": "string"
+          },
+          "NATPortStart": {
+            "type": "integer"
+          },
+          "NATPortEnd": {
+            "type": "integer"
+          },
+          "Domain": {
+            "type": "string"
+          },
+          "Records": {
+            "type": "array",
+            "nullable": true,
+            "items": {
+              "$ref": "#/components/schemas/DNSRecord"
+            }
+          },
+          "DeploymentID": {
+            "type": "integer"
+          },
+          "State": {
+            "type": "string",
+            "enum": [
+              "active",
+              "inactive"
+            ],
+            "description": "Whether libvirt is running the network"
+          },
+          "Deployment": {
+            "type": "string"
+          },
+          "Hosts": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            },
+            "description": "The hosts with an interface on the network"
+          },
+          "XML": {
+            "type": "string",
+            "description": "The libvirt XML, only with xml=true"
+          },
+          "Events": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Event"
+            }
+          }
+        }
+      },
+      "DeploymentDescription": {
+        "type": "object",
+        "properties": {
+          "Name": {
+            "type": "string"
+          },
+          "Owner": {
+            "type": "string"
+          },
+          "State": {
+            "type": "string",
+            "enum": [
+              "running",
+              "off",
+              "partial",
+              "empty"
+            ],
+            "description": "running or off when every host is, partial when they differ, empty without hosts"
+          },
+          "CreatedAt": {
+            "type": "string",
+            "format": "date-time"
+          },
+          "Hosts": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/HostDetails"
+            }
+          },
+          "Networks": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/NetworkDetails"
+            }
+          },
+          "Events": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Event"
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,204 @@
+package api_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"nenvoy.com/cmd/vngen/app/pkg/api"
+	"nenvoy.com/cmd/vngen/app/pkg/details"
+	"nenvoy.com/pkg/client"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/events"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/job"
+	"nenvoy.com/pkg/network"
+)
+
+// spec - the parts of the OpenAPI document checked against the server
+type spec struct {
+	Paths      map[string]map[string]operation `json:"paths"`
+	Components struct {
+		Responses map[string]json.RawMessage `json:"responses"`
+		Schemas   map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+// operation - the parameters and responses of a route
+type operation struct {
+	Parameters []struct {
+		Name string `json:"name"`
+		In   string `json:"in"`
+	} `json:"parameters"`
+	Responses map[string]struct {
+		Ref string `json:"$ref"`
+	} `json:"responses"`
+}
+
+// pathParameter - matches the parameters of a path template
+var pathParameter = regexp.MustCompile(`{([^}]+)}`)
+
+// TestSpec - checks the document describes every route and response type of the server
+func TestSpec(t *testing.T) {
+	doc := spec{}
+	err := json.Unmarshal(api.Spec(), &doc)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// Every route of the router is documented, and nothing else
+	routes := map[string]bool{}
+	err = api.NewRouter(true).Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Prefixes of subrouters have no methods
+			return nil
+		}
+		for _, method := range methods {
+			routes[strings.ToLower(method)+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	documented := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented[method+" "+path] = true
+		}
+	}
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("route %s is not in the spec", route)
+		}
+	}
+	for route := range documented {
+		if !routes[route] {
+			t.Errorf("spec has %s, which the router does not serve", route)
+		}
+	}
+
+	// Operations document their path parameters and the errors every route can return
+	for path, ops := range doc.Paths {
+		templated := map[string]bool{}
+		for _, match := range pathParameter.FindAllStringSubmatch(path, -1) {
+			templated[match[1]] = true
+		}
+
+		for method, op := range ops {
+			route := method + " " + path
+
+			params := map[string]bool{}
+			for _, param := range op.Parameters {
+				if param.In != "path" {
+					continue
+				}
+				params[param.Name] = true
+				if !templated[param.Name] {
+					t.Errorf("%s has path parameter %s, which is not in its path", route, param.Name)
+				}
+			}
+			for name := range templated {
+				if !params[name] {
+					t.Errorf("%s does not document its path parameter %s", route, name)
+				}
+			}
+
+			codes := []string{}
+			if strings.HasPrefix(path, "/api/v1/") {
+				codes = append(codes, "401", "403", "500")
+			}
+			if len(templated) > 0 {
+				codes = append(codes, "404")
+			}
+			for _, code := range codes {
+				if _, ok := op.Responses[code]; !ok {
+					t.Errorf("%s does not document a %s response", route, code)
+				}
+			}
+
+			for code, resp := range op.Responses {
+				if resp.Ref == "" {
+					continue
+				}
+				if _, ok := doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]; !ok {
+					t.Errorf("%s response %s refers to %s, which is not in the spec", route, code, resp.Ref)
+				}
+			}
+		}
+	}
+
+	// Schemas match the types the server marshals and the client decodes
+	types := map[string][]interface{}{
+		"ErrorResponse":         {api.ErrorResponse{}, client.Error{}},
+		"ActionResponse":        {api.ActionResponse{}, client.ActionResponse{}},
+		"HostDetails":           {details.HostDetails{}, client.HostDetails{}},
+		"DeploymentDetails":     {details.DeploymentDetails{}, client.DeploymentDetails{}},
+		"ResolveDetails":        {details.ResolveDetails{}, client.ResolveDetails{}},
+		"InterfaceAddresses":    {host.NetworkDetails{}, client.InterfaceAddresses{}},
+		"Network":               {network.Network{}, client.Network{}},
+		"NetworkDetails":        {details.NetworkDetails{}, client.NetworkDetails{}},
+		"DNSRecord":             {structs.DNSRecordDefinition{}},
+		"Job":                   {job.Job{}, client.Job{}},
+		"Event":                 {events.Event{}, client.Event{}},
+		"DiskDetails":           {host.DiskDetails{}, client.DiskDetails{}},
+		"InterfaceDetails":      {details.InterfaceDetails{}, client.InterfaceDetails{}},
+		"HostDescription":       {details.HostDescription{}, client.HostDescription{}},
+		"NetworkDescription":    {details.NetworkDescription{}, client.NetworkDescription{}},
+		"DeploymentDescription": {details.DeploymentDescription{}, client.DeploymentDescription{}},
+	}
+	for name, values := range types {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is not in the spec", name)
+			continue
+		}
+		properties := []string{}
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+
+		for _, v := range values {
+			fields := jsonFields(reflect.TypeOf(v))
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, properties) {
+				t.Errorf("schema %s has %v, %T has %v", name, properties, v, fields)
+			}
+		}
+	}
+}
+
+// jsonFields - returns the names of the fields the type is marshalled with
+func jsonFields(typ reflect.Type) (fields []string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		fields = append(fields, tag)
+	}
+
+	return fields
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/utils/handle"
+)
+
+// ErrorResponse - the body of every failed request
+type ErrorResponse struct {
+	// Code - the kind of error, unauthorized, forbidden, not_found, conflict, invalid, bad_request, unsupported_media_type or internal
+	Code string `json:"code"`
+	// Message - what the request failed to do
+	Message string `json:"message"`
+	// Details - the underlying error
+	Details string `json:"details,omitempty"`
+}
+
+// ActionResponse - the body of a successful start, stop, restart or destroy
+type ActionResponse struct {
+	Kind   string      `json:"kind"`
+	Name   string      `json:"name"`
+	Action string      `json:"action"`
+	Object interface{} `json:"object,omitempty"`
+}
+
+// codeBadRequest - the code of requests that could not be read at all
+const codeBadRequest = "bad_request"
+
+// codeUnsupportedMediaType - the code of request bodies sent in a format the route does not read
+const codeUnsupportedMediaType = "unsupported_media_type"
+
+// statuses - the http status of each kind of error
+var statuses = map[string]int{
+	errdefs.KindUnauthorized: http.StatusUnauthorized,
+	errdefs.KindForbidden:    http.StatusForbidden,
+	errdefs.KindNotFound:     http.StatusNotFound,
+	errdefs.KindConflict:     http.StatusConflict,
+	errdefs.KindInvalid:      http.StatusUnprocessableEntity,
+	errdefs.KindInternal:     http.StatusInternalServerError,
+	codeBadRequest:           http.StatusBadRequest,
+	codeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+}
+
+// writeJSON - writes the object as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	// Write the application type headers
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	w.WriteHeader(status)
+	handle.Error(json.NewEncoder(w).Encode(v))
+}
+
+// writeError - writes the error with the status of its kind
+func writeError(w http.ResponseWriter, err error, message string) {
+	handle.Error(err)
+	writeCode(w, errdefs.Kind(err), message, err.Error())
+}
+
+// writeCode - writes an error body with the code's status
+func writeCode(w http.ResponseWriter, code string, message string, details string) {
+	writeJSON(w, statuses[code], ErrorResponse{Code: code, Message: message, Details: details})
+}
+
+// notFound - answers requests for routes that do not exist
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeCode(w, errdefs.KindNotFound, "Not found", r.Method+" "+r.URL.Path)
+}
+
+// methodNotAllowed - answers requests using the wrong method for the route
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Code: "method_not_allowed", Message: "Method not allowed", Details: r.Method + " " + r.URL.Path})
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"nenvoy.com/pkg/auth"
+)
+
+// Prefix - the path every route of the api is served under
+const Prefix = "/api/v1"
+
+// NewRouter - returns the router serving every route of the api, requiring api tokens when authenticate is set
+//
+// Viewers can read everything, operators can also build deployments and
+// capture traffic, and manage the deployments they own. Admins manage
+// every deployment.
+func NewRouter(authenticate bool) *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(notFound)
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+
+	// Serve the description of every route
+	r.HandleFunc(SpecPath, OpenAPI).Methods("GET")
+
+	// Clients from before the versioned api build with PUT /build
+	r.Handle("/build", authenticator(authenticate)(requireRole(auth.RoleOperator, Build))).Methods("PUT")
+
+	v1 := r.PathPrefix(Prefix).Subrouter()
+	v1.NotFoundHandler = r.NotFoundHandler
+	v1.MethodNotAllowedHandler = r.MethodNotAllowedHandler
+	v1.Use(authenticator(authenticate))
+
+	// Handle the building of the deployment, the same as POST /deployments
+	v1.HandleFunc("/build", requireRole(auth.RoleOperator, Build)).Methods("POST")
+
+	// Handle the deployments and their lifecycle
+	v1.HandleFunc("/deployments", requireRole(auth.RoleViewer, GetDeployments)).Methods("GET")
+	v1.HandleFunc("/deployments", requireRole(auth.RoleOperator, Build)).Methods("POST")
+	v1.HandleFunc("/deployments/{name}", requireRole(auth.RoleViewer, GetDeployment)).Methods("GET")
+	v1.HandleFunc("/deployments/{name}", requireRole(auth.RoleOperator, DestroyDeployment)).Methods("DELETE")
+	v1.HandleFunc("/deployments/{name}/describe", requireRole(auth.RoleViewer, DescribeDeployment)).Methods("GET")
+	v1.HandleFunc("/deployments/{name}/start", requireRole(auth.RoleOperator, StartDeployment)).Methods("POST")
+	v1.HandleFunc("/deployments/{name}/stop", requireRole(auth.RoleOperator, StopDeployment)).Methods("POST")
+	v1.HandleFunc("/deployments/{name}/restart", requireRole(auth.RoleOperator, RestartDeployment)).Methods("POST")
+
+	// Follow and cancel the jobs building, destroying, starting and stopping deployments
+	v1.HandleFunc("/jobs/{id}", requireRole(auth.RoleViewer, GetJob)).Methods("GET")
+	v1.HandleFunc("/jobs/{id}/cancel", requireRole(auth.RoleOperator, CancelJob)).Methods("POST")
+
+	// Handle the hosts and their lifecycle
+	v1.HandleFunc("/hosts", requireRole(auth.RoleViewer, GetHosts)).Methods("GET")
+	v1.HandleFunc("/hosts/{name}", requireRole(auth.RoleViewer, GetHost)).Methods("GET")
+	v1.HandleFunc("/hosts/{name}", requireRole(auth.RoleOperator, DestroyHost)).Methods("DELETE")
+	v1.HandleFunc("/hosts/{name}/ipv4", requireRole(auth.RoleViewer, GetHostIP)).Methods("GET")
+	v1.HandleFunc("/hosts/{name}/describe", requireRole(auth.RoleViewer, DescribeHost)).Methods("GET")
+	v1.HandleFunc("/hosts/{name}/start", requireRole(auth.RoleOperator, StartHost)).Methods("POST")
+	v1.HandleFunc("/hosts/{name}/stop", requireRole(auth.RoleOperator, StopHost)).Methods("POST")
+	v1.HandleFunc("/hosts/{name}/restart", requireRole(auth.RoleOperator, RestartHost)).Methods("POST")
+
+	// Handle the getting of the network details
+	v1.HandleFunc("/networks", requireRole(auth.RoleViewer, GetNetworks)).Methods("GET")
+	v1.HandleFunc("/networks/{name}/describe", requireRole(auth.RoleViewer, DescribeNetwork)).Methods("GET")
+
+	// Stream a packet capture of a network or host interface
+	v1.HandleFunc("/capture/{target}", requireRole(auth.RoleOperator, Capture)).Methods("GET")
+
+	// Stream the changes to hosts, networks, deployments and jobs
+	v1.HandleFunc("/events", requireRole(auth.RoleViewer, Events)).Methods("GET")
+
+	// Resolve a name on the network serving it
+	v1.HandleFunc("/resolve/{name}", requireRole(auth.RoleViewer, Resolve)).Methods("GET")
+
+	return r
+}
@@ -0,0 +1,217 @@
+package details
+
+import (
+	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/events"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/network"
+)
+
+// recentEvents - the number of events a description ends with
+const recentEvents = 10
+
+// InterfaceDetails - an interface of a host, what it is attached to and its addresses
+type InterfaceDetails struct {
+	Index int
+	// Type - network, or udp for the end of a link
+	Type    string
+	Network string
+	// Name - the name given inside the guest, if any
+	Name string
+	// Device - the tap device libvirt backs the interface with while the host runs
+	Device     string
+	MacAddress string
+	// Address - the static address configured inside the guest, if any
+	Address string
+	IPv4    string
+	IPv6    string
+}
+
+// HostDescription - everything known about a host
+type HostDescription struct {
+	HostDetails
+	Role       string
+	Disks      []host.DiskDetails
+	Interfaces []InterfaceDetails
+	Networks   []string
+	// XML - the libvirt XML of the domain, only when asked for
+	XML    string `json:",omitempty"`
+	Events []events.Event
+}
+
+// NetworkDescription - everything known about a network
+type NetworkDescription struct {
+	NetworkDetails
+	// Hosts - the hosts with an interface on the network
+	Hosts []string
+	// XML - the libvirt XML of the network, only when asked for
+	XML    string `json:",omitempty"`
+	Events []events.Event
+}
+
+// DeploymentDescription - everything known about a deployment
+type DeploymentDescription struct {
+	DeploymentDetails
+	Events []events.Event
+}
+
+// DescribeHost - Returns a host's details with its disks, interfaces, recent events and, if asked, its XML
+func DescribeHost(name string, withXML bool) (data HostDescription, err error) {
+	hst, err := getHost(name)
+	if err != nil {
+		return data, err
+	}
+
+	data.HostDetails, err = getHostDetails(hst)
+	if err != nil {
+		return data, err
+	}
+	data.Role = hst.Role
+
+	data.Disks, err = hst.GetDisks()
+	if err != nil {
+		return data, err
+	}
+
+	data.Interfaces, data.Networks, err = getInterfaceDetails(hst, data.State == "running")
+	if err != nil {
+		return data, err
+	}
+
+	if withXML {
+		data.XML, err = hst.GetXML()
+		if err != nil {
+			return data, err
+		}
+	}
+
+	data.Events, err = events.Recent(events.KindHost, name, recentEvents)
+	if err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// DescribeNetwork - Returns a network's details with the hosts on it, recent events and, if asked, its XML
+func DescribeNetwork(name string, withXML bool) (data NetworkDescription, err error) {
+	netwk, err := network.GetNetworkByName(name)
+	if err != nil {
+		return data, err
+	}
+	if netwk.Name == "" {
+		return data, errdefs.NotFoundf("network %s not found", name)
+	}
+
+	dep, err := deployment.GetDeploymentByID(netwk.DeploymentID)
+	if err != nil {
+		return data, err
+	}
+	data.NetworkDetails, err = getNetworkDetails(netwk, dep.Name)
+	if err != nil {
+		return data, err
+	}
+
+	// Only hosts of the same deployment can be attached
+	hosts, err := host.GetHostsByDeployment(netwk.DeploymentID)
+	if err != nil {
+		return data, err
+	}
+	data.Hosts = []string{}
+	for _, hst := range hosts {
+		ifaces, err := hst.GetInterfaces()
+		if err != nil {
+			return data, err
+		}
+		for _, iface := range ifaces {
+			if iface.Type == host.IfaceNetwork && iface.Network == name {
+				data.Hosts = append(data.Hosts, hst.Name)
+				break
+			}
+		}
+	}
+
+	if withXML {
+		data.XML, err = netwk.GetXML()
+		if err != nil {
+			return data, err
+		}
+	}
+
+	data.Events, err = events.Recent(events.KindNetwork, name, recentEvents)
+	if err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// DescribeDeployment - Returns a deployment's details with the recent events of it, its hosts, networks and jobs
+func DescribeDeployment(name string) (data DeploymentDescription, err error) {
+	data.DeploymentDetails, err = GetDeployment(name)
+	if err != nil {
+		return data, err
+	}
+
+	data.Events, err = events.Recent(events.KindDeployment, name, recentEvents)
+	if err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// getInterfaceDetails - returns the host's interfaces with their live addresses, and the networks they attach it to
+func getInterfaceDetails(hst host.Host, running bool) (ifaces []InterfaceDetails, networks []string, err error) {
+	defined, err := hst.GetInterfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Taps and addresses only exist while the host runs, matched by mac
+	taps := map[string]string{}
+	addresses := map[string]host.NetworkDetails{}
+	if running {
+		devices, err := hst.GetTapDevices()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, tap := range devices {
+			taps[tap.MacAddress] = tap.Name
+		}
+
+		live, err := hst.GetHostIfaces()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, iface := range live {
+			addresses[iface.MacAddress] = iface
+		}
+	}
+
+	ifaces = []InterfaceDetails{}
+	networks = []string{}
+	attached := map[string]bool{}
+	for _, iface := range defined {
+		live := addresses[iface.MAC]
+		ifaces = append(ifaces, InterfaceDetails{
+			Index:      iface.Index,
+			Type:       iface.Type,
+			Network:    iface.Network,
+			Name:       iface.Name,
+			Device:     taps[iface.MAC],
+			MacAddress: iface.MAC,
+			Address:    iface.Address,
+			IPv4:       live.IPv4,
+			IPv6:       live.IPv6,
+		})
+
+		if iface.Type == host.IfaceNetwork && !attached[iface.Network] {
+			attached[iface.Network] = true
+			networks = append(networks, iface.Network)
+		}
+	}
+
+	return ifaces, networks, nil
+}
@@ -1,9 +1,12 @@
 package details
 
 import (
-	"encoding/json"
+	"context"
+	"strings"
+	"time"
 
 	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/errdefs"
 
 	"nenvoy.com/pkg/host"
 	"nenvoy.com/pkg/network"
@@ -17,13 +20,30 @@ type HostDetails struct {
 	RAM        int
 	CPUs       int
 	Username   string
-	Password   string
 	HDSpace    string
 	Deployment string
 }
 
+// NetworkDetails - a network, whether libvirt is running it and the deployment it is in
+type NetworkDetails struct {
+	network.Network
+	State      string
+	Deployment string
+}
+
+// DeploymentDetails - the details of a deployment and its hosts and networks
+type DeploymentDetails struct {
+	Name  string
+	Owner string
+	// State - running or off when every host is, partial when some are, empty without hosts
+	State     string
+	CreatedAt time.Time
+	Hosts     []HostDetails
+	Networks  []NetworkDetails
+}
+
 // GetHosts - Return all host details
-func GetHosts() (resp []byte, err error) {
+func GetHosts() (data []HostDetails, err error) {
 
 	// Get all the hosts from the database
 	hosts, err := host.GetHosts()
@@ -31,7 +51,7 @@ func GetHosts() (resp []byte, err error) {
 		return nil, err
 	}
 
-	data := []HostDetails{}
+	data = []HostDetails{}
 
 	for _, host := range hosts {
 		// Get the host details
@@ -43,77 +63,158 @@ func GetHosts() (resp []byte, err error) {
 		data = append(data, details)
 	}
 
-	// put the information into a JSON file
-	resp, err = json.Marshal(data)
+	return data, nil
+}
+
+// GetHost - Return a host's details
+func GetHost(name string) (data HostDetails, err error) {
 
+	// Get the host from the database
+	host, err := getHost(name)
 	if err != nil {
-		return nil, err
+		return data, err
 	}
 
-	return resp, nil
+	// Get the host details
+	return getHostDetails(host)
 }
 
-// GetHost - Return a host's details
-func GetHost(name string) (resp []byte, err error) {
+// HostDeployment - Returns the name of the deployment a host belongs to, without asking libvirt
+func HostDeployment(name string) (depName string, err error) {
+	hst, err := getHost(name)
+	if err != nil {
+		return "", err
+	}
 
-	// Get all the hosts from the database
-	host, err := host.GetHostByName(name)
+	dep, err := deployment.GetDeploymentByID(hst.DeploymentID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	// Get the host details
-	data, err := getHostDetails(host)
+	return dep.Name, nil
+}
 
-	// put the information into a JSON file
-	resp, err = json.Marshal(data)
+// NetworkDeployment - Returns the name of the deployment a network belongs to, without asking libvirt
+func NetworkDeployment(name string) (depName string, err error) {
+	netwk, err := network.GetNetworkByName(name)
+	if err != nil {
+		return "", err
+	}
+	if netwk.Name == "" {
+		return "", errdefs.NotFoundf("network %s not found", name)
+	}
 
+	dep, err := deployment.GetDeploymentByID(netwk.DeploymentID)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	return resp, nil
+	return dep.Name, nil
 }
 
 // GetHostIP - Returns the IP of a host
-func GetHostIP(name string) (resp []byte, err error) {
+func GetHostIP(name string) (ifaces []host.NetworkDetails, err error) {
 
-	// Get all the hosts from the database
-	host, err := host.GetHostByName(name)
+	// Get the host from the database
+	host, err := getHost(name)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get the IP of the host
-	ifaces, err := host.GetHostIfaces()
+	return host.GetHostIfaces()
+}
 
-	// put the information into a JSON file
-	resp, err = json.Marshal(ifaces)
+// GetNetworks - Returns the details of every network
+func GetNetworks() (data []NetworkDetails, err error) {
 
+	// Get all the networks from the database
+	networks, err := network.GetNetworks()
 	if err != nil {
 		return nil, err
 	}
 
-	return resp, nil
-}
+	data = []NetworkDetails{}
+	for _, netwk := range networks {
+		dep, err := deployment.GetDeploymentByID(netwk.DeploymentID)
+		if err != nil {
+			return nil, err
+		}
+
+		details, err := getNetworkDetails(netwk, dep.Name)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, details)
+	}
 
-// GetNetworks - Returns the Network of a host
-func GetNetworks() (resp []byte, err error) {
+	return data, nil
+}
 
-	// Get all the networks from the database
-	networks, err := network.GetNetworks()
+// GetDeployments - Returns the details of every deployment with its hosts and networks
+func GetDeployments() (data []DeploymentDetails, err error) {
+	deps, err := deployment.GetDeployments()
 	if err != nil {
 		return nil, err
 	}
 
-	// put the information into a JSON file
-	resp, err = json.Marshal(networks)
+	data = []DeploymentDetails{}
+	for _, dep := range deps {
+		details, err := getDeploymentDetails(dep)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, details)
+	}
+
+	return data, nil
+}
 
+// GetDeployment - Returns a deployment's details with its hosts and networks
+func GetDeployment(name string) (data DeploymentDetails, err error) {
+	dep, err := deployment.GetDeploymentByName(name)
 	if err != nil {
-		return nil, err
+		return data, err
+	}
+
+	return getDeploymentDetails(dep)
+}
+
+// ResolveDetails - the answers to a dns lookup on a vngen network
+type ResolveDetails struct {
+	Name    string
+	Type    string
+	Answers []string
+}
+
+// Resolve - Returns the answers for a name from the network serving it
+func Resolve(name string, recordType string, networkName string) (data ResolveDetails, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	answers, err := network.Resolve(ctx, name, recordType, networkName)
+	if err != nil {
+		return data, err
+	}
+
+	if recordType == "" {
+		recordType = network.RecordA
 	}
 
-	return resp, nil
+	return ResolveDetails{Name: name, Type: strings.ToUpper(recordType), Answers: answers}, nil
+}
+
+// getHost - returns the host by name, or a not found error
+func getHost(name string) (hst host.Host, err error) {
+	hst, err = host.GetHostByName(name)
+	if err != nil {
+		return hst, err
+	}
+	if hst.Name == "" {
+		return hst, errdefs.NotFoundf("host %s not found", name)
+	}
+
+	return hst, nil
 }
 
 func getHostDetails(host host.Host) (hostDet HostDetails, err error) {
@@ -136,7 +237,6 @@ func getHostDetails(host host.Host) (hostDet HostDetails, err error) {
 		RAM:        host.RAM,
 		CPUs:       host.CPUs,
 		Username:   host.Username,
-		Password:   host.Password,
 		HDSpace:    host.HDSpace,
 		Deployment: dep.Name,
 	}
@@ -144,3 +244,61 @@ func getHostDetails(host host.Host) (hostDet HostDetails, err error) {
 	return hostDet, nil
 
 }
+
+// getDeploymentDetails - collects the live state of the deployment's hosts and networks
+func getDeploymentDetails(dep deployment.Deployment) (data DeploymentDetails, err error) {
+	hosts, err := host.GetHostsByDeployment(dep.ID)
+	if err != nil {
+		return data, err
+	}
+
+	data = DeploymentDetails{Name: dep.Name, Owner: dep.Owner, CreatedAt: dep.CreatedAt, Hosts: []HostDetails{}, Networks: []NetworkDetails{}}
+	for _, hst := range hosts {
+		details, err := getHostDetails(hst)
+		if err != nil {
+			return data, err
+		}
+		data.Hosts = append(data.Hosts, details)
+	}
+	data.State = deploymentState(data.Hosts)
+
+	networks, err := network.GetNetworksByDeployment(dep.ID)
+	if err != nil {
+		return data, err
+	}
+	for _, netwk := range networks {
+		details, err := getNetworkDetails(netwk, dep.Name)
+		if err != nil {
+			return data, err
+		}
+		data.Networks = append(data.Networks, details)
+	}
+
+	return data, nil
+}
+
+// deploymentState - returns the state the hosts share, partial if they differ, or empty without hosts
+func deploymentState(hosts []HostDetails) string {
+	if len(hosts) == 0 {
+		return "empty"
+	}
+
+	state := hosts[0].State
+	for _, hst := range hosts[1:] {
+		if hst.State != state {
+			return "partial"
+		}
+	}
+
+	return state
+}
+
+// getNetworkDetails - collects the live state of the network
+func getNetworkDetails(netwk network.Network, depName string) (data NetworkDetails, err error) {
+	state, err := netwk.GetNetworkState()
+	if err != nil {
+		return data, err
+	}
+
+	return NetworkDetails{Network: netwk, State: state, Deployment: depName}, nil
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/errdefs"
+)
+
+// Roles a token can be given, each allowed everything the ones before it are
+const (
+	// RoleViewer - reads hosts, networks and deployments
+	RoleViewer = "viewer"
+	// RoleOperator - also builds deployments, and manages the ones it owns
+	RoleOperator = "operator"
+	// RoleAdmin - manages every deployment
+	RoleAdmin = "admin"
+)
+
+// tokenPrefix - marks the secrets vngen issues, so they are easy to spot
+const tokenPrefix = "vngen_"
+
+// ranks - the order of the roles
+var ranks = map[string]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// Token - Struct for an api token in the database, which keeps only the hash of its secret
+type Token struct {
+	gorm.Model
+	User string
+	Role string
+	Hash string `gorm:"uniqueIndex" json:"-"`
+}
+
+// ValidRole - reports whether the role exists
+func ValidRole(role string) bool {
+	return ranks[role] != 0
+}
+
+// Allows - reports whether the token's role includes the role
+func (t Token) Allows(role string) bool {
+	return ranks[t.Role] >= ranks[role]
+}
+
+// CanManage - reports whether the token can manage a deployment owned by the user
+//
+// Admins manage every deployment, operators only the ones they built.
+// Deployments built from the command line have no owner, so only admins
+// manage them through the api.
+func (t Token) CanManage(owner string) bool {
+	if t.Allows(RoleAdmin) {
+		return true
+	}
+	return t.Allows(RoleOperator) && owner != "" && owner == t.User
+}
+
+// CreateToken - creates a token for the user, returning the secret which is not stored
+func CreateToken(user string, role string) (tok Token, secret string, err error) {
+	if user == "" {
+		return tok, "", errdefs.Invalidf("user is required")
+	}
+	if !ValidRole(role) {
+		return tok, "", errdefs.Invalidf("unknown role %s, expected viewer, operator or admin", role)
+	}
+
+	db, err := session()
+	if err != nil {
+		return tok, "", err
+	}
+
+	buf := make([]byte, 32)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return tok, "", errors.Wrap(err, "could not generate token")
+	}
+	secret = tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	tok = Token{User: user, Role: role, Hash: HashSecret(secret)}
+	err = db.Create(&tok).Error
+	if err != nil {
+		return tok, "", errors.Wrap(err, "failed to create token")
+	}
+
+	return tok, secret, nil
+}
+
+// GetTokens - returns every token that has not been revoked
+func GetTokens() (toks []Token, err error) {
+	db, err := session()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Order("id").Find(&toks).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get tokens")
+	}
+
+	return toks, nil
+}
+
+// RevokeToken - revokes the token with the id
+func RevokeToken(id uint) (err error) {
+	db, err := session()
+	if err != nil {
+		return err
+	}
+
+	result := db.Delete(&Token{}, id)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "failed to revoke token")
+	}
+	if result.RowsAffected == 0 {
+		return errdefs.NotFoundf("token %d not found", id)
+	}
+
+	return nil
+}
+
+// Authenticate - returns the token of the secret, unless it is unknown or revoked
+func Authenticate(secret string) (tok Token, err error) {
+	if !strings.HasPrefix(secret, tokenPrefix) {
+		return tok, errdefs.Unauthorizedf("invalid token")
+	}
+
+	db, err := session()
+	if err != nil {
+		return tok, err
+	}
+
+	err = db.Where("hash = ?", HashSecret(secret)).First(&tok).Error
+	if err == gorm.ErrRecordNotFound {
+		return tok, errdefs.Unauthorizedf("invalid token")
+	} else if err != nil {
+		return tok, errors.Wrap(err, "failed to find token")
+	}
+
+	return tok, nil
+}
+
+// HashSecret - returns the hash a token's secret is stored as
+//
+// Secrets are long and random, so a fast hash is enough to keep them from
+// being read back out of the database.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// session - returns a database session with the tokens migrated
+func session() (db *gorm.DB, err error) {
+	db, err = database.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&Token{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate database: ")
+	}
+
+	return db, nil
+}
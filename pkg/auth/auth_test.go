@@ -0,0 +1,54 @@
+package auth_test
+
+import (
+	"testing"
+
+	"nenvoy.com/pkg/auth"
+)
+
+// TestRoles
+func TestRoles(t *testing.T) {
+	viewer := auth.Token{User: "bob", Role: auth.RoleViewer}
+	operator := auth.Token{User: "alice", Role: auth.RoleOperator}
+	admin := auth.Token{User: "root", Role: auth.RoleAdmin}
+
+	cases := []struct {
+		tok   auth.Token
+		role  string
+		allow bool
+	}{
+		{viewer, auth.RoleViewer, true},
+		{viewer, auth.RoleOperator, false},
+		{operator, auth.RoleOperator, true},
+		{operator, auth.RoleAdmin, false},
+		{admin, auth.RoleViewer, true},
+		{auth.Token{User: "eve", Role: "superuser"}, auth.RoleViewer, false},
+	}
+	for _, c := range cases {
+		if c.tok.Allows(c.role) != c.allow {
+			t.Errorf("%s as %s: expected allows %s to be %t", c.tok.User, c.tok.Role, c.role, c.allow)
+		}
+	}
+
+	// Operators only manage their own deployments, admins manage all of them
+	if !operator.CanManage("alice") || operator.CanManage("bob") || operator.CanManage("") {
+		t.Errorf("operators should only manage the deployments they own")
+	}
+	if viewer.CanManage("bob") {
+		t.Errorf("viewers should not manage deployments, even their own")
+	}
+	if !admin.CanManage("alice") || !admin.CanManage("") {
+		t.Errorf("admins should manage every deployment")
+	}
+}
+
+// TestHashSecret
+func TestHashSecret(t *testing.T) {
+	hash := auth.HashSecret("vngen_secret")
+	if hash == "vngen_secret" || len(hash) != 64 {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if auth.HashSecret("vngen_secret") != hash || auth.HashSecret("vngen_other") == hash {
+		t.Errorf("hashes should be stable and differ between secrets")
+	}
+}
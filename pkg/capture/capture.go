@@ -0,0 +1,148 @@
+package capture
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/network"
+	"nenvoy.com/pkg/utils/pcap"
+)
+
+// Options - Struct for the options of a packet capture
+type Options struct {
+	Filter  string
+	Format  string
+	SnapLen int
+	Count   int
+}
+
+// Resolve - returns the hypervisor device for a capture target
+//
+// A target is either a network name, which captures on the network's
+// bridge, or host:iface, which captures on the host's tap device. The
+// iface may be the tap name, the network the interface is attached to or
+// the interface index.
+func Resolve(target string) (device string, err error) {
+	parts := strings.SplitN(target, ":", 2)
+
+	// Capture on the network bridge
+	if len(parts) == 1 {
+		netwk, err := network.GetNetworkByName(target)
+		if err != nil {
+			return "", err
+		}
+		if netwk.Name == "" {
+			return "", errdefs.NotFoundf("network %s not found", target)
+		}
+		return netwk.GetBridgeName()
+	}
+
+	// Capture on the host tap device
+	hst, err := host.GetHostByName(parts[0])
+	if err != nil {
+		return "", err
+	}
+	if hst.Name == "" {
+		return "", errdefs.NotFoundf("host %s not found", parts[0])
+	}
+
+	taps, err := hst.GetTapDevices()
+	if err != nil {
+		return "", err
+	}
+	if len(taps) == 0 {
+		return "", errdefs.NotFoundf("host %s has no tap devices, is it running?", hst.Name)
+	}
+
+	names := []string{}
+	for i, tap := range taps {
+		if parts[1] == tap.Name || parts[1] == tap.Network || parts[1] == strconv.Itoa(i) {
+			return tap.Name, nil
+		}
+		names = append(names, fmt.Sprintf("%d (%s on %s)", i, tap.Name, tap.Network))
+	}
+
+	return "", errdefs.NotFoundf("host %s has no interface %s, available: %s", hst.Name, parts[1], strings.Join(names, ", "))
+}
+
+// Session - Struct for a capture whose socket is open on the target's device
+type Session struct {
+	opts   Options
+	filter pcap.Filter
+	handle *pcap.Handle
+}
+
+// Open - compiles the filter and opens a socket on the target's device
+func Open(target string, opts Options) (s *Session, err error) {
+	filter, err := pcap.CompileFilter(opts.Filter)
+	if err != nil {
+		return nil, errdefs.Invalid(errors.Wrap(err, "invalid capture filter"))
+	}
+
+	device, err := Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := pcap.OpenLive(device, opts.SnapLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{opts: opts, filter: filter, handle: handle}, nil
+}
+
+// Run - captures packets on the target and writes them to w until ctx is done
+func Run(ctx context.Context, target string, opts Options, w io.Writer) (count int, err error) {
+	s, err := Open(target, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	return s.Run(ctx, w)
+}
+
+// Run - writes the session's packets to w until ctx is done or the count is reached
+func (s *Session) Run(ctx context.Context, w io.Writer) (count int, err error) {
+	writer, err := pcap.NewWriter(w, s.opts.Format, s.opts.SnapLen)
+	if err != nil {
+		return 0, err
+	}
+
+	for s.opts.Count <= 0 || count < s.opts.Count {
+		// Stop when the caller cancels
+		select {
+		case <-ctx.Done():
+			return count, nil
+		default:
+		}
+
+		data, ts, origLen, err := s.handle.ReadPacket()
+		if err != nil {
+			return count, err
+		}
+		if data == nil || !s.filter(data) {
+			continue
+		}
+
+		err = writer.WritePacket(ts, data, origLen)
+		if err != nil {
+			return count, errors.Wrap(err, "failed to write packet")
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// Close - closes the session's socket
+func (s *Session) Close() error {
+	return s.handle.Close()
+}
@@ -0,0 +1,411 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/pki"
+)
+
+// prefix - the path every route of the api is served under
+const prefix = "/api/v1"
+
+// Client - calls a vngen api server
+type Client struct {
+	// Server - the address of the server, such as http://localhost:8000
+	Server string
+	// HTTPClient - the client requests are sent with, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Token - the api token requests are authenticated with, see vngen token
+	Token string
+}
+
+// CaptureOptions - the filter, format and packet count of a capture
+type CaptureOptions struct {
+	Filter string
+	Format string
+	Count  int
+}
+
+// New - returns a client of the server
+func New(server string) *Client {
+	return &Client{Server: strings.TrimRight(server, "/")}
+}
+
+// NewTLS - returns a client of an https server, trusting the CA and presenting the client certificate if given
+func NewTLS(server string, caPath string, certPath string, keyPath string) (c *Client, err error) {
+	config, err := pki.ClientTLSConfig(caPath, certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c = New(server)
+	c.HTTPClient = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	return c, nil
+}
+
+// Build - builds a deployment from the template in the background, see Wait
+func (c *Client) Build(ctx context.Context, template structs.VirtualNetworkDefinition) (j Job, err error) {
+	body, err := json.Marshal(template)
+	if err != nil {
+		return j, err
+	}
+
+	err = c.call(ctx, "POST", prefix+"/build", nil, bytes.NewReader(body), &j)
+	return j, err
+}
+
+// CreateDeployment - builds a deployment from a template written in the content type, application/json or application/yaml, in the background, see Wait
+func (c *Client) CreateDeployment(ctx context.Context, template []byte, contentType string) (j Job, err error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	resp, err := c.sendHeader(ctx, "POST", prefix+"/deployments", nil, bytes.NewReader(template), header)
+	if err != nil {
+		return j, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&j)
+	if err != nil {
+		return j, errors.Wrap(err, "invalid response to POST "+prefix+"/deployments")
+	}
+
+	return j, nil
+}
+
+// GetDeployments - returns every deployment with its hosts and networks
+func (c *Client) GetDeployments(ctx context.Context) (deps []DeploymentDetails, err error) {
+	err = c.call(ctx, "GET", prefix+"/deployments", nil, nil, &deps)
+	return deps, err
+}
+
+// GetDeployment - returns a deployment with its hosts and networks
+func (c *Client) GetDeployment(ctx context.Context, name string) (dep DeploymentDetails, err error) {
+	err = c.call(ctx, "GET", prefix+"/deployments/"+url.PathEscape(name), nil, nil, &dep)
+	return dep, err
+}
+
+// DescribeDeployment - returns everything known about a deployment
+func (c *Client) DescribeDeployment(ctx context.Context, name string) (dep DeploymentDescription, err error) {
+	err = c.call(ctx, "GET", prefix+"/deployments/"+url.PathEscape(name)+"/describe", nil, nil, &dep)
+	return dep, err
+}
+
+// StartDeployment - starts every host of a deployment in the background, see Wait
+func (c *Client) StartDeployment(ctx context.Context, name string) (j Job, err error) {
+	err = c.call(ctx, "POST", prefix+"/deployments/"+url.PathEscape(name)+"/start", nil, nil, &j)
+	return j, err
+}
+
+// StopDeployment - stops every host of a deployment in the background, see Wait
+func (c *Client) StopDeployment(ctx context.Context, name string) (j Job, err error) {
+	err = c.call(ctx, "POST", prefix+"/deployments/"+url.PathEscape(name)+"/stop", nil, nil, &j)
+	return j, err
+}
+
+// RestartDeployment - restarts every host of a deployment in the background, see Wait
+func (c *Client) RestartDeployment(ctx context.Context, name string) (j Job, err error) {
+	err = c.call(ctx, "POST", prefix+"/deployments/"+url.PathEscape(name)+"/restart", nil, nil, &j)
+	return j, err
+}
+
+// DestroyDeployment - destroys a deployment with its hosts and networks in the background, see Wait
+func (c *Client) DestroyDeployment(ctx context.Context, name string) (j Job, err error) {
+	err = c.call(ctx, "DELETE", prefix+"/deployments/"+url.PathEscape(name), nil, nil, &j)
+	return j, err
+}
+
+// GetJob - returns the status, progress and logs of a job
+func (c *Client) GetJob(ctx context.Context, id uint) (j Job, err error) {
+	err = c.call(ctx, "GET", fmt.Sprintf("%s/jobs/%d", prefix, id), nil, nil, &j)
+	return j, err
+}
+
+// CancelJob - asks a running job to stop at its next step
+func (c *Client) CancelJob(ctx context.Context, id uint) (j Job, err error) {
+	err = c.call(ctx, "POST", fmt.Sprintf("%s/jobs/%d/cancel", prefix, id), nil, nil, &j)
+	return j, err
+}
+
+// Wait - polls the job every interval until it finishes, returning an error if it did not succeed
+func (c *Client) Wait(ctx context.Context, id uint, interval time.Duration) (j Job, err error) {
+	for {
+		j, err = c.GetJob(ctx, id)
+		if err != nil {
+			return j, err
+		}
+		if j.Finished() {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return j, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	if j.Status != "succeeded" {
+		return j, errors.Errorf("%s of %s %s: %s", j.Kind, j.Target, j.Status, j.Error)
+	}
+	return j, nil
+}
+
+// GetHosts - returns every host
+func (c *Client) GetHosts(ctx context.Context) (hosts []HostDetails, err error) {
+	err = c.call(ctx, "GET", prefix+"/hosts", nil, nil, &hosts)
+	return hosts, err
+}
+
+// GetHost - returns a host
+func (c *Client) GetHost(ctx context.Context, name string) (host HostDetails, err error) {
+	err = c.call(ctx, "GET", prefix+"/hosts/"+url.PathEscape(name), nil, nil, &host)
+	return host, err
+}
+
+// GetHostIPs - returns the addresses of a host's interfaces
+func (c *Client) GetHostIPs(ctx context.Context, name string) (ifaces []InterfaceAddresses, err error) {
+	err = c.call(ctx, "GET", prefix+"/hosts/"+url.PathEscape(name)+"/ipv4", nil, nil, &ifaces)
+	return ifaces, err
+}
+
+// DescribeHost - returns everything known about a host, with its libvirt XML if withXML is set
+func (c *Client) DescribeHost(ctx context.Context, name string, withXML bool) (host HostDescription, err error) {
+	err = c.call(ctx, "GET", prefix+"/hosts/"+url.PathEscape(name)+"/describe", xmlQuery(withXML), nil, &host)
+	return host, err
+}
+
+// StartHost - starts a host
+func (c *Client) StartHost(ctx context.Context, name string) (resp ActionResponse, err error) {
+	return c.action(ctx, "POST", "/hosts/"+url.PathEscape(name)+"/start")
+}
+
+// StopHost - stops a host
+func (c *Client) StopHost(ctx context.Context, name string) (resp ActionResponse, err error) {
+	return c.action(ctx, "POST", "/hosts/"+url.PathEscape(name)+"/stop")
+}
+
+// RestartHost - restarts a host
+func (c *Client) RestartHost(ctx context.Context, name string) (resp ActionResponse, err error) {
+	return c.action(ctx, "POST", "/hosts/"+url.PathEscape(name)+"/restart")
+}
+
+// DestroyHost - destroys a host
+func (c *Client) DestroyHost(ctx context.Context, name string) (resp ActionResponse, err error) {
+	return c.action(ctx, "DELETE", "/hosts/"+url.PathEscape(name))
+}
+
+// GetNetworks - returns every network
+func (c *Client) GetNetworks(ctx context.Context) (networks []NetworkDetails, err error) {
+	err = c.call(ctx, "GET", prefix+"/networks", nil, nil, &networks)
+	return networks, err
+}
+
+// DescribeNetwork - returns everything known about a network, with its libvirt XML if withXML is set
+func (c *Client) DescribeNetwork(ctx context.Context, name string, withXML bool) (network NetworkDescription, err error) {
+	err = c.call(ctx, "GET", prefix+"/networks/"+url.PathEscape(name)+"/describe", xmlQuery(withXML), nil, &network)
+	return network, err
+}
+
+// Resolve - resolves a name on the network serving it, or the given network
+func (c *Client) Resolve(ctx context.Context, name string, recordType string, network string) (answers ResolveDetails, err error) {
+	query := url.Values{}
+	if recordType != "" {
+		query.Set("type", recordType)
+	}
+	if network != "" {
+		query.Set("network", network)
+	}
+
+	err = c.call(ctx, "GET", prefix+"/resolve/"+url.PathEscape(name), query, nil, &answers)
+	return answers, err
+}
+
+// Capture - streams a packet capture of a network or host:iface until the context is cancelled
+func (c *Client) Capture(ctx context.Context, target string, opts CaptureOptions) (stream io.ReadCloser, err error) {
+	query := url.Values{}
+	if opts.Filter != "" {
+		query.Set("filter", opts.Filter)
+	}
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+	}
+	if opts.Count != 0 {
+		query.Set("count", strconv.Itoa(opts.Count))
+	}
+
+	resp, err := c.send(ctx, "GET", prefix+"/capture/"+url.PathEscape(target), query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// EventOptions - the deployment and kinds of events to stream, and the id of the last event already received
+type EventOptions struct {
+	Deployment string
+	Kinds      []string
+	LastID     uint64
+}
+
+// EventStream - the events streamed by the server
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Events - streams the changes to hosts, networks, deployments and jobs until the context is cancelled
+func (c *Client) Events(ctx context.Context, opts EventOptions) (stream *EventStream, err error) {
+	query := url.Values{}
+	if opts.Deployment != "" {
+		query.Set("deployment", opts.Deployment)
+	}
+	if len(opts.Kinds) > 0 {
+		query.Set("kind", strings.Join(opts.Kinds, ","))
+	}
+
+	header := http.Header{}
+	if opts.LastID != 0 {
+		header.Set("Last-Event-ID", strconv.FormatUint(opts.LastID, 10))
+	}
+
+	resp, err := c.sendHeader(ctx, "GET", prefix+"/events", query, nil, header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventStream{body: resp.Body, scanner: bufio.NewScanner(resp.Body)}, nil
+}
+
+// Next - returns the next event, or io.EOF once the server closes the stream
+func (s *EventStream) Next() (e Event, err error) {
+	data := ""
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "" && data != "":
+			err = json.Unmarshal([]byte(data), &e)
+			return e, err
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	if s.scanner.Err() != nil {
+		return e, s.scanner.Err()
+	}
+	return e, io.EOF
+}
+
+// Close - stops the stream
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
+
+// Spec - returns the server's OpenAPI document
+func (c *Client) Spec(ctx context.Context) (spec []byte, err error) {
+	resp, err := c.send(ctx, "GET", "/api/openapi.json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// xmlQuery - asks describe for the libvirt XML when withXML is set
+func xmlQuery(withXML bool) url.Values {
+	if !withXML {
+		return nil
+	}
+	return url.Values{"xml": {"true"}}
+}
+
+// action - runs a lifecycle action on a host or deployment
+func (c *Client) action(ctx context.Context, method string, path string) (resp ActionResponse, err error) {
+	err = c.call(ctx, method, prefix+path, nil, nil, &resp)
+	return resp, err
+}
+
+// call - sends the request and decodes the JSON response into out
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, body io.Reader, out interface{}) (err error) {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return errors.Wrapf(err, "invalid response to %s %s", method, path)
+	}
+
+	return nil
+}
+
+// send - sends the request, turning error responses into *Error
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body io.Reader) (resp *http.Response, err error) {
+	return c.sendHeader(ctx, method, path, query, body, nil)
+}
+
+// sendHeader - sends the request with the extra headers, turning error responses into *Error
+func (c *Client) sendHeader(ctx context.Context, method string, path string, query url.Values, body io.Reader, header http.Header) (resp *http.Response, err error) {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	// Servers answer failures with a JSON error body
+	apiErr := &Error{Status: resp.StatusCode}
+	b, _ := ioutil.ReadAll(resp.Body)
+	if json.Unmarshal(b, apiErr) != nil || apiErr.Code == "" {
+		apiErr.Code = "internal"
+		apiErr.Message = fmt.Sprintf("%s %s: %s", method, path, resp.Status)
+		apiErr.Details = strings.TrimSpace(string(b))
+	}
+
+	return nil, apiErr
+}
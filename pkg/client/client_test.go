@@ -0,0 +1,106 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nenvoy.com/pkg/client"
+)
+
+// TestClient
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer vngen_test" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/hosts/web1/start":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"kind": "host", "name": "web1", "action": "start",
+				"object": client.HostDetails{Name: "web1", State: "Running"},
+			})
+		case "GET /api/v1/resolve/web1.lab.vngen":
+			if r.URL.Query().Get("type") != "AAAA" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(client.ResolveDetails{Name: "web1.lab.vngen", Type: "AAAA", Answers: []string{"fd00::10"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(client.Error{Code: "not_found", Message: "Failed to start host db1", Details: "host db1 not found"})
+		}
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL + "/")
+	c.Token = "vngen_test"
+	ctx := context.Background()
+
+	resp, err := c.StartHost(ctx, "web1")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	host, err := resp.Host()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if resp.Action != "start" || host.State != "Running" {
+		t.Errorf("unexpected response %+v %+v", resp, host)
+	}
+
+	answers, err := c.Resolve(ctx, "web1.lab.vngen", "AAAA", "")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(answers.Answers) != 1 || answers.Answers[0] != "fd00::10" {
+		t.Errorf("unexpected answers %v", answers.Answers)
+	}
+
+	_, err = c.StartHost(ctx, "db1")
+	if !client.IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if err.(*client.Error).Status != http.StatusNotFound || err.Error() != "Failed to start host db1: host db1 not found" {
+		t.Errorf("unexpected error %+v", err)
+	}
+}
+
+// TestWait
+func TestWait(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/jobs/7":
+			polls++
+			j := client.Job{ID: 7, Kind: "build", Target: "lab", Status: "running", Progress: 50}
+			if polls == 3 {
+				j.Status, j.Progress = "succeeded", 100
+			}
+			json.NewEncoder(w).Encode(j)
+		case "GET /api/v1/jobs/8":
+			json.NewEncoder(w).Encode(client.Job{ID: 8, Kind: "destroy", Target: "lab", Status: "failed", Error: "host web1 not found"})
+		}
+	}))
+	defer srv.Close()
+
+	c := client.New(srv.URL)
+	ctx := context.Background()
+
+	j, err := c.Wait(ctx, 7, time.Millisecond)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if polls != 3 || j.Progress != 100 {
+		t.Errorf("expected 3 polls to finish at 100%%, got %d polls at %d%%", polls, j.Progress)
+	}
+
+	_, err = c.Wait(ctx, 8, time.Millisecond)
+	if err == nil || err.Error() != "destroy of lab failed: host web1 not found" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Contexts - the api servers the cli talks to, kept in a config file, and the one in use
+type Contexts struct {
+	Current  string    `yaml:"current-context"`
+	Contexts []Context `yaml:"contexts"`
+}
+
+// Context - an api server and the token and certificates it is called with
+type Context struct {
+	Name   string `yaml:"name"`
+	Server string `yaml:"server"`
+	Token  string `yaml:"token,omitempty"`
+	CA     string `yaml:"ca,omitempty"`
+	Cert   string `yaml:"cert,omitempty"`
+	Key    string `yaml:"key,omitempty"`
+}
+
+// DefaultContextsPath - returns the config file of the user's contexts, ~/.config/vngen/contexts.yaml
+func DefaultContextsPath() (path string, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return path, errors.Wrap(err, "failed to find the config directory")
+	}
+
+	return filepath.Join(dir, "vngen", "contexts.yaml"), nil
+}
+
+// LoadContexts - reads the contexts from the file, which has none if it does not exist
+func LoadContexts(path string) (c Contexts, err error) {
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+
+	err = yaml.Unmarshal(buf, &c)
+	if err != nil {
+		return c, errors.Wrapf(err, "in file %q", path)
+	}
+
+	return c, nil
+}
+
+// Save - writes the contexts to the file, readable only by the user as it holds tokens
+func (c Contexts) Save(path string) (err error) {
+	buf, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf, 0600)
+}
+
+// Get - returns the named context
+func (c Contexts) Get(name string) (ctx Context, ok bool) {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return ctx, true
+		}
+	}
+
+	return ctx, false
+}
+
+// Set - adds the context, replacing one of the same name
+func (c *Contexts) Set(ctx Context) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == ctx.Name {
+			c.Contexts[i] = ctx
+			return
+		}
+	}
+
+	c.Contexts = append(c.Contexts, ctx)
+}
+
+// Remove - removes the named context, reporting whether it existed
+func (c *Contexts) Remove(name string) bool {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.Current == name {
+				c.Current = ""
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// Client - returns a client of the context's server, over https if it has a CA or certificate
+func (ctx Context) Client() (c *Client, err error) {
+	if ctx.CA != "" || ctx.Cert != "" {
+		c, err = NewTLS(ctx.Server, ctx.CA, ctx.Cert, ctx.Key)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		c = New(ctx.Server)
+	}
+	c.Token = ctx.Token
+
+	return c, nil
+}
@@ -0,0 +1,54 @@
+package client_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nenvoy.com/pkg/client"
+)
+
+// TestContexts - saves, loads, replaces and removes contexts
+func TestContexts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vngen", "contexts.yaml")
+
+	// A missing file has no contexts
+	contexts, err := client.LoadContexts(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(contexts.Contexts) != 0 {
+		t.Errorf("unexpected contexts %+v", contexts)
+	}
+
+	contexts.Set(client.Context{Name: "lab", Server: "http://lab:8000", Token: "vngen_old"})
+	contexts.Set(client.Context{Name: "prod", Server: "https://prod:8000"})
+	contexts.Set(client.Context{Name: "lab", Server: "http://lab:8000", Token: "vngen_new"})
+	contexts.Current = "lab"
+	err = contexts.Save(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	contexts, err = client.LoadContexts(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	lab, ok := contexts.Get(contexts.Current)
+	if !ok || lab.Token != "vngen_new" || len(contexts.Contexts) != 2 {
+		t.Errorf("unexpected contexts %+v", contexts)
+	}
+
+	if !contexts.Remove("lab") || contexts.Current != "" {
+		t.Errorf("lab was not removed from %+v", contexts)
+	}
+	if _, ok := contexts.Get("lab"); ok || contexts.Remove("lab") {
+		t.Errorf("lab was removed twice from %+v", contexts)
+	}
+}
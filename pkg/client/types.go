@@ -0,0 +1,218 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	structs "nenvoy.com/pkg/constants"
+)
+
+// HostDetails - the details of a host
+type HostDetails struct {
+	Name       string
+	Image      string
+	State      string
+	RAM        int
+	CPUs       int
+	Username   string
+	HDSpace    string
+	Deployment string
+}
+
+// InterfaceAddresses - the addresses of a host interface
+type InterfaceAddresses struct {
+	Name       string
+	MacAddress string
+	IPv4       string
+	IPv6       string
+}
+
+// Network - a network and its addressing
+type Network struct {
+	ID            uint
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     *time.Time
+	Name          string
+	IP            string
+	DHCPLower     string
+	DHCPUpper     string
+	Netmask       string
+	Type          string
+	HostBridge    string
+	HostDev       string
+	MacvtapMode   string
+	IPv6          string
+	IPv6Prefix    int
+	IPv6Mode      string
+	IPv6DHCPLower string
+	IPv6DHCPUpper string
+	MTU           int
+	STP           string
+	Delay         int
+	BridgeName    string
+	NATPortStart  int
+	NATPortEnd    int
+	Domain        string
+	Records       []structs.DNSRecordDefinition
+	DeploymentID  uint
+}
+
+// NetworkDetails - a network, whether libvirt is running it, active or inactive, and the deployment it is in
+type NetworkDetails struct {
+	Network
+	State      string
+	Deployment string
+}
+
+// DeploymentDetails - a deployment with its hosts and networks
+type DeploymentDetails struct {
+	Name  string
+	Owner string
+	// State - running or off when every host is, partial when they differ, empty without hosts
+	State     string
+	CreatedAt time.Time
+	Hosts     []HostDetails
+	Networks  []NetworkDetails
+}
+
+// DiskDetails - a disk of a host and the image it is backed by
+type DiskDetails struct {
+	Device       string
+	File         string
+	Format       string
+	BackingImage string
+}
+
+// InterfaceDetails - an interface of a host, what it is attached to and its addresses
+type InterfaceDetails struct {
+	Index      int
+	Type       string
+	Network    string
+	Name       string
+	Device     string
+	MacAddress string
+	Address    string
+	IPv4       string
+	IPv6       string
+}
+
+// HostDescription - a host with its disks, interfaces, recent events and libvirt XML if asked for
+type HostDescription struct {
+	HostDetails
+	Role       string
+	Disks      []DiskDetails
+	Interfaces []InterfaceDetails
+	Networks   []string
+	XML        string `json:",omitempty"`
+	Events     []Event
+}
+
+// NetworkDescription - a network with the hosts on it, recent events and libvirt XML if asked for
+type NetworkDescription struct {
+	NetworkDetails
+	Hosts  []string
+	XML    string `json:",omitempty"`
+	Events []Event
+}
+
+// DeploymentDescription - a deployment with the recent events of it, its hosts, networks and jobs
+type DeploymentDescription struct {
+	DeploymentDetails
+	Events []Event
+}
+
+// ResolveDetails - the answers to a dns lookup on a vngen network
+type ResolveDetails struct {
+	Name    string
+	Type    string
+	Answers []string
+}
+
+// Job - a build, destroy, start, stop or restart of a deployment running on the server
+type Job struct {
+	ID         uint
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  *time.Time
+	Kind       string
+	Target     string
+	Owner      string
+	Status     string
+	Progress   int
+	Logs       string
+	Error      string
+	FinishedAt *time.Time
+}
+
+// Finished - reports whether the job has stopped running
+func (j Job) Finished() bool {
+	return j.Status == "succeeded" || j.Status == "failed" || j.Status == "cancelled"
+}
+
+// Event - a change to a host, network, deployment or job
+type Event struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Deployment string    `json:"deployment,omitempty"`
+	Action     string    `json:"action"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// ActionResponse - the result of starting, stopping, restarting or destroying a host
+type ActionResponse struct {
+	Kind   string          `json:"kind"`
+	Name   string          `json:"name"`
+	Action string          `json:"action"`
+	Object json.RawMessage `json:"object,omitempty"`
+}
+
+// Host - decodes the host the action was run on
+func (a ActionResponse) Host() (host HostDetails, err error) {
+	err = json.Unmarshal(a.Object, &host)
+	return host, err
+}
+
+// Error - an error answered by the server
+type Error struct {
+	// Status - the http status of the response
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details,omitempty"`
+}
+
+// Error - returns the message and the underlying error
+func (e *Error) Error() string {
+	if e.Details == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Message, e.Details)
+}
+
+// IsNotFound - reports whether the error is a missing host, deployment, network or route
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "not_found"
+}
+
+// IsConflict - reports whether the error is a name, address, MAC or port already in use
+func IsConflict(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "conflict"
+}
+
+// IsUnauthorized - reports whether the request had no valid token
+func IsUnauthorized(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "unauthorized"
+}
+
+// IsForbidden - reports whether the token does not allow the request
+func IsForbidden(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "forbidden"
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// DefaultPath - the config file read unless another is given
+const DefaultPath = "/etc/vngen/config.yaml"
+
+// EnvPrefix - the prefix of the environment variables overriding the config file, e.g. VNGEN_APP_DIR
+const EnvPrefix = "vngen"
+
+// Config - the paths, libvirt connection and api settings vngen runs with
+type Config struct {
+	// AppDir - where the machines, images and certificates are kept
+	AppDir string `mapstructure:"app_dir" yaml:"app_dir"`
+	// DBPath - the sqlite database, main.db in AppDir unless set
+	DBPath string `mapstructure:"db_path" yaml:"db_path"`
+	// LibvirtURI - the libvirt connection hosts and networks are managed through
+	LibvirtURI string `mapstructure:"libvirt_uri" yaml:"libvirt_uri"`
+	// Emulator - the QEMU binary hosts are run with
+	Emulator string `mapstructure:"emulator" yaml:"emulator"`
+	// LogFile - where errors are logged with their stack traces
+	LogFile string `mapstructure:"log_file" yaml:"log_file"`
+	// APIPort - the port the rest api listens on unless given with --port
+	APIPort int `mapstructure:"api_port" yaml:"api_port"`
+}
+
+// current - the config of the running process
+var current = struct {
+	sync.RWMutex
+	config Config
+}{config: Defaults()}
+
+// Defaults - returns the settings used when neither the config file nor the environment sets them
+func Defaults() Config {
+	return Config{
+		AppDir:     "/var/lib/nenvn",
+		DBPath:     "/var/lib/nenvn/main.db",
+		LibvirtURI: "qemu:///system",
+		Emulator:   "/usr/bin/qemu-system-x86_64",
+		LogFile:    "/tmp/nenvoy/nenvn.log",
+		APIPort:    8000,
+	}
+}
+
+// Load - reads the config file, which may not exist, and the VNGEN_* environment variables overriding it
+func Load(path string) (c Config, err error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	v.SetEnvPrefix(EnvPrefix)
+	v.AutomaticEnv()
+
+	// Every key needs a default for the environment to override it
+	defaults := Defaults()
+	v.SetDefault("app_dir", defaults.AppDir)
+	v.SetDefault("db_path", "")
+	v.SetDefault("libvirt_uri", defaults.LibvirtURI)
+	v.SetDefault("emulator", defaults.Emulator)
+	v.SetDefault("log_file", defaults.LogFile)
+	v.SetDefault("api_port", defaults.APIPort)
+
+	err = v.ReadInConfig()
+	if err != nil && !os.IsNotExist(err) {
+		return c, errors.Wrapf(err, "failed to read config %s", path)
+	}
+
+	err = v.Unmarshal(&c)
+	if err != nil {
+		return c, errors.Wrapf(err, "invalid config %s", path)
+	}
+
+	// The database follows the app directory unless placed elsewhere
+	if c.DBPath == "" {
+		c.DBPath = filepath.Join(c.AppDir, "main.db")
+	}
+	if c.APIPort < 1 || c.APIPort > 65535 {
+		return c, fmt.Errorf("invalid config %s: api_port %d is not a port", path, c.APIPort)
+	}
+
+	return c, nil
+}
+
+// Get - returns the config of the running process
+func Get() Config {
+	current.RLock()
+	defer current.RUnlock()
+
+	return current.config
+}
+
+// Set - replaces the config of the running process
+func Set(c Config) {
+	current.Lock()
+	defer current.Unlock()
+
+	current.config = c
+}
+
+// MachineDir - returns the directory of a host's disks and cloud-init files
+func (c Config) MachineDir(host string) string {
+	return filepath.Join(c.AppDir, "machines", host)
+}
+
+// ImagePath - returns the base image hosts of the image are backed by
+func (c Config) ImagePath(image string) string {
+	return filepath.Join(c.AppDir, "images", image+".img")
+}
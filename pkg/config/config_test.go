@@ -0,0 +1,52 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nenvoy.com/pkg/config"
+)
+
+// TestLoad - reads the file over the defaults, and the environment over the file
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	// A missing file leaves the defaults
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if c != config.Defaults() {
+		t.Errorf("expected the defaults, got %+v", c)
+	}
+
+	err = ioutil.WriteFile(path, []byte("app_dir: /srv/vngen\nemulator: /usr/libexec/qemu-kvm\napi_port: 9000\n"), 0644)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	os.Setenv("VNGEN_API_PORT", "9443")
+	defer os.Unsetenv("VNGEN_API_PORT")
+
+	c, err = config.Load(path)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	expected := config.Defaults()
+	expected.AppDir = "/srv/vngen"
+	expected.DBPath = "/srv/vngen/main.db"
+	expected.Emulator = "/usr/libexec/qemu-kvm"
+	expected.APIPort = 9443
+	if c != expected {
+		t.Errorf("expected %+v, got %+v", expected, c)
+	}
+	if c.MachineDir("web1") != "/srv/vngen/machines/web1" {
+		t.Errorf("unexpected machine directory %s", c.MachineDir("web1"))
+	}
+}
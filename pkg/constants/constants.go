@@ -1,6 +1,16 @@
 package constants
 
 const (
-	DBPath = "/var/lib/nenvn/main.db"
-	AppDir = "/var/lib/nenvn"
+	// IPAMPool - the pool networks with cidr auto are allocated from
+	IPAMPool = "10.100.0.0/16"
+	// IPAMPrefix - the prefix length of networks allocated from the pool
+	IPAMPrefix = 24
+
+	// DNSDomain - the domain deployments are registered under, as <host>.<deployment>.<domain>
+	DNSDomain = "vngen"
+	// DnsmasqNamespace - the libvirt XML namespace for raw dnsmasq options
+	DnsmasqNamespace = "http://libvirt.org/schemas/network/dnsmasq/1.0"
+
+	// LinkUDPPortBase - the first hypervisor port used by udp links
+	LinkUDPPortBase = 40000
 )
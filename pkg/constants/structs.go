@@ -1,36 +1,184 @@
 package constants
 
-import "encoding/xml"
+import (
+	"encoding/json"
+	"encoding/xml"
+)
 
 //VirtualNetworkDefinition - provides the structure of the templated YAML file
 type VirtualNetworkDefinition struct {
 	Deployment struct {
 		DeploymentName string `yaml:"name" json:"name"`
+		// Owner - the user building the deployment, set by the api rather than the template
+		Owner string `yaml:"-" json:"-"`
 	} `yaml:"deployment" json:"deployment"`
+	IPAM struct {
+		Pool   string `yaml:"pool" json:"pool"`
+		Prefix int    `yaml:"prefix" json:"prefix"`
+	} `yaml:"ipam" json:"ipam"`
+	DNS      DNSDefinition       `yaml:"dns" json:"dns"`
 	Networks []NetworkDefinition `yaml:"networks" json:"networks"`
+	Links    []LinkDefinition    `yaml:"links" json:"links"`
 	Host     []HostDefintion     `yaml:"hosts" json:"hosts"`
 }
 
+// LinkDefinition - Defines a point-to-point link, written as just "hostA:ifname <-> hostB:ifname" or with addressing
+type LinkDefinition struct {
+	Link      string   `yaml:"link" json:"link"`
+	Mode      string   `yaml:"mode" json:"mode"`
+	Subnet    string   `yaml:"subnet" json:"subnet"`
+	Addresses []string `yaml:"addresses" json:"addresses"`
+}
+
+// linkDefinition - avoids recursing into the custom unmarshallers
+type linkDefinition LinkDefinition
+
+// UnmarshalYAML - accepts either a link string or a link mapping
+func (l *LinkDefinition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&l.Link); err == nil {
+		return nil
+	}
+	return unmarshal((*linkDefinition)(l))
+}
+
+// UnmarshalJSON - accepts either a link string or a link object
+func (l *LinkDefinition) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &l.Link); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, (*linkDefinition)(l))
+}
+
+// DNSDefinition - Defines the DNS domain and custom records of a deployment
+type DNSDefinition struct {
+	Domain  string                `yaml:"domain" json:"domain"`
+	Records []DNSRecordDefinition `yaml:"records" json:"records"`
+}
+
+// DNSRecordDefinition - Defines a custom A, AAAA, CNAME or SRV record, the name of a SRV record is the service
+type DNSRecordDefinition struct {
+	Name     string `yaml:"name" json:"name"`
+	Type     string `yaml:"type" json:"type"`
+	Value    string `yaml:"value" json:"value"`
+	Protocol string `yaml:"protocol" json:"protocol"`
+	Port     int    `yaml:"port" json:"port"`
+	Priority int    `yaml:"priority" json:"priority"`
+	Weight   int    `yaml:"weight" json:"weight"`
+}
+
 //NetworkDefinition - Defines the networks to be built
 type NetworkDefinition struct {
-	NetworkName string `yaml:"name" json:"name"`
-	NetworkAddr string `yaml:"netaddr" json:"netaddr"`
-	DHCPLower   string `yaml:"dhcplower" json:"dhcplower"`
-	DHCPUpper   string `yaml:"dhcpupper" json:"dhcpupper"`
-	Netmask     string `yaml:"netmask" json:"netmask"`
-	Type        string `yaml:"type" json:"type"`
+	NetworkName string          `yaml:"name" json:"name"`
+	CIDR        string          `yaml:"cidr" json:"cidr"`
+	NetworkAddr string          `yaml:"netaddr" json:"netaddr"`
+	DHCPLower   string          `yaml:"dhcplower" json:"dhcplower"`
+	DHCPUpper   string          `yaml:"dhcpupper" json:"dhcpupper"`
+	Netmask     string          `yaml:"netmask" json:"netmask"`
+	Type        string          `yaml:"type" json:"type"`
+	DHCP        *bool           `yaml:"dhcp" json:"dhcp"`
+	HostBridge  string          `yaml:"hostbridge" json:"hostbridge"`
+	HostDev     string          `yaml:"hostdev" json:"hostdev"`
+	MacvtapMode string          `yaml:"macvtapmode" json:"macvtapmode"`
+	IPv6        *IPv6Definition `yaml:"ipv6" json:"ipv6"`
+	MTU         int             `yaml:"mtu" json:"mtu"`
+	STP         *bool           `yaml:"stp" json:"stp"`
+	Delay       *int            `yaml:"delay" json:"delay"`
+	BridgeName  string          `yaml:"bridgename" json:"bridgename"`
+	NATPorts    string          `yaml:"natports" json:"natports"`
+}
+
+// IPv6Definition - Defines the IPv6 addressing of a network
+type IPv6Definition struct {
+	Address   string `yaml:"address" json:"address"`
+	Prefix    int    `yaml:"prefix" json:"prefix"`
+	Mode      string `yaml:"mode" json:"mode"`
+	DHCPLower string `yaml:"dhcplower" json:"dhcplower"`
+	DHCPUpper string `yaml:"dhcpupper" json:"dhcpupper"`
 }
 
 // HostDefintion - Defines the host on the virtual network
 type HostDefintion struct {
-	HostName string   `yaml:"name" json:"name"`
-	Image    string   `yaml:"image" json:"image"`
-	RAM      int      `yaml:"ram" json:"ram"`
-	CPUs     int      `yaml:"cpus" json:"cpus"`
-	Username string   `yaml:"username" json:"username"`
-	Password string   `yaml:"password" json:"password"`
-	Networks []string `yaml:"networks" json:"networks"`
-	HDSpace  string   `yaml:"hd" json:"hd"`
+	HostName string                `yaml:"name" json:"name"`
+	Image    string                `yaml:"image" json:"image"`
+	Role     string                `yaml:"role" json:"role"`
+	RAM      int                   `yaml:"ram" json:"ram"`
+	CPUs     int                   `yaml:"cpus" json:"cpus"`
+	Username string                `yaml:"username" json:"username"`
+	Password string                `yaml:"password" json:"password"`
+	Networks []InterfaceDefinition `yaml:"networks" json:"networks"`
+	Ports    []PortDefinition      `yaml:"ports" json:"ports"`
+	Firewall *FirewallDefinition   `yaml:"firewall" json:"firewall"`
+	HDSpace  string                `yaml:"hd" json:"hd"`
+}
+
+// FirewallDefinition - Defines the traffic allowed in and out of a host's interfaces
+type FirewallDefinition struct {
+	Ingress string                   `yaml:"ingress" json:"ingress"`
+	Egress  string                   `yaml:"egress" json:"egress"`
+	Rules   []FirewallRuleDefinition `yaml:"rules" json:"rules"`
+}
+
+// FirewallRuleDefinition - Defines traffic to allow or deny, rules are matched in order
+type FirewallRuleDefinition struct {
+	Action    string `yaml:"action" json:"action"`
+	Direction string `yaml:"direction" json:"direction"`
+	Protocol  string `yaml:"protocol" json:"protocol"`
+	Port      string `yaml:"port" json:"port"`
+	CIDR      string `yaml:"cidr" json:"cidr"`
+}
+
+// PortDefinition - Defines a port on the hypervisor forwarded to the host
+type PortDefinition struct {
+	HostPort  int    `yaml:"hostport" json:"hostport"`
+	GuestPort int    `yaml:"guestport" json:"guestport"`
+	Protocol  string `yaml:"protocol" json:"protocol"`
+	Network   string `yaml:"network" json:"network"`
+}
+
+// InterfaceDefinition - Defines a host interface, written as just the network name or with a fixed mac and ip
+type InterfaceDefinition struct {
+	Network  string              `yaml:"network" json:"network"`
+	Name     string              `yaml:"name" json:"name"`
+	MAC      string              `yaml:"mac" json:"mac"`
+	IP       string              `yaml:"ip" json:"ip"`
+	Address  string              `yaml:"address" json:"address"`
+	VLAN     int                 `yaml:"vlan" json:"vlan"`
+	Trunk    []int               `yaml:"trunk" json:"trunk"`
+	Firewall *FirewallDefinition `yaml:"firewall" json:"firewall"`
+	Routes   []RouteDefinition   `yaml:"routes" json:"routes"`
+	// UDP - set for the ends of udp links, which have no network
+	UDP *UDPTunnel `yaml:"-" json:"-"`
+}
+
+// RouteDefinition - Defines a route installed in the guest through the interface
+type RouteDefinition struct {
+	To  string `yaml:"to" json:"to"`
+	Via string `yaml:"via" json:"via"`
+}
+
+// UDPTunnel - the local ports of the two ends of a udp link
+type UDPTunnel struct {
+	LocalPort  int
+	RemotePort int
+}
+
+// interfaceDefinition - avoids recursing into the custom unmarshallers
+type interfaceDefinition InterfaceDefinition
+
+// UnmarshalYAML - accepts either a network name or an interface mapping
+func (i *InterfaceDefinition) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&i.Network); err == nil {
+		return nil
+	}
+	return unmarshal((*interfaceDefinition)(i))
+}
+
+// UnmarshalJSON - accepts either a network name or an interface object
+func (i *InterfaceDefinition) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &i.Network); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, (*interfaceDefinition)(i))
 }
 
 //Domain writes the XML files
@@ -105,51 +253,250 @@ type Disk struct {
 		Dev  string `xml:"dev,attr"`
 		Bus  string `xml:"bus,attr"`
 	} `xml:"target"`
+	BackingStore *DiskBackingStore `xml:"backingStore"`
 }
 
-type Interface struct {
+// DiskBackingStore - the image a disk is an overlay of, reported by libvirt in the live domain XML
+type DiskBackingStore struct {
 	Text   string `xml:",chardata"`
 	Type   string `xml:"type,attr"`
+	Format struct {
+		Text string `xml:",chardata"`
+		Type string `xml:"type,attr"`
+	} `xml:"format"`
+	Source struct {
+		Text string `xml:",chardata"`
+		File string `xml:"file,attr"`
+	} `xml:"source"`
+}
+
+type Interface struct {
+	Text   string        `xml:",chardata"`
+	Type   string        `xml:"type,attr"`
+	Mac    *InterfaceMac `xml:"mac"`
 	Source struct {
-		Text    string `xml:",chardata"`
-		Network string `xml:"network,attr"`
+		Text    string                `xml:",chardata"`
+		Network string                `xml:"network,attr,omitempty"`
+		Address string                `xml:"address,attr,omitempty"`
+		Port    int                   `xml:"port,attr,omitempty"`
+		Local   *InterfaceSourceLocal `xml:"local"`
 	} `xml:"source"`
 	Model struct {
 		Text string `xml:",chardata"`
 		Type string `xml:"type,attr"`
 		Name string `xml:"name,attr"`
 	} `xml:"model"`
+	Target    *InterfaceTarget    `xml:"target"`
+	Vlan      *InterfaceVlan      `xml:"vlan"`
+	FilterRef *InterfaceFilterRef `xml:"filterref"`
+}
+
+// InterfaceVlan - the vlan tags of an interface on an ovs network
+type InterfaceVlan struct {
+	Trunk string             `xml:"trunk,attr,omitempty"`
+	Tag   []InterfaceVlanTag `xml:"tag"`
+}
+
+// InterfaceVlanTag - a vlan id, untagged when it is the native vlan of a trunk
+type InterfaceVlanTag struct {
+	ID         int    `xml:"id,attr"`
+	NativeMode string `xml:"nativeMode,attr,omitempty"`
+}
+
+// InterfaceMac - the mac address of an interface
+type InterfaceMac struct {
+	Text    string `xml:",chardata"`
+	Address string `xml:"address,attr"`
+}
+
+// InterfaceSourceLocal - the local end of a udp interface
+type InterfaceSourceLocal struct {
+	Address string `xml:"address,attr"`
+	Port    int    `xml:"port,attr"`
+}
+
+// InterfaceFilterRef - the nwfilter applied to the interface
+type InterfaceFilterRef struct {
+	Filter string `xml:"filter,attr"`
+}
+
+// InterfaceTarget - the tap device libvirt assigns to a running interface
+type InterfaceTarget struct {
+	Text string `xml:",chardata"`
+	Dev  string `xml:"dev,attr"`
 }
 
 type Network struct {
-	XMLName xml.Name `xml:"network"`
-	Text    string   `xml:",chardata"`
-	Name    string   `xml:"name"`
-	Forward struct {
-		Text string `xml:",chardata"`
-		Mode string `xml:"mode,attr"`
-	} `xml:"forward"`
-	Bridge struct {
-		Text  string `xml:",chardata"`
-		Name  string `xml:"name,attr"`
-		Stp   string `xml:"stp,attr"`
-		Delay string `xml:"delay,attr"`
-	} `xml:"bridge"`
+	XMLName      xml.Name            `xml:"network"`
+	XMLNSDnsmasq string              `xml:"xmlns:dnsmasq,attr,omitempty"`
+	Text         string              `xml:",chardata"`
+	Name         string              `xml:"name"`
+	Forward      *NetworkForward     `xml:"forward"`
+	Bridge       *NetworkBridge      `xml:"bridge"`
+	MTU          *NetworkMTU         `xml:"mtu"`
+	VirtualPort  *NetworkVirtualPort `xml:"virtualport"`
+	Domain       *NetworkDomain      `xml:"domain"`
+	DNS          *NetworkDNS         `xml:"dns"`
 	// Mac struct {
 	// 	Text    string `xml:",chardata"`
 	// 	Address string `xml:"address,attr"`
 	// } `xml:"mac"`
-	IP struct {
-		Text    string `xml:",chardata"`
-		Address string `xml:"address,attr"`
-		Netmask string `xml:"netmask,attr"`
-		Dhcp    struct {
-			Text  string `xml:",chardata"`
-			Range struct {
-				Text  string `xml:",chardata"`
-				Start string `xml:"start,attr"`
-				End   string `xml:"end,attr"`
-			} `xml:"range"`
-		} `xml:"dhcp"`
-	} `xml:"ip"`
+	IP      []NetworkIP     `xml:"ip"`
+	Dnsmasq *DnsmasqOptions `xml:"dnsmasq:options"`
+}
+
+// NetworkDomain - the DNS domain dnsmasq registers DHCP clients under
+type NetworkDomain struct {
+	Text      string `xml:",chardata"`
+	Name      string `xml:"name,attr"`
+	LocalOnly string `xml:"localOnly,attr,omitempty"`
+}
+
+// NetworkDNS - the records served by the network's dnsmasq
+type NetworkDNS struct {
+	Text string           `xml:",chardata"`
+	Host []NetworkDNSHost `xml:"host"`
+	Srv  []NetworkDNSSrv  `xml:"srv"`
+}
+
+// NetworkDNSHost - the names of an address
+type NetworkDNSHost struct {
+	XMLName  xml.Name `xml:"host"`
+	IP       string   `xml:"ip,attr"`
+	Hostname []string `xml:"hostname"`
+}
+
+// NetworkDNSSrv - a service record
+type NetworkDNSSrv struct {
+	XMLName  xml.Name `xml:"srv"`
+	Service  string   `xml:"service,attr"`
+	Protocol string   `xml:"protocol,attr"`
+	Domain   string   `xml:"domain,attr,omitempty"`
+	Target   string   `xml:"target,attr,omitempty"`
+	Port     int      `xml:"port,attr,omitempty"`
+	Priority int      `xml:"priority,attr,omitempty"`
+	Weight   int      `xml:"weight,attr,omitempty"`
+}
+
+// DnsmasqOptions - raw dnsmasq options passed through by libvirt
+type DnsmasqOptions struct {
+	Option []DnsmasqOption `xml:"dnsmasq:option"`
+}
+
+// DnsmasqOption - a single dnsmasq option
+type DnsmasqOption struct {
+	Value string `xml:"value,attr"`
+}
+
+// NetworkForward - how traffic leaves the network, omitted for isolated networks
+type NetworkForward struct {
+	Text      string                    `xml:",chardata"`
+	Mode      string                    `xml:"mode,attr"`
+	NAT       *NetworkNAT               `xml:"nat"`
+	Interface []NetworkForwardInterface `xml:"interface"`
+}
+
+// NetworkNAT - the settings of a nat network's masquerading
+type NetworkNAT struct {
+	Port *NetworkNATPort `xml:"port"`
+}
+
+// NetworkNATPort - the source ports masqueraded connections are given
+type NetworkNATPort struct {
+	Start int `xml:"start,attr"`
+	End   int `xml:"end,attr"`
+}
+
+// NetworkMTU - the MTU of the network's bridge
+type NetworkMTU struct {
+	Size int `xml:"size,attr"`
+}
+
+// NetworkForwardInterface - a host device used by macvtap networks
+type NetworkForwardInterface struct {
+	Text string `xml:",chardata"`
+	Dev  string `xml:"dev,attr"`
+}
+
+// NetworkBridge - the bridge created for, or used by, the network
+type NetworkBridge struct {
+	Text  string `xml:",chardata"`
+	Name  string `xml:"name,attr"`
+	Stp   string `xml:"stp,attr,omitempty"`
+	Delay string `xml:"delay,attr,omitempty"`
+}
+
+// NetworkVirtualPort - the kind of switch the network's ports are added to
+type NetworkVirtualPort struct {
+	Type string `xml:"type,attr"`
+}
+
+// NetworkIP - an address of the network on the host with optional DHCP
+type NetworkIP struct {
+	Text    string       `xml:",chardata"`
+	Family  string       `xml:"family,attr,omitempty"`
+	Address string       `xml:"address,attr"`
+	Netmask string       `xml:"netmask,attr,omitempty"`
+	Prefix  int          `xml:"prefix,attr,omitempty"`
+	Dhcp    *NetworkDHCP `xml:"dhcp"`
+}
+
+// NetworkDHCP - the DHCP server settings of a network address
+type NetworkDHCP struct {
+	Text  string `xml:",chardata"`
+	Range struct {
+		Text  string `xml:",chardata"`
+		Start string `xml:"start,attr"`
+		End   string `xml:"end,attr"`
+	} `xml:"range"`
+	Host []NetworkDHCPHost `xml:"host"`
+}
+
+// NetworkDHCPHost - a static DHCP reservation
+type NetworkDHCPHost struct {
+	XMLName xml.Name `xml:"host"`
+	Mac     string   `xml:"mac,attr,omitempty"`
+	Name    string   `xml:"name,attr,omitempty"`
+	IP      string   `xml:"ip,attr"`
+}
+
+// NWFilter - a libvirt network filter
+type NWFilter struct {
+	XMLName   xml.Name       `xml:"filter"`
+	Name      string         `xml:"name,attr"`
+	Chain     string         `xml:"chain,attr"`
+	Priority  int            `xml:"priority,attr,omitempty"`
+	FilterRef []NWFilterRef  `xml:"filterref"`
+	Rule      []NWFilterRule `xml:"rule"`
+}
+
+// NWFilterRef - another filter included in the filter
+type NWFilterRef struct {
+	Filter string `xml:"filter,attr"`
+}
+
+// NWFilterRule - a rule of a network filter, with one protocol element set
+type NWFilterRule struct {
+	Action    string         `xml:"action,attr"`
+	Direction string         `xml:"direction,attr"`
+	Priority  int            `xml:"priority,attr"`
+	All       *NWFilterMatch `xml:"all"`
+	AllIPv6   *NWFilterMatch `xml:"all-ipv6"`
+	TCP       *NWFilterMatch `xml:"tcp"`
+	TCPv6     *NWFilterMatch `xml:"tcp-ipv6"`
+	UDP       *NWFilterMatch `xml:"udp"`
+	UDPv6     *NWFilterMatch `xml:"udp-ipv6"`
+	ICMP      *NWFilterMatch `xml:"icmp"`
+	ICMPv6    *NWFilterMatch `xml:"icmpv6"`
+}
+
+// NWFilterMatch - the packet fields matched by a rule
+type NWFilterMatch struct {
+	SrcIPAddr    string `xml:"srcipaddr,attr,omitempty"`
+	SrcIPMask    int    `xml:"srcipmask,attr,omitempty"`
+	DstIPAddr    string `xml:"dstipaddr,attr,omitempty"`
+	DstIPMask    int    `xml:"dstipmask,attr,omitempty"`
+	DstPortStart int    `xml:"dstportstart,attr,omitempty"`
+	DstPortEnd   int    `xml:"dstportend,attr,omitempty"`
+	State        string `xml:"state,attr,omitempty"`
 }
@@ -5,13 +5,13 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-	"nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/config"
 )
 
 // NewSession - Return the db object to create transactions on the database
 func NewSession() (db *gorm.DB, err error) {
 	// Connect and open the database
-	db, err = gorm.Open(sqlite.Open(constants.DBPath), &gorm.Config{
+	db, err = gorm.Open(sqlite.Open(config.Get().DBPath), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	})
 	if err != nil {
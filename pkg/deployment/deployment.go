@@ -5,8 +5,9 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
-	constants "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/config"
 	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/errdefs"
 	"nenvoy.com/pkg/host"
 	"nenvoy.com/pkg/network"
 )
@@ -16,6 +17,7 @@ type Deployment struct {
 	gorm.Model
 	ID       uint
 	Name     string
+	Owner    string
 	Hosts    []host.Host
 	Networks []network.Network
 }
@@ -32,10 +34,27 @@ func (d *Deployment) Destroy() (err error) {
 	return nil
 }
 
+// GetDeployments - Gets every deployment from the database
+func GetDeployments() (deps []Deployment, err error) {
+	// Connect and open the database
+	db, err := gorm.Open(sqlite.Open(config.Get().DBPath), &gorm.Config{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect database")
+	}
+
+	// Get the deployments from the db
+	err = db.Order("name").Find(&deps).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find deployments")
+	}
+
+	return deps, nil
+}
+
 // GetDeploymentByID - Gets a deployment from the database by it's ID
 func GetDeploymentByID(depID uint) (Deployment, error) {
 	// Connect and open the database
-	db, err := gorm.Open(sqlite.Open(constants.DBPath), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(config.Get().DBPath), &gorm.Config{})
 	if err != nil {
 		return Deployment{}, errors.Wrap(err, "failed to connect database")
 	}
@@ -53,7 +72,7 @@ func GetDeploymentByID(depID uint) (Deployment, error) {
 // GetDeploymentByName - Gets a deployment from the database by it's Name
 func GetDeploymentByName(depName string) (Deployment, error) {
 	// Connect and open the database
-	db, err := gorm.Open(sqlite.Open(constants.DBPath), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(config.Get().DBPath), &gorm.Config{})
 	if err != nil {
 		return Deployment{}, errors.Wrap(err, "failed to connect database")
 	}
@@ -61,7 +80,9 @@ func GetDeploymentByName(depName string) (Deployment, error) {
 	// Get the deployment from the db
 	var dep Deployment
 	err = db.Where("name = ?", depName).First(&dep).Error
-	if err != nil {
+	if err == gorm.ErrRecordNotFound {
+		return dep, errdefs.NotFoundf("deployment %s not found", depName)
+	} else if err != nil {
 		return dep, errors.Wrap(err, "failed to find deployment")
 	}
 
@@ -0,0 +1,336 @@
+package doctor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	libvirt "libvirt.org/libvirt-go"
+	"nenvoy.com/pkg/config"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/ipam"
+	"nenvoy.com/pkg/network"
+	netutils "nenvoy.com/pkg/utils/network"
+)
+
+// Statuses of a check
+const (
+	// StatusOK - nothing to fix
+	StatusOK = "ok"
+	// StatusWarning - builds work, but some features or future builds may not
+	StatusWarning = "warning"
+	// StatusFailed - builds will fail until it is fixed
+	StatusFailed = "failed"
+)
+
+const (
+	// KVMDevice - the device hosts are accelerated with
+	KVMDevice = "/dev/kvm"
+	// minLibvirtVersion - the oldest libvirt vngen is tested with, 4.0.0
+	minLibvirtVersion = 4000000
+	// minFreeSpace - below this builds fail to create host disks
+	minFreeSpace = 5 << 30
+	// lowFreeSpace - below this hosts may fill the disk as they write to their overlays
+	lowFreeSpace = 20 << 30
+	// defaultNetwork - the network libvirt creates when it is installed
+	defaultNetwork = "default"
+)
+
+// Result - the outcome of a check, and how to fix it when it is not ok
+type Result struct {
+	Check   string
+	Status  string
+	Message string
+	Remedy  string `json:",omitempty"`
+}
+
+// binary - a program vngen runs, and how to install it
+type binary struct {
+	name     string
+	required bool
+	remedy   string
+}
+
+// binaries - the programs vngen runs, the optional ones are only needed by some templates
+var binaries = []binary{
+	{name: "qemu-img", required: true, remedy: "install qemu-utils on Debian/Ubuntu, qemu-img on Fedora/RHEL or qemu on Arch"},
+	{name: "cloud-localds", required: true, remedy: "install cloud-image-utils on Debian/Ubuntu or cloud-utils on Fedora/RHEL/Arch"},
+	{name: "ovs-vsctl", remedy: "install openvswitch-switch on Debian/Ubuntu or openvswitch elsewhere, it is only needed for ovs networks"},
+	{name: "iptables", remedy: "install iptables, it is only needed to forward ports to hosts"},
+}
+
+// emulators - where distributions install the QEMU binary
+var emulators = []string{"/usr/bin/qemu-system-x86_64", "/usr/libexec/qemu-kvm", "/usr/bin/qemu-kvm", "/usr/bin/kvm"}
+
+// Run - runs every check against the machine and the config
+func Run(c config.Config) (results []Result) {
+	results = append(results, CheckBinaries()...)
+	results = append(results,
+		CheckEmulator(c.Emulator),
+		CheckKVM(KVMDevice),
+		CheckLibvirt(c.LibvirtURI),
+		CheckDiskSpace(c.AppDir),
+		CheckDefaultNetwork(c.LibvirtURI),
+	)
+
+	return results
+}
+
+// Failed - reports whether any check failed
+func Failed(results []Result) bool {
+	for _, result := range results {
+		if result.Status == StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckBinaries - checks the programs vngen runs are on the PATH
+func CheckBinaries() (results []Result) {
+	for _, bin := range binaries {
+		check := "binary " + bin.name
+
+		path, err := exec.LookPath(bin.name)
+		if err == nil {
+			results = append(results, Result{Check: check, Status: StatusOK, Message: path})
+			continue
+		}
+
+		status := StatusWarning
+		if bin.required {
+			status = StatusFailed
+		}
+		results = append(results, Result{Check: check, Status: status, Message: fmt.Sprintf("%s is not on the PATH", bin.name), Remedy: bin.remedy})
+	}
+
+	return results
+}
+
+// CheckEmulator - checks the QEMU binary hosts are run with exists, suggesting one that does
+func CheckEmulator(path string) Result {
+	check := "emulator"
+
+	info, err := os.Stat(path)
+	if err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+		return Result{Check: check, Status: StatusOK, Message: path}
+	}
+
+	remedy := "install QEMU, e.g. qemu-system-x86 on Debian/Ubuntu or qemu-kvm on Fedora/RHEL"
+	for _, candidate := range emulators {
+		if candidate == path {
+			continue
+		}
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			remedy = fmt.Sprintf("set emulator: %s in %s, or VNGEN_EMULATOR=%s", candidate, config.DefaultPath, candidate)
+			break
+		}
+	}
+
+	return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("%s is not an executable", path), Remedy: remedy}
+}
+
+// CheckKVM - checks the KVM device exists and can be opened
+func CheckKVM(device string) Result {
+	check := "kvm"
+
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err == nil {
+		f.Close()
+		return Result{Check: check, Status: StatusOK, Message: device}
+	}
+
+	switch {
+	case os.IsNotExist(err):
+		return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("%s does not exist", device),
+			Remedy: "enable virtualisation (VT-x or AMD-V) in the firmware, or nested virtualisation on a VM, and load kvm_intel or kvm_amd with modprobe"}
+	case os.IsPermission(err):
+		return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("%s cannot be opened", device),
+			Remedy: "run vngen as root, or add the user to the kvm group"}
+	default:
+		return Result{Check: check, Status: StatusFailed, Message: err.Error(), Remedy: "check dmesg for KVM errors"}
+	}
+}
+
+// CheckLibvirt - checks libvirt can be connected to and is recent enough
+func CheckLibvirt(uri string) Result {
+	check := "libvirt"
+
+	conn, err := libvirt.NewConnect(uri)
+	if err != nil {
+		return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("cannot connect to %s: %s", uri, err),
+			Remedy: "start libvirt with systemctl enable --now libvirtd, or set libvirt_uri in " + config.DefaultPath}
+	}
+	defer conn.Close()
+
+	version, err := conn.GetLibVersion()
+	if err != nil {
+		return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("cannot get the version of %s: %s", uri, err),
+			Remedy: "restart libvirt with systemctl restart libvirtd"}
+	}
+
+	message := fmt.Sprintf("%s, libvirt %s", uri, formatVersion(version))
+	if hypervisor, err := conn.GetVersion(); err == nil && hypervisor > 0 {
+		message += fmt.Sprintf(", QEMU %s", formatVersion(hypervisor))
+	}
+	if version < minLibvirtVersion {
+		return Result{Check: check, Status: StatusWarning, Message: message + ", older than " + formatVersion(minLibvirtVersion),
+			Remedy: "upgrade libvirt, older versions are untested"}
+	}
+
+	return Result{Check: check, Status: StatusOK, Message: message}
+}
+
+// CheckDiskSpace - checks there is room in the directory, or the nearest one that exists, for host disks
+func CheckDiskSpace(dir string) Result {
+	check := "disk space"
+
+	// The app directory is only created by the first build
+	path := dir
+	stat := syscall.Statfs_t{}
+	for {
+		err := syscall.Statfs(path, &stat)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) || path == filepath.Dir(path) {
+			return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("cannot get the free space of %s: %s", dir, err),
+				Remedy: "set app_dir in " + config.DefaultPath + " to a directory on a local disk"}
+		}
+		path = filepath.Dir(path)
+	}
+
+	free := uint64(stat.Bavail) * uint64(stat.Bsize)
+	message := fmt.Sprintf("%s free in %s", formatBytes(free), dir)
+	remedy := "free space on the disk holding " + dir + ", or set app_dir in " + config.DefaultPath + " to a larger one"
+	switch {
+	case free < minFreeSpace:
+		return Result{Check: check, Status: StatusFailed, Message: message, Remedy: remedy}
+	case free < lowFreeSpace:
+		return Result{Check: check, Status: StatusWarning, Message: message, Remedy: remedy}
+	}
+
+	return Result{Check: check, Status: StatusOK, Message: message}
+}
+
+// CheckDefaultNetwork - checks libvirt's default network does not overlap the machine's interfaces or vngen's networks
+//
+// The default network fails to start when the machine is already on its
+// subnet, as it is when vngen runs in a VM on another libvirt machine, and
+// vngen networks on the subnet clash with it whenever it starts.
+func CheckDefaultNetwork(uri string) Result {
+	check := "default network"
+
+	conn, err := libvirt.NewConnect(uri)
+	if err != nil {
+		return Result{Check: check, Status: StatusWarning, Message: "skipped, libvirt cannot be connected to"}
+	}
+	defer conn.Close()
+
+	netwk, err := conn.LookupNetworkByName(defaultNetwork)
+	if err != nil {
+		return Result{Check: check, Status: StatusOK, Message: "libvirt has no default network"}
+	}
+	defer netwk.Free()
+
+	netXML, err := netwk.GetXMLDesc(0)
+	if err != nil {
+		return Result{Check: check, Status: StatusWarning, Message: fmt.Sprintf("cannot read the default network: %s", err)}
+	}
+	def := structs.Network{}
+	err = xml.Unmarshal([]byte(netXML), &def)
+	if err != nil {
+		return Result{Check: check, Status: StatusWarning, Message: fmt.Sprintf("cannot parse the default network: %s", err)}
+	}
+	subnet, bridge := defaultSubnet(def)
+	if subnet == nil {
+		return Result{Check: check, Status: StatusOK, Message: "the default network has no IPv4 address"}
+	}
+
+	conflicts, err := defaultConflicts(subnet, bridge)
+	if err != nil {
+		return Result{Check: check, Status: StatusWarning, Message: err.Error()}
+	}
+	if len(conflicts) > 0 {
+		return Result{Check: check, Status: StatusFailed, Message: fmt.Sprintf("%s overlaps %s", subnet, strings.Join(conflicts, ", ")),
+			Remedy: "give the default network another subnet with virsh net-edit default, or remove it with virsh net-destroy default and virsh net-undefine default"}
+	}
+
+	return Result{Check: check, Status: StatusOK, Message: subnet.String()}
+}
+
+// defaultSubnet - returns the IPv4 subnet and bridge of the network
+func defaultSubnet(def structs.Network) (subnet *net.IPNet, bridge string) {
+	if def.Bridge != nil {
+		bridge = def.Bridge.Name
+	}
+
+	for _, ip := range def.IP {
+		if ip.Family != "" && ip.Family != "ipv4" {
+			continue
+		}
+		netmask := ip.Netmask
+		if netmask == "" && ip.Prefix > 0 {
+			netmask = net.IP(net.CIDRMask(ip.Prefix, 32)).String()
+		}
+		subnet, err := ipam.ParseSubnet(ip.Address, netmask)
+		if err == nil {
+			return subnet, bridge
+		}
+	}
+
+	return nil, bridge
+}
+
+// defaultConflicts - returns the interfaces, other than the network's bridge, and vngen networks on the subnet
+func defaultConflicts(subnet *net.IPNet, bridge string) (conflicts []string, err error) {
+	ifaces, err := netutils.GetInterfaceNetworks()
+	if err != nil {
+		return nil, err
+	}
+	for name, subnets := range ifaces {
+		if name == bridge {
+			continue
+		}
+		for _, other := range subnets {
+			if ipam.Overlaps(subnet, other) {
+				conflicts = append(conflicts, fmt.Sprintf("interface %s", name))
+				break
+			}
+		}
+	}
+
+	// Nothing has been built while the database has no networks table
+	networks, _ := network.GetNetworks()
+	for _, netwk := range networks {
+		if netwk.IP == "" {
+			continue
+		}
+		other, err := ipam.ParseSubnet(netwk.IP, netwk.Netmask)
+		if err == nil && ipam.Overlaps(subnet, other) {
+			conflicts = append(conflicts, fmt.Sprintf("network %s", netwk.Name))
+		}
+	}
+	sort.Strings(conflicts)
+
+	return conflicts, nil
+}
+
+// formatVersion - returns a libvirt version, major * 1,000,000 + minor * 1,000 + release, as major.minor.release
+func formatVersion(version uint32) string {
+	return fmt.Sprintf("%d.%d.%d", version/1000000, version/1000%1000, version%1000)
+}
+
+// formatBytes - returns the size in GiB, or MiB when under a GiB
+func formatBytes(size uint64) string {
+	if size < 1<<30 {
+		return fmt.Sprintf("%d MiB", size>>20)
+	}
+	return fmt.Sprintf("%.1f GiB", float64(size)/(1<<30))
+}
@@ -0,0 +1,73 @@
+package doctor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nenvoy.com/pkg/doctor"
+)
+
+// TestCheckEmulator
+func TestCheckEmulator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen-doctor")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	emulator := filepath.Join(dir, "qemu-kvm")
+	err = ioutil.WriteFile(emulator, []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if result := doctor.CheckEmulator(emulator); result.Status != doctor.StatusOK {
+		t.Errorf("expected %s to pass, got %+v", emulator, result)
+	}
+
+	// Missing emulators fail with a way to fix them
+	result := doctor.CheckEmulator(filepath.Join(dir, "missing"))
+	if result.Status != doctor.StatusFailed || result.Remedy == "" {
+		t.Errorf("expected a missing emulator to fail with a remedy, got %+v", result)
+	}
+}
+
+// TestCheckKVM
+func TestCheckKVM(t *testing.T) {
+	result := doctor.CheckKVM("/dev/vngen-missing-kvm")
+	if result.Status != doctor.StatusFailed || !strings.Contains(result.Remedy, "modprobe") {
+		t.Errorf("expected a missing device to fail with a remedy, got %+v", result)
+	}
+}
+
+// TestCheckDiskSpace
+func TestCheckDiskSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen-doctor")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Directories not created yet are measured on their parent's disk
+	appDir := filepath.Join(dir, "lib", "vngen")
+	result := doctor.CheckDiskSpace(appDir)
+	if strings.HasPrefix(result.Message, "cannot") || !strings.HasSuffix(result.Message, "free in "+appDir) {
+		t.Errorf("expected the free space of %s, got %+v", appDir, result)
+	}
+}
+
+// TestFailed
+func TestFailed(t *testing.T) {
+	results := []doctor.Result{{Check: "kvm", Status: doctor.StatusOK}, {Check: "binary ovs-vsctl", Status: doctor.StatusWarning}}
+	if doctor.Failed(results) {
+		t.Errorf("expected warnings not to fail")
+	}
+
+	results = append(results, doctor.Result{Check: "libvirt", Status: doctor.StatusFailed})
+	if !doctor.Failed(results) {
+		t.Errorf("expected a failed check to fail")
+	}
+}
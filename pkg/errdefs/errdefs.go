@@ -0,0 +1,147 @@
+package errdefs
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Kinds of errors, which the api reports with their own status codes
+const (
+	// KindNotFound - the object does not exist
+	KindNotFound = "not_found"
+	// KindConflict - the object or a resource it needs is already in use
+	KindConflict = "conflict"
+	// KindInvalid - the template or request is invalid
+	KindInvalid = "invalid"
+	// KindUnauthorized - the request has no valid credentials
+	KindUnauthorized = "unauthorized"
+	// KindForbidden - the credentials do not allow the request
+	KindForbidden = "forbidden"
+	// KindInternal - anything else
+	KindInternal = "internal"
+)
+
+// kindError - an error marked with its kind, keeping its message
+type kindError struct {
+	error
+	kind string
+}
+
+// Cause - returns the marked error so errors.Cause still finds the root
+func (e kindError) Cause() error {
+	return e.error
+}
+
+// causer - errors wrapped by github.com/pkg/errors
+type causer interface {
+	Cause() error
+}
+
+// mark - marks the error with the kind, nil stays nil
+func mark(err error, kind string) error {
+	if err == nil {
+		return nil
+	}
+	return kindError{error: err, kind: kind}
+}
+
+// NotFound - marks the error as a missing object
+func NotFound(err error) error {
+	return mark(err, KindNotFound)
+}
+
+// NotFoundf - returns a missing object error with the message
+func NotFoundf(format string, args ...interface{}) error {
+	return NotFound(errors.Errorf(format, args...))
+}
+
+// Conflict - marks the error as an object or resource already in use
+func Conflict(err error) error {
+	return mark(err, KindConflict)
+}
+
+// Conflictf - returns a conflict error with the message
+func Conflictf(format string, args ...interface{}) error {
+	return Conflict(errors.Errorf(format, args...))
+}
+
+// Invalid - marks the error as an invalid template or request
+func Invalid(err error) error {
+	return mark(err, KindInvalid)
+}
+
+// Invalidf - returns an invalid template or request error with the message
+func Invalidf(format string, args ...interface{}) error {
+	return Invalid(errors.Errorf(format, args...))
+}
+
+// Unauthorized - marks the error as missing or invalid credentials
+func Unauthorized(err error) error {
+	return mark(err, KindUnauthorized)
+}
+
+// Unauthorizedf - returns a missing or invalid credentials error with the message
+func Unauthorizedf(format string, args ...interface{}) error {
+	return Unauthorized(errors.Errorf(format, args...))
+}
+
+// Forbidden - marks the error as a request the credentials do not allow
+func Forbidden(err error) error {
+	return mark(err, KindForbidden)
+}
+
+// Forbiddenf - returns a forbidden request error with the message
+func Forbiddenf(format string, args ...interface{}) error {
+	return Forbidden(errors.Errorf(format, args...))
+}
+
+// Kind - returns the kind of the error
+//
+// Every error wrapped around the one returned is searched, credentials
+// taking precedence over a missing object, a missing object over a conflict
+// and a conflict over an invalid request, so an invalid template failing on
+// a name already in use is a conflict.
+func Kind(err error) string {
+	found := map[string]bool{}
+	for err != nil {
+		if k, ok := err.(kindError); ok {
+			found[k.kind] = true
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+
+	for _, kind := range []string{KindUnauthorized, KindForbidden, KindNotFound, KindConflict, KindInvalid} {
+		if found[kind] {
+			return kind
+		}
+	}
+	return KindInternal
+}
+
+// IsNotFound - reports whether the error is a missing object
+func IsNotFound(err error) bool {
+	return Kind(err) == KindNotFound
+}
+
+// IsConflict - reports whether the error is an object or resource already in use
+func IsConflict(err error) bool {
+	return Kind(err) == KindConflict
+}
+
+// IsInvalid - reports whether the error is an invalid template or request
+func IsInvalid(err error) bool {
+	return Kind(err) == KindInvalid
+}
+
+// IsUnauthorized - reports whether the error is missing or invalid credentials
+func IsUnauthorized(err error) bool {
+	return Kind(err) == KindUnauthorized
+}
+
+// IsForbidden - reports whether the error is a request the credentials do not allow
+func IsForbidden(err error) bool {
+	return Kind(err) == KindForbidden
+}
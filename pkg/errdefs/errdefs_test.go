@@ -0,0 +1,43 @@
+package errdefs_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/errdefs"
+)
+
+// TestKind
+func TestKind(t *testing.T) {
+	root := errors.New("host web1 does not exist")
+
+	cases := []struct {
+		err  error
+		kind string
+	}{
+		{root, errdefs.KindInternal},
+		{errdefs.NotFound(root), errdefs.KindNotFound},
+		{errors.Wrap(errdefs.NotFound(root), "failed to start"), errdefs.KindNotFound},
+		{errdefs.Invalid(errors.Wrap(errdefs.Conflictf("mac in use"), "host web1")), errdefs.KindConflict},
+		{errdefs.Invalidf("bad cidr"), errdefs.KindInvalid},
+		{errdefs.Forbidden(errdefs.NotFoundf("host web1 not found")), errdefs.KindForbidden},
+	}
+
+	for _, c := range cases {
+		if kind := errdefs.Kind(c.err); kind != c.kind {
+			t.Errorf("%q: expected kind %s, got %s", c.err, c.kind, kind)
+		}
+	}
+
+	// Marking keeps the message and the root cause
+	err := errors.Wrap(errdefs.NotFound(root), "failed to start")
+	if err.Error() != "failed to start: host web1 does not exist" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if errors.Cause(err) != root {
+		t.Errorf("unexpected cause %v", errors.Cause(err))
+	}
+	if errdefs.NotFound(nil) != nil {
+		t.Errorf("marking nil should stay nil")
+	}
+}
@@ -0,0 +1,171 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Kinds of objects events are published for
+const (
+	// KindHost - a host's domain changed state
+	KindHost = "host"
+	// KindNetwork - a network changed state
+	KindNetwork = "network"
+	// KindDeployment - a deployment was built or destroyed
+	KindDeployment = "deployment"
+	// KindJob - a job progressed or finished
+	KindJob = "job"
+)
+
+// recentSize - the number of events kept for subscribers catching up after reconnecting
+const recentSize = 256
+
+// bufferSize - the number of events a subscriber can fall behind by before it is dropped
+const bufferSize = 64
+
+// Event - a change to a host, network, deployment or job
+type Event struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	Deployment string    `json:"deployment,omitempty"`
+	Action     string    `json:"action"`
+	Detail     string    `json:"detail,omitempty"`
+}
+
+// Filter - the events a subscriber receives, every event if empty
+type Filter struct {
+	Deployment string
+	Kinds      []string
+}
+
+// Match - reports whether the event passes the filter
+func (f Filter) Match(e Event) bool {
+	if f.Deployment != "" && f.Deployment != e.Deployment {
+		return false
+	}
+	if len(f.Kinds) == 0 {
+		return true
+	}
+	for _, kind := range f.Kinds {
+		if kind == e.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Broker - hands the events published to every subscriber whose filter they match
+type Broker struct {
+	mu     sync.Mutex
+	lastID uint64
+	recent []Event
+	subs   map[*Subscription]bool
+}
+
+// Subscription - the events received by a subscriber
+//
+// C is closed when the subscriber falls too far behind, so it can
+// subscribe again from the last event it received.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	filter Filter
+}
+
+// NewBroker - returns a broker with no subscribers
+func NewBroker() *Broker {
+	return &Broker{subs: map[*Subscription]bool{}}
+}
+
+// Publish - numbers and timestamps the event and hands it to the subscribers
+func (b *Broker) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.recent = append(b.recent, e)
+	if len(b.recent) > recentSize {
+		b.recent = b.recent[len(b.recent)-recentSize:]
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			// Drop subscribers that stop reading rather than blocking the publisher
+			delete(b.subs, sub)
+			close(sub.c)
+		}
+	}
+
+	return e
+}
+
+// Subscribe - returns a subscription to the events matching the filter, starting with the recent ones after the id
+func (b *Broker) Subscribe(filter Filter, after uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Replay what was missed, as long as it still fits in the buffer
+	missed := []Event{}
+	if after > 0 {
+		for _, e := range b.recent {
+			if e.ID > after && filter.Match(e) {
+				missed = append(missed, e)
+			}
+		}
+	}
+	if len(missed) > bufferSize {
+		missed = missed[len(missed)-bufferSize:]
+	}
+
+	c := make(chan Event, bufferSize+len(missed))
+	for _, e := range missed {
+		c <- e
+	}
+
+	sub := &Subscription{C: c, c: c, filter: filter}
+	b.subs[sub] = true
+	return sub
+}
+
+// Unsubscribe - stops the subscription and closes its channel
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subs[sub] {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// defaultBroker - the broker of the running process
+var defaultBroker = NewBroker()
+
+// Publish - publishes the event to the subscribers of the running process, keeping it if Keep was called
+func Publish(e Event) Event {
+	e = defaultBroker.Publish(e)
+	keep(e)
+	return e
+}
+
+// Subscribe - subscribes to the events of the running process
+func Subscribe(filter Filter, after uint64) *Subscription {
+	return defaultBroker.Subscribe(filter, after)
+}
+
+// Unsubscribe - stops a subscription to the events of the running process
+func Unsubscribe(sub *Subscription) {
+	defaultBroker.Unsubscribe(sub)
+}
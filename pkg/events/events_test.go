@@ -0,0 +1,58 @@
+package events_test
+
+import (
+	"testing"
+
+	"nenvoy.com/pkg/events"
+)
+
+// TestBroker
+func TestBroker(t *testing.T) {
+	b := events.NewBroker()
+
+	lab := b.Subscribe(events.Filter{Deployment: "lab"}, 0)
+	hosts := b.Subscribe(events.Filter{Kinds: []string{events.KindHost}}, 0)
+
+	first := b.Publish(events.Event{Kind: events.KindHost, Name: "web1", Deployment: "lab", Action: "started"})
+	b.Publish(events.Event{Kind: events.KindNetwork, Name: "br0", Deployment: "lab", Action: "started"})
+	b.Publish(events.Event{Kind: events.KindHost, Name: "db1", Deployment: "prod", Action: "stopped"})
+
+	// Subscribers only receive the events matching their filter
+	for _, want := range []string{"web1", "br0"} {
+		if e := <-lab.C; e.Name != want {
+			t.Errorf("expected %s on the lab subscription, got %s", want, e.Name)
+		}
+	}
+	for _, want := range []string{"web1", "db1"} {
+		if e := <-hosts.C; e.Name != want {
+			t.Errorf("expected %s on the hosts subscription, got %s", want, e.Name)
+		}
+	}
+	if first.ID == 0 || first.Time.IsZero() {
+		t.Errorf("published events should be numbered and timestamped, got %+v", first)
+	}
+
+	// Reconnecting subscribers catch up from the last id they received
+	again := b.Subscribe(events.Filter{Deployment: "lab"}, first.ID)
+	if e := <-again.C; e.Name != "br0" {
+		t.Errorf("expected to catch up with br0, got %s", e.Name)
+	}
+
+	// Subscribers that stop reading are dropped rather than blocking
+	for i := 0; i < 100; i++ {
+		b.Publish(events.Event{Kind: events.KindHost, Name: "web1", Deployment: "lab", Action: "started"})
+	}
+	count := 0
+	for range again.C {
+		count++
+	}
+	if count == 0 || count >= 100 {
+		t.Errorf("expected the slow subscriber to be dropped after filling its buffer, received %d", count)
+	}
+
+	quiet := b.Subscribe(events.Filter{}, 0)
+	b.Unsubscribe(quiet)
+	if _, ok := <-quiet.C; ok {
+		t.Errorf("expected the subscription to be closed")
+	}
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"nenvoy.com/pkg/database"
+)
+
+// historySize - the number of events kept in the database
+const historySize = 1000
+
+// History - Struct for a published event kept in the database
+type History struct {
+	gorm.Model
+	Time       time.Time
+	Kind       string
+	Name       string
+	Deployment string
+	Action     string
+	Detail     string
+}
+
+// keeping - set once the events of the running process are kept in the database
+var keeping int32
+
+// Keep - keeps the events published from now on in the database, so describe can show them later
+func Keep() {
+	atomic.StoreInt32(&keeping, 1)
+}
+
+// Recent - returns the last events of the object, oldest first
+//
+// The events of a deployment include those of its hosts, networks and jobs.
+func Recent(kind string, name string, limit int) (recent []Event, err error) {
+	db, err := historySession()
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Order("id desc").Limit(limit)
+	if kind == KindDeployment {
+		query = query.Where("deployment = ?", name)
+	} else {
+		query = query.Where("kind = ? AND name = ?", kind, name)
+	}
+
+	rows := []History{}
+	err = query.Find(&rows).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find events")
+	}
+
+	recent = []Event{}
+	for i := len(rows) - 1; i >= 0; i-- {
+		row := rows[i]
+		recent = append(recent, Event{ID: uint64(row.ID), Time: row.Time, Kind: row.Kind, Name: row.Name, Deployment: row.Deployment, Action: row.Action, Detail: row.Detail})
+	}
+
+	return recent, nil
+}
+
+// keep - records the event in the database if events are being kept, dropping the oldest
+func keep(e Event) {
+	if atomic.LoadInt32(&keeping) == 0 {
+		return
+	}
+
+	db, err := historySession()
+	if err != nil {
+		return
+	}
+
+	row := History{Time: e.Time, Kind: e.Kind, Name: e.Name, Deployment: e.Deployment, Action: e.Action, Detail: e.Detail}
+	err = db.Create(&row).Error
+	if err != nil || row.ID <= historySize {
+		return
+	}
+	db.Unscoped().Where("id <= ?", row.ID-historySize).Delete(&History{})
+}
+
+// historySession - returns a database session with the event history migrated
+func historySession() (db *gorm.DB, err error) {
+	db, err = database.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&History{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to migrate database: ")
+	}
+
+	return db, nil
+}
@@ -0,0 +1,165 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	libvirt "libvirt.org/libvirt-go"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/network"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+// reconnectDelay - how long to wait before reconnecting to libvirt
+const reconnectDelay = 5 * time.Second
+
+// domainActions - the actions published for each domain lifecycle event
+var domainActions = map[libvirt.DomainEventType]string{
+	libvirt.DOMAIN_EVENT_DEFINED:     "defined",
+	libvirt.DOMAIN_EVENT_UNDEFINED:   "undefined",
+	libvirt.DOMAIN_EVENT_STARTED:     "started",
+	libvirt.DOMAIN_EVENT_SUSPENDED:   "suspended",
+	libvirt.DOMAIN_EVENT_RESUMED:     "resumed",
+	libvirt.DOMAIN_EVENT_STOPPED:     "stopped",
+	libvirt.DOMAIN_EVENT_SHUTDOWN:    "shutdown",
+	libvirt.DOMAIN_EVENT_PMSUSPENDED: "suspended",
+	libvirt.DOMAIN_EVENT_CRASHED:     "crashed",
+}
+
+// networkActions - the actions published for each network lifecycle event
+var networkActions = map[libvirt.NetworkEventLifecycleType]string{
+	libvirt.NETWORK_EVENT_DEFINED:   "defined",
+	libvirt.NETWORK_EVENT_UNDEFINED: "undefined",
+	libvirt.NETWORK_EVENT_STARTED:   "started",
+	libvirt.NETWORK_EVENT_STOPPED:   "stopped",
+}
+
+// eventLoop - starts libvirt's event loop once, which must happen before connecting
+var eventLoop sync.Once
+
+// WatchLibvirt - publishes the lifecycle events of libvirt's domains and networks until ctx is done
+//
+// The connection is kept alive and made again whenever libvirt goes away.
+func WatchLibvirt(ctx context.Context) {
+	watchLibvirt(ctx, Publish)
+}
+
+// WatchLibvirt - publishes the lifecycle events of libvirt's domains and networks to the broker's subscribers only
+func (b *Broker) WatchLibvirt(ctx context.Context) {
+	watchLibvirt(ctx, b.Publish)
+}
+
+// watchLibvirt - publishes libvirt's events with publish until ctx is done, reconnecting when libvirt goes away
+func watchLibvirt(ctx context.Context, publish func(e Event) Event) {
+	eventLoop.Do(func() {
+		err := libvirt.EventRegisterDefaultImpl()
+		if err != nil {
+			printing.PrintError(fmt.Sprintf("Could not start the libvirt event loop: %s", err))
+			return
+		}
+		go func() {
+			for {
+				libvirt.EventRunDefaultImpl()
+			}
+		}()
+	})
+
+	for {
+		err := watch(ctx, publish)
+		if ctx.Err() != nil {
+			return
+		}
+		printing.PrintWarning(fmt.Sprintf("Lost the libvirt event connection, reconnecting: %s", err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// watch - publishes events from one connection, until it dies or ctx is done
+func watch(ctx context.Context, publish func(e Event) Event) (err error) {
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to qemu")
+	}
+	defer conn.Close()
+
+	// Notice libvirt going away
+	err = conn.SetKeepAlive(5, 3)
+	if err != nil {
+		return errors.Wrap(err, "failed to keep the connection alive")
+	}
+
+	domainCallback, err := conn.DomainEventLifecycleRegister(nil, func(c *libvirt.Connect, d *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+		name, err := d.GetName()
+		if err != nil {
+			return
+		}
+		publish(Event{Kind: KindHost, Name: name, Deployment: hostDeployment(name), Action: domainActions[event.Event]})
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch domains")
+	}
+	defer conn.DomainEventDeregister(domainCallback)
+
+	networkCallback, err := conn.NetworkEventLifecycleRegister(nil, func(c *libvirt.Connect, n *libvirt.Network, event *libvirt.NetworkEventLifecycle) {
+		name, err := n.GetName()
+		if err != nil {
+			return
+		}
+		publish(Event{Kind: KindNetwork, Name: name, Deployment: networkDeployment(name), Action: networkActions[event.Event]})
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch networks")
+	}
+	defer conn.NetworkEventDeregister(networkCallback)
+
+	ticker := time.NewTicker(reconnectDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			alive, err := conn.IsAlive()
+			if err != nil || !alive {
+				return errors.New("the connection to qemu closed")
+			}
+		}
+	}
+}
+
+// hostDeployment - returns the name of the deployment the host is in, if vngen built it
+func hostDeployment(name string) string {
+	hst, err := host.GetHostByName(name)
+	if err != nil || hst.Name == "" {
+		return ""
+	}
+	return deploymentName(hst.DeploymentID)
+}
+
+// networkDeployment - returns the name of the deployment the network is in, if vngen built it
+func networkDeployment(name string) string {
+	netwk, err := network.GetNetworkByName(name)
+	if err != nil || netwk.Name == "" {
+		return ""
+	}
+	return deploymentName(netwk.DeploymentID)
+}
+
+// deploymentName - returns the name of the deployment with the id
+func deploymentName(id uint) string {
+	dep, err := deployment.GetDeploymentByID(id)
+	if err != nil {
+		return ""
+	}
+	return dep.Name
+}
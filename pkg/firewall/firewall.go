@@ -0,0 +1,300 @@
+package firewall
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	libvirt "libvirt.org/libvirt-go"
+
+	"nenvoy.com/pkg/config"
+	structs "nenvoy.com/pkg/constants"
+)
+
+// Policies and actions of the firewall
+const (
+	// Allow - accept the traffic
+	Allow = "allow"
+	// Deny - drop the traffic
+	Deny = "deny"
+)
+
+// Directions of firewall rules, relative to the host
+const (
+	// In - traffic to the host
+	In = "in"
+	// Out - traffic from the host
+	Out = "out"
+)
+
+// Priorities of the generated rules, lower runs first
+const (
+	priorityEstablished = 100
+	priorityRules       = 200
+	priorityDefault     = 900
+)
+
+var protocols = map[string]bool{"all": true, "tcp": true, "udp": true, "icmp": true}
+
+// FilterName - returns the name of the filter of a host interface
+func FilterName(hostName string, index int) string {
+	return fmt.Sprintf("vngen-%s-%d", hostName, index)
+}
+
+// Validate - defaults the policies and checks the rules of a firewall
+func Validate(def *structs.FirewallDefinition) (err error) {
+	// Only the listed traffic is let in, everything is let out
+	def.Ingress = strings.ToLower(def.Ingress)
+	if def.Ingress == "" {
+		def.Ingress = Deny
+	}
+	def.Egress = strings.ToLower(def.Egress)
+	if def.Egress == "" {
+		def.Egress = Allow
+	}
+	if def.Ingress != Allow && def.Ingress != Deny {
+		return errors.Errorf("firewall: unknown ingress policy %s, expected allow or deny", def.Ingress)
+	}
+	if def.Egress != Allow && def.Egress != Deny {
+		return errors.Errorf("firewall: unknown egress policy %s, expected allow or deny", def.Egress)
+	}
+
+	for i := range def.Rules {
+		rule := &def.Rules[i]
+
+		rule.Action = strings.ToLower(rule.Action)
+		if rule.Action != Allow && rule.Action != Deny {
+			return errors.Errorf("firewall rule %d: unknown action %q, expected allow or deny", i, rule.Action)
+		}
+
+		rule.Direction = strings.ToLower(rule.Direction)
+		if rule.Direction == "" {
+			rule.Direction = In
+		}
+		if rule.Direction != In && rule.Direction != Out {
+			return errors.Errorf("firewall rule %d: unknown direction %s, expected in or out", i, rule.Direction)
+		}
+
+		rule.Protocol = strings.ToLower(rule.Protocol)
+		if rule.Protocol == "" {
+			rule.Protocol = "all"
+		}
+		if !protocols[rule.Protocol] {
+			return errors.Errorf("firewall rule %d: unknown protocol %s, expected all, tcp, udp or icmp", i, rule.Protocol)
+		}
+
+		if rule.Port != "" {
+			if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+				return errors.Errorf("firewall rule %d: ports need the tcp or udp protocol", i)
+			}
+			if _, _, err := parsePorts(rule.Port); err != nil {
+				return errors.Wrapf(err, "firewall rule %d", i)
+			}
+		}
+
+		if rule.CIDR != "" {
+			if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+				return errors.Errorf("firewall rule %d: invalid cidr %q", i, rule.CIDR)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Compile - creates the nwfilter XML of a validated firewall
+func Compile(name string, def structs.FirewallDefinition) (filterDef string, err error) {
+	filter := structs.NWFilter{Name: name, Chain: "root"}
+
+	// Keep ARP and DHCP working whatever the policy
+	filter.FilterRef = []structs.NWFilterRef{{Filter: "allow-arp"}, {Filter: "allow-dhcp"}}
+
+	// Replies to allowed connections
+	for _, family := range []string{"ipv4", "ipv6"} {
+		established := structs.NWFilterRule{Action: "accept", Direction: "inout", Priority: priorityEstablished}
+		setMatch(&established, "all", family, &structs.NWFilterMatch{State: "ESTABLISHED,RELATED"})
+		filter.Rule = append(filter.Rule, established)
+	}
+
+	for i, rule := range def.Rules {
+		filterRules, err := compileRule(rule, priorityRules+i)
+		if err != nil {
+			return "", errors.Wrapf(err, "firewall rule %d", i)
+		}
+		filter.Rule = append(filter.Rule, filterRules...)
+	}
+
+	// Policies for everything the rules did not match
+	for _, policy := range []struct{ direction, action string }{{In, def.Ingress}, {Out, def.Egress}} {
+		if policy.action != Deny {
+			continue
+		}
+		for _, family := range []string{"ipv4", "ipv6"} {
+			drop := structs.NWFilterRule{Action: "drop", Direction: policy.direction, Priority: priorityDefault}
+			setMatch(&drop, "all", family, &structs.NWFilterMatch{})
+			filter.Rule = append(filter.Rule, drop)
+		}
+	}
+
+	xmlBytes, err := xml.MarshalIndent(filter, "", "	")
+	if err != nil {
+		return "", err
+	}
+
+	return string(xmlBytes), nil
+}
+
+// compileRule - converts a rule to nwfilter rules, one per address family it applies to
+func compileRule(rule structs.FirewallRuleDefinition, priority int) (filterRules []structs.NWFilterRule, err error) {
+	match := structs.NWFilterMatch{}
+	families := []string{"ipv4", "ipv6"}
+
+	// New connections only, replies are let through by the established rule
+	if rule.Action == Allow {
+		match.State = "NEW"
+	}
+
+	if rule.Port != "" {
+		match.DstPortStart, match.DstPortEnd, err = parsePorts(rule.Port)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The cidr is the other end of the traffic
+	if rule.CIDR != "" {
+		_, subnet, err := net.ParseCIDR(rule.CIDR)
+		if err != nil {
+			return nil, err
+		}
+		ones, bits := subnet.Mask.Size()
+		families = []string{"ipv4"}
+		if bits == 128 {
+			families = []string{"ipv6"}
+		}
+		if ones > 0 {
+			if rule.Direction == In {
+				match.SrcIPAddr, match.SrcIPMask = subnet.IP.String(), ones
+			} else {
+				match.DstIPAddr, match.DstIPMask = subnet.IP.String(), ones
+			}
+		}
+	}
+
+	action := "accept"
+	if rule.Action == Deny {
+		action = "drop"
+	}
+
+	for _, family := range families {
+		filterRule := structs.NWFilterRule{Action: action, Direction: rule.Direction, Priority: priority}
+		m := match
+		setMatch(&filterRule, rule.Protocol, family, &m)
+		filterRules = append(filterRules, filterRule)
+	}
+
+	return filterRules, nil
+}
+
+// setMatch - sets the protocol element of the rule for the address family
+func setMatch(rule *structs.NWFilterRule, protocol string, family string, match *structs.NWFilterMatch) {
+	ipv6 := family == "ipv6"
+
+	switch protocol {
+	case "tcp":
+		if ipv6 {
+			rule.TCPv6 = match
+		} else {
+			rule.TCP = match
+		}
+	case "udp":
+		if ipv6 {
+			rule.UDPv6 = match
+		} else {
+			rule.UDP = match
+		}
+	case "icmp":
+		if ipv6 {
+			rule.ICMPv6 = match
+		} else {
+			rule.ICMP = match
+		}
+	default:
+		if ipv6 {
+			rule.AllIPv6 = match
+		} else {
+			rule.All = match
+		}
+	}
+}
+
+// parsePorts - parses a port or a range of ports written as start-end
+func parsePorts(ports string) (start int, end int, err error) {
+	bounds := strings.SplitN(ports, "-", 2)
+
+	start, err = strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil || start < 1 || start > 65535 {
+		return 0, 0, errors.Errorf("invalid port %q", ports)
+	}
+	if len(bounds) == 1 {
+		return start, 0, nil
+	}
+
+	end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil || end < start || end > 65535 {
+		return 0, 0, errors.Errorf("invalid port range %q", ports)
+	}
+
+	return start, end, nil
+}
+
+// Define - creates or updates the filter, running hosts pick up the change immediately
+func Define(name string, def structs.FirewallDefinition) (err error) {
+	filterDef, err := Compile(name, def)
+	if err != nil {
+		return err
+	}
+
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	filter, err := conn.NWFilterDefineXML(filterDef)
+	if err != nil {
+		return errors.Wrapf(err, "failed to define filter %s", name)
+	}
+	defer filter.Free()
+
+	return nil
+}
+
+// Undefine - removes the filter, ignoring filters that do not exist
+func Undefine(name string) (err error) {
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	filter, err := conn.LookupNWFilterByName(name)
+	if lverr, ok := err.(libvirt.Error); ok && lverr.Code == libvirt.ERR_NO_NWFILTER {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer filter.Free()
+
+	err = filter.Undefine()
+	if err != nil {
+		return errors.Wrapf(err, "failed to undefine filter %s", name)
+	}
+
+	return nil
+}
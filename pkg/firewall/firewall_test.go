@@ -0,0 +1,64 @@
+package firewall_test
+
+import (
+	"strings"
+	"testing"
+
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/firewall"
+)
+
+// TestCompile
+func TestCompile(t *testing.T) {
+	def := structs.FirewallDefinition{
+		Rules: []structs.FirewallRuleDefinition{
+			{Action: "allow", Protocol: "tcp", Port: "22", CIDR: "10.0.0.0/8"},
+			{Action: "deny", Direction: "out", Protocol: "udp", Port: "5000-5100"},
+		},
+	}
+
+	err := firewall.Validate(&def)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if def.Ingress != firewall.Deny || def.Egress != firewall.Allow {
+		t.Errorf("unexpected default policies %s and %s", def.Ingress, def.Egress)
+	}
+
+	filterDef, err := firewall.Compile(firewall.FilterName("dmz", 0), def)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	for _, want := range []string{
+		`<filter name="vngen-dmz-0" chain="root">`,
+		`<filterref filter="allow-dhcp"></filterref>`,
+		`<tcp srcipaddr="10.0.0.0" srcipmask="8" dstportstart="22" state="NEW"></tcp>`,
+		`<udp-ipv6 dstportstart="5000" dstportend="5100"></udp-ipv6>`,
+		`<rule action="drop" direction="in" priority="900">`,
+	} {
+		if !strings.Contains(filterDef, want) {
+			t.Errorf("filter is missing %s:\n%s", want, filterDef)
+		}
+	}
+	if strings.Contains(filterDef, `direction="out" priority="900"`) {
+		t.Errorf("egress should not be denied:\n%s", filterDef)
+	}
+}
+
+// TestValidate
+func TestValidate(t *testing.T) {
+	bad := []structs.FirewallRuleDefinition{
+		{Action: "reject"},
+		{Action: "allow", Protocol: "icmp", Port: "22"},
+		{Action: "allow", Protocol: "tcp", Port: "100-10"},
+		{Action: "allow", CIDR: "10.0.0.0"},
+	}
+
+	for _, rule := range bad {
+		def := structs.FirewallDefinition{Rules: []structs.FirewallRuleDefinition{rule}}
+		if err := firewall.Validate(&def); err == nil {
+			t.Errorf("expected rule %+v to be invalid", rule)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package host
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/pkg/errors"
+	libvirt "libvirt.org/libvirt-go"
+	"nenvoy.com/pkg/config"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/firewall"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+// encodeFirewall - validates a firewall and encodes it for the database
+func encodeFirewall(def structs.FirewallDefinition) (encoded string, err error) {
+	// Copy the rules so that defaulting them leaves the template alone
+	def.Rules = append([]structs.FirewallRuleDefinition(nil), def.Rules...)
+
+	err = firewall.Validate(&def)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(def)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// GetFirewall - returns the interface's firewall, nil if it has none
+func (i Interface) GetFirewall() (def *structs.FirewallDefinition, err error) {
+	if i.Firewall == "" {
+		return nil, nil
+	}
+
+	def = &structs.FirewallDefinition{}
+	err = json.Unmarshal([]byte(i.Firewall), def)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid firewall on interface %d", i.Index)
+	}
+
+	return def, nil
+}
+
+// defineFilters - defines the firewalls of the host's interfaces
+func (h *Host) defineFilters() (err error) {
+	for _, iface := range h.Interfaces {
+		def, err := iface.GetFirewall()
+		if err != nil {
+			return err
+		}
+		if def == nil {
+			continue
+		}
+
+		err = firewall.Define(firewall.FilterName(h.Name, iface.Index), *def)
+		if err != nil {
+			return errors.Wrapf(err, "host %s", h.Name)
+		}
+	}
+
+	return nil
+}
+
+// undefineFilters - removes the firewalls of the host's interfaces
+func (h *Host) undefineFilters() (err error) {
+	for _, iface := range h.Interfaces {
+		if iface.Firewall == "" {
+			continue
+		}
+
+		err = firewall.Undefine(firewall.FilterName(h.Name, iface.Index))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetInterfaces - returns the host's interfaces
+func (h *Host) GetInterfaces() (ifaces []Interface, err error) {
+	err = h.loadInterfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Interfaces, nil
+}
+
+// SetFirewall - replaces the firewall of the host's interfaces on the network, or of all its interfaces
+//
+// Filters already referenced by the host are updated in place, which running
+// hosts pick up immediately. Interfaces without a firewall have one attached.
+func (h *Host) SetFirewall(networkName string, def structs.FirewallDefinition) (err error) {
+	err = h.loadInterfaces()
+	if err != nil {
+		return err
+	}
+
+	encoded, err := encodeFirewall(def)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range h.Interfaces {
+		iface := &h.Interfaces[i]
+		if networkName != "" && iface.Network != networkName {
+			continue
+		}
+		found = true
+
+		attached := iface.Firewall != ""
+		iface.Firewall = encoded
+
+		decoded, err := iface.GetFirewall()
+		if err != nil {
+			return err
+		}
+		err = firewall.Define(firewall.FilterName(h.Name, iface.Index), *decoded)
+		if err != nil {
+			return err
+		}
+
+		if !attached {
+			err = h.attachFilter(*iface)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = db.Save(iface).Error
+		if err != nil {
+			return errors.Wrap(err, "could not save interface")
+		}
+
+		printing.PrintSuccess(fmt.Sprintf("Applied firewall to host %s on network %s", h.Name, iface.Network))
+	}
+
+	if !found {
+		return errors.Errorf("host %s has no interface on network %s", h.Name, networkName)
+	}
+
+	return nil
+}
+
+// attachFilter - adds the interface's filter reference to the domain
+func (h *Host) attachFilter(hostIface Interface) (err error) {
+	// The interface type has no element name of its own
+	var ifaceDef bytes.Buffer
+	err = xml.NewEncoder(&ifaceDef).EncodeElement(h.interfaceXML(hostIface), xml.StartElement{Name: xml.Name{Local: "interface"}})
+	if err != nil {
+		return err
+	}
+
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	dom, err := conn.LookupDomainByName(h.Name)
+	if err != nil {
+		return err
+	}
+	defer dom.Free()
+
+	// Change the running host as well as its config
+	flags := libvirt.DOMAIN_DEVICE_MODIFY_CONFIG
+	active, err := dom.IsActive()
+	if err != nil {
+		return err
+	}
+	if active {
+		flags |= libvirt.DOMAIN_DEVICE_MODIFY_LIVE
+	}
+
+	err = dom.UpdateDeviceFlags(ifaceDef.String(), flags)
+	if err != nil {
+		return errors.Wrapf(err, "failed to attach firewall to host %s", h.Name)
+	}
+
+	return nil
+}
@@ -1,36 +1,59 @@
 package host
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 
+	"nenvoy.com/pkg/config"
 	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/network"
 	"nenvoy.com/pkg/utils/printing"
 
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
 	libvirt "libvirt.org/libvirt-go"
-	"nenvoy.com/pkg/constants"
 	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/errdefs"
 	cmd "nenvoy.com/pkg/utils/cmd"
 	"nenvoy.com/pkg/utils/files"
 )
 
-var errNameUsed = errors.New("Host name already used")
+var errNameUsed = errdefs.Conflictf("Host name already used")
+
+// Host roles
+const (
+	// RoleRouter - forwards traffic between the networks it is attached to
+	RoleRouter = "router"
+)
+
+// routerUserData - the cloud-config enabling ip forwarding on routers
+const routerUserData = `write_files:
+  - path: /etc/sysctl.d/90-vngen-router.conf
+    content: |
+      net.ipv4.ip_forward=1
+      net.ipv6.conf.all.forwarding=1
+runcmd:
+  - [sysctl, --system]
+`
 
 //Host - Struct for the host data in the database
 type Host struct {
 	gorm.Model
 	Name         string
 	Image        string
+	Role         string
 	RAM          int
 	CPUs         int
 	Username     string
 	Password     string
 	HDSpace      string
 	DeploymentID uint
+	Interfaces   []Interface
+	Ports        []PortForward
 }
 
 // NetworkDetails - Struct for returning network details
@@ -38,10 +61,26 @@ type NetworkDetails struct {
 	Name       string
 	MacAddress string
 	IPv4       string
+	IPv6       string
+}
+
+// TapDevice - Struct for the tap device backing a host interface
+type TapDevice struct {
+	Name       string
+	Network    string
+	MacAddress string
+}
+
+// DiskDetails - Struct for a disk of a host and the image it is backed by
+type DiskDetails struct {
+	Device       string
+	File         string
+	Format       string
+	BackingImage string
 }
 
 // createHostXML - Create the host domain
-func (h *Host) createHostXML(networks []string) (domainDef string, err error) {
+func (h *Host) createHostXML() (domainDef string, err error) {
 	//Define the domain object for libvirt
 	domain := structs.Domain{}
 
@@ -65,7 +104,7 @@ func (h *Host) createHostXML(networks []string) (domainDef string, err error) {
 	domain.OnCrash = "restart"
 
 	// Set the device values
-	domain.Devices.Emulator = "/usr/bin/qemu-system-x86_64"
+	domain.Devices.Emulator = config.Get().Emulator
 
 	// Create the disks that are required
 	err = h.createHostDisks()
@@ -79,7 +118,7 @@ func (h *Host) createHostXML(networks []string) (domainDef string, err error) {
 	mainHD.Device = "disk"
 	mainHD.Driver.Name = "qemu"
 	mainHD.Driver.Type = "qcow2"
-	mainHD.Source.File = fmt.Sprintf("/var/lib/nenvn/machines/%s/%s.qcow2", h.Name, h.Name)
+	mainHD.Source.File = filepath.Join(config.Get().MachineDir(h.Name), h.Name+".qcow2")
 	mainHD.Target.Dev = "vda"
 	mainHD.Target.Bus = "virtio"
 
@@ -91,19 +130,14 @@ func (h *Host) createHostXML(networks []string) (domainDef string, err error) {
 	cloudInitHD.Device = "disk"
 	cloudInitHD.Driver.Name = "qemu"
 	cloudInitHD.Driver.Type = "raw"
-	cloudInitHD.Source.File = fmt.Sprintf("/var/lib/nenvn/machines/%s/%s-seed.qcow2", h.Name, h.Name)
+	cloudInitHD.Source.File = filepath.Join(config.Get().MachineDir(h.Name), h.Name+"-seed.qcow2")
 	cloudInitHD.Target.Dev = "vdb"
 	cloudInitHD.Target.Bus = "virtio"
 	domain.Devices.Disk = append(domain.Devices.Disk, cloudInitHD)
 
 	// Setup the interfaces
-	for _, network := range networks {
-		iface := structs.Interface{}
-		iface.Type = "network"
-		iface.Source.Network = network
-		iface.Model.Name = "isa_serial"
-		iface.Model.Type = "virtio"
-		domain.Devices.Interface = append(domain.Devices.Interface, iface)
+	for _, hostIface := range h.Interfaces {
+		domain.Devices.Interface = append(domain.Devices.Interface, h.interfaceXML(hostIface))
 	}
 
 	//Serial and console connection
@@ -125,7 +159,7 @@ func (h *Host) createHostXML(networks []string) (domainDef string, err error) {
 // Start - starts the VM
 func (h *Host) Start() (err error) {
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
@@ -143,6 +177,16 @@ func (h *Host) Start() (err error) {
 		return err
 	}
 
+	// Restore port forwards lost since the hypervisor restarted
+	err = h.loadPorts()
+	if err != nil {
+		return err
+	}
+	err = h.applyPorts()
+	if err != nil {
+		return err
+	}
+
 	printing.PrintSuccess(fmt.Sprintf("Started host %s", h.Name))
 	return nil
 }
@@ -150,7 +194,7 @@ func (h *Host) Start() (err error) {
 // Restart - restarts the VM
 func (h *Host) Restart() (err error) {
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
@@ -175,7 +219,7 @@ func (h *Host) Restart() (err error) {
 // Stop - stops the VM
 func (h *Host) Stop() (err error) {
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
@@ -200,7 +244,7 @@ func (h *Host) Stop() (err error) {
 // Destroy - destroy the VM
 func (h *Host) Destroy() (err error) {
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
@@ -232,16 +276,44 @@ func (h *Host) Destroy() (err error) {
 		return err
 	}
 
+	// Remove the DHCP reservations from the networks
+	err = h.loadInterfaces()
+	if err != nil {
+		return err
+	}
+	err = h.release()
+	if err != nil {
+		printing.PrintWarning(fmt.Sprintf("Could not release reservations of host %s: %s", h.Name, err.Error()))
+	}
+
+	// Remove the firewalls, which can only go once the domain is undefined
+	err = h.undefineFilters()
+	if err != nil {
+		printing.PrintWarning(fmt.Sprintf("Could not remove firewall of host %s: %s", h.Name, err.Error()))
+	}
+
+	// Remove the port forwards
+	err = h.loadPorts()
+	if err != nil {
+		return err
+	}
+	err = h.removePorts()
+	if err != nil {
+		printing.PrintWarning(fmt.Sprintf("Could not remove port forwards of host %s: %s", h.Name, err.Error()))
+	}
+
 	db, err := database.NewSession()
 	if err != nil {
 		return err
 	}
 
 	// Remove from the database
+	db.Where("host_id = ?", h.ID).Delete(&Interface{})
+	db.Where("host_id = ?", h.ID).Delete(&PortForward{})
 	db.Delete(&h)
 
 	// Remove the machine directory
-	err = files.RemoveDirectories([]string{fmt.Sprintf("%s/machines/%s", constants.AppDir, h.Name)})
+	err = files.RemoveDirectories([]string{config.Get().MachineDir(h.Name)})
 	if err != nil {
 		return errors.Wrap(err, "failed to remove directories")
 	}
@@ -251,25 +323,54 @@ func (h *Host) Destroy() (err error) {
 }
 
 // CreateHost - Creates the host domain from the XML template
-func (h *Host) CreateHost(networks []string) (err error) {
+func (h *Host) CreateHost() (err error) {
 	// Get the xml hosts
-	hostDef, err := h.createHostXML(networks)
+	hostDef, err := h.createHostXML()
 	if err != nil {
 		return err
 	}
 
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
+	// Define the firewalls the interfaces refer to
+	err = h.defineFilters()
+	if err != nil {
+		h.undefineFilters()
+		return err
+	}
+
 	// Define the domain
-	_, err = conn.DomainDefineXML(hostDef)
+	dom, err := conn.DomainDefineXML(hostDef)
+	if err != nil {
+		h.undefineFilters()
+		return err
+	}
+	defer dom.Free()
+
+	// Reserve the fixed addresses on the networks
+	err = h.reserve()
+	if err != nil {
+		h.release()
+		dom.Undefine()
+		h.undefineFilters()
+		return err
+	}
+
+	// Forward the hypervisor ports
+	err = h.applyPorts()
 	if err != nil {
+		h.removePorts()
+		h.release()
+		dom.Undefine()
+		h.undefineFilters()
 		return err
 	}
+
 	return nil
 }
 
@@ -277,7 +378,7 @@ func (h *Host) CreateHost(networks []string) (err error) {
 func (h *Host) GetHostState() (state string, err error) {
 
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return state, err
 	}
@@ -304,7 +405,7 @@ func (h *Host) GetHostState() (state string, err error) {
 // GetHostIfaces - returns the Host IPs
 func (h *Host) GetHostIfaces() (ifaces []NetworkDetails, err error) {
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return ifaces, err
 	}
@@ -327,17 +428,23 @@ func (h *Host) GetHostIfaces() (ifaces []NetworkDetails, err error) {
 	domIfaces, err := dom.ListAllInterfaceAddresses(0)
 
 	for _, iface := range domIfaces {
-		// Get the IPs
-		ips := []string{}
+		// Get the IPs of each family
+		ipv4s := []string{}
+		ipv6s := []string{}
 		for _, ip := range iface.Addrs {
-			ips = append(ips, ip.Addr)
+			if ip.Type == libvirt.IP_ADDR_TYPE_IPV6 {
+				ipv6s = append(ipv6s, ip.Addr)
+			} else {
+				ipv4s = append(ipv4s, ip.Addr)
+			}
 		}
 
 		// Add details to struct
 		netDet := NetworkDetails{
 			Name:       iface.Name,
 			MacAddress: iface.Hwaddr,
-			IPv4:       strings.Join(ips, ","),
+			IPv4:       strings.Join(ipv4s, ","),
+			IPv6:       strings.Join(ipv6s, ","),
 		}
 
 		// Add to list
@@ -347,17 +454,133 @@ func (h *Host) GetHostIfaces() (ifaces []NetworkDetails, err error) {
 	return ifaces, nil
 }
 
+// GetTapDevices - returns the tap devices of a running host in interface order
+func (h *Host) GetTapDevices() (taps []TapDevice, err error) {
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return taps, err
+	}
+	defer conn.Close()
+
+	// Get the domain by name
+	dom, err := conn.LookupDomainByName(h.Name)
+	if err != nil {
+		return taps, err
+	}
+	defer dom.Free()
+
+	// The live XML carries the tap device names
+	domXML, err := dom.GetXMLDesc(0)
+	if err != nil {
+		return taps, err
+	}
+
+	domain := structs.Domain{}
+	err = xml.Unmarshal([]byte(domXML), &domain)
+	if err != nil {
+		return taps, errors.Wrap(err, "could not parse domain xml")
+	}
+
+	for _, iface := range domain.Devices.Interface {
+		if iface.Target == nil || iface.Target.Dev == "" {
+			continue
+		}
+
+		tap := TapDevice{Name: iface.Target.Dev, Network: iface.Source.Network}
+		if iface.Mac != nil {
+			tap.MacAddress = iface.Mac.Address
+		}
+		taps = append(taps, tap)
+	}
+
+	return taps, nil
+}
+
+// GetXML - returns the libvirt XML of the host's domain, live if it is running
+func (h *Host) GetXML() (domXML string, err error) {
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return domXML, err
+	}
+	defer conn.Close()
+
+	// Get the domain by name
+	dom, err := conn.LookupDomainByName(h.Name)
+	if err != nil {
+		return domXML, err
+	}
+	defer dom.Free()
+
+	return dom.GetXMLDesc(0)
+}
+
+// GetDisks - returns the disks of the host's domain
+//
+// The main disk is an overlay created on the host's image, the second is
+// the cloud-init seed.
+func (h *Host) GetDisks() (disks []DiskDetails, err error) {
+	domXML, err := h.GetXML()
+	if err != nil {
+		return nil, err
+	}
+
+	domain := structs.Domain{}
+	err = xml.Unmarshal([]byte(domXML), &domain)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse domain xml")
+	}
+
+	disks = []DiskDetails{}
+	for _, disk := range domain.Devices.Disk {
+		details := DiskDetails{Device: disk.Target.Dev, File: disk.Source.File, Format: disk.Driver.Type}
+		if disk.BackingStore != nil {
+			details.BackingImage = disk.BackingStore.Source.File
+		} else if disk.Driver.Type == "qcow2" {
+			// Only running domains report their backing chain
+			details.BackingImage, err = backingFile(disk.Source.File)
+			if err != nil {
+				return nil, err
+			}
+		}
+		disks = append(disks, details)
+	}
+
+	return disks, nil
+}
+
+// backingFile - returns the image the qcow2 disk is an overlay of, read with qemu-img
+func backingFile(path string) (backing string, err error) {
+	// -U reads the disk while a running host holds its lock
+	stdout, stderr, err := cmd.Output("qemu-img", "info", "-U", "--output", "json", path)
+	if err != nil {
+		return "", errors.Wrap(err, stderr)
+	}
+
+	info := struct {
+		BackingFilename string `json:"backing-filename"`
+	}{}
+	err = json.Unmarshal([]byte(stdout), &info)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not parse the qemu-img info of %s", path)
+	}
+
+	return info.BackingFilename, nil
+}
+
 // CreateHostDisks - Create the host disks which is needed for the vm
 func (h *Host) createHostDisks() (err error) {
 	// Create host directory
-	dirs := []string{fmt.Sprintf("/var/lib/nenvn/machines/%s", h.Name)}
+	machineDir := config.Get().MachineDir(h.Name)
+	dirs := []string{machineDir}
 	err = files.CreateDirectories(dirs)
 	if err != nil {
 		return err
 	}
 
 	// Create the VM main image
-	_, stderr, err := cmd.Output("qemu-img", "create", "-F", "qcow2", "-b", fmt.Sprintf("/var/lib/nenvn/images/%s.img", h.Image), "-f", "qcow2", fmt.Sprintf("/var/lib/nenvn/machines/%s/%s.qcow2", h.Name, h.Name), h.HDSpace)
+	_, stderr, err := cmd.Output("qemu-img", "create", "-F", "qcow2", "-b", config.Get().ImagePath(h.Image), "-f", "qcow2", filepath.Join(machineDir, h.Name+".qcow2"), h.HDSpace)
 	if err != nil {
 		return errors.Wrap(err, stderr)
 	}
@@ -383,13 +606,31 @@ chpasswd:
 
 	//Add the variables and write the files
 	userData = fmt.Sprintf(userData, h.Name, h.Username, h.Username, h.Username, h.Password)
-	err = ioutil.WriteFile(fmt.Sprintf("/var/lib/nenvn/machines/%s/user-data", h.Name), []byte(userData), 0755)
+	if h.Role == RoleRouter {
+		userData += routerUserData
+	}
+	err = ioutil.WriteFile(filepath.Join(machineDir, "user-data"), []byte(userData), 0755)
 
 	// Create an empty meta-data file
-	err = ioutil.WriteFile(fmt.Sprintf("/var/lib/nenvn/machines/%s/meta-data", h.Name), []byte(""), 0755)
+	err = ioutil.WriteFile(filepath.Join(machineDir, "meta-data"), []byte(""), 0755)
+
+	// Name and address the interfaces inside the guest when the defaults are not enough
+	args := []string{"-v"}
+	if h.needsNetworkConfig() {
+		networkConfig, err := h.networkConfig()
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(machineDir, "network-config"), networkConfig, 0755)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--network-config", filepath.Join(machineDir, "network-config"))
+	}
 
 	// Create the cloud-init disk
-	_, stderr, err = cmd.Output("cloud-localds", "-v", fmt.Sprintf("/var/lib/nenvn/machines/%s/%s-seed.qcow2", h.Name, h.Name), fmt.Sprintf("/var/lib/nenvn/machines/%s/user-data", h.Name), fmt.Sprintf("/var/lib/nenvn/machines/%s/meta-data", h.Name))
+	args = append(args, filepath.Join(machineDir, h.Name+"-seed.qcow2"), filepath.Join(machineDir, "user-data"), filepath.Join(machineDir, "meta-data"))
+	_, stderr, err = cmd.Output("cloud-localds", args...)
 	if err != nil {
 		return errors.Wrap(err, stderr)
 	}
@@ -397,24 +638,39 @@ chpasswd:
 	return nil
 }
 
-// DefineHost - defines the host and writes the XML config file
-func DefineHost(hostDef structs.HostDefintion) (host Host, err error) {
+// DefineHost - defines the host and its interfaces on the given networks
+func DefineHost(hostDef structs.HostDefintion, depName string, networks []network.Network) (host Host, err error) {
 
 	// Check if the name exists in the database
 	hostTest, err := GetHostByName(hostDef.HostName)
-	if hostTest != (Host{}) {
-		return host, errNameUsed
+	if hostTest.Name != "" {
+		return host, errors.Wrapf(errNameUsed, "host %s", hostDef.HostName)
+	}
+
+	// Create the interfaces
+	ifaces, err := defineInterfaces(hostDef, depName, networks)
+	if err != nil {
+		return host, errdefs.Invalid(err)
+	}
+
+	// Create the port forwards to the fixed addresses
+	ports, err := definePorts(hostDef, ifaces)
+	if err != nil {
+		return host, errdefs.Invalid(err)
 	}
 
 	// Create host struct for database
 	host = Host{
-		Name:     hostDef.HostName,
-		Image:    hostDef.Image,
-		RAM:      hostDef.RAM,
-		CPUs:     hostDef.CPUs,
-		Username: hostDef.Username,
-		Password: hostDef.Password,
-		HDSpace:  hostDef.HDSpace,
+		Name:       hostDef.HostName,
+		Image:      hostDef.Image,
+		Role:       hostDef.Role,
+		RAM:        hostDef.RAM,
+		CPUs:       hostDef.CPUs,
+		Username:   hostDef.Username,
+		Password:   hostDef.Password,
+		HDSpace:    hostDef.HDSpace,
+		Interfaces: ifaces,
+		Ports:      ports,
 	}
 
 	return host, nil
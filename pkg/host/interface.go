@@ -0,0 +1,526 @@
+package host
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"gorm.io/gorm"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/firewall"
+	"nenvoy.com/pkg/ipam"
+	"nenvoy.com/pkg/network"
+	"nenvoy.com/pkg/utils/hash"
+	netplan "nenvoy.com/pkg/utils/network"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+//Interface - Struct for the host interface data in the database
+type Interface struct {
+	gorm.Model
+	HostID     uint
+	Index      int
+	Type       string
+	Network    string
+	Name       string
+	MAC        string
+	IP         string
+	Address    string
+	DHCP4      bool `gorm:"column:dhcp4"`
+	DHCP6      bool `gorm:"column:dhcp6"`
+	MTU        int  `gorm:"column:mtu"`
+	LocalPort  int
+	RemotePort int
+	VLAN       int `gorm:"column:vlan"`
+	Trunk      string
+	Firewall   string
+	Routes     string
+}
+
+// Interface types
+const (
+	// IfaceNetwork - an interface on a libvirt network
+	IfaceNetwork = "network"
+	// IfaceUDP - one end of a udp link between two hosts
+	IfaceUDP = "udp"
+)
+
+// defineInterfaces - creates the interfaces of a host, generating deterministic macs where none are given
+func defineInterfaces(hostDef structs.HostDefintion, depName string, networks []network.Network) (ifaces []Interface, err error) {
+	if len(networks) != len(hostDef.Networks) {
+		return nil, errors.Errorf("host %s: expected %d networks, got %d", hostDef.HostName, len(hostDef.Networks), len(networks))
+	}
+
+	names := map[string]bool{}
+	for i, ifaceDef := range hostDef.Networks {
+		iface := Interface{Index: i, Type: IfaceNetwork, Network: ifaceDef.Network}
+
+		// The ends of udp links are tunnels rather than networks
+		if ifaceDef.UDP != nil {
+			iface.Type = IfaceUDP
+			iface.LocalPort = ifaceDef.UDP.LocalPort
+			iface.RemotePort = ifaceDef.UDP.RemotePort
+		} else {
+			iface.DHCP4 = networks[i].DHCPLower != ""
+			iface.DHCP6 = networks[i].IPv6Mode == network.IPv6ModeDHCP
+			iface.MTU = networks[i].MTU
+		}
+
+		// Names the interface is given inside the guest
+		if ifaceDef.Name != "" {
+			if !validIfaceName(ifaceDef.Name) {
+				return nil, errors.Errorf("host %s: invalid interface name %q", hostDef.HostName, ifaceDef.Name)
+			}
+			if names[ifaceDef.Name] {
+				return nil, errors.Errorf("host %s: interface name %s is used twice", hostDef.HostName, ifaceDef.Name)
+			}
+			names[ifaceDef.Name] = true
+			iface.Name = ifaceDef.Name
+		}
+
+		// Static addresses configured inside the guest
+		if ifaceDef.Address != "" {
+			ip, subnet, err := net.ParseCIDR(ifaceDef.Address)
+			if err != nil {
+				return nil, errors.Errorf("host %s: invalid address %q, expected address/prefix", hostDef.HostName, ifaceDef.Address)
+			}
+			if ip.To4() != nil && iface.DHCP4 {
+				return nil, errors.Errorf("host %s: network %s has DHCP, use ip to fix the address", hostDef.HostName, iface.Network)
+			}
+			ones, _ := subnet.Mask.Size()
+			iface.Address = fmt.Sprintf("%s/%d", ip.String(), ones)
+		}
+
+		// Routes installed in the guest through the interface
+		if len(ifaceDef.Routes) > 0 {
+			iface.Routes, err = encodeRoutes(ifaceDef.Routes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "host %s", hostDef.HostName)
+			}
+		}
+
+		// Use the given mac or generate one from the deployment, host and index
+		iface.MAC, err = interfaceMAC(ifaceDef, depName, hostDef.HostName, i)
+		if err != nil {
+			return nil, errors.Wrapf(err, "host %s", hostDef.HostName)
+		}
+
+		existing, err := getInterfaceByMAC(iface.MAC)
+		if err != nil {
+			return nil, err
+		}
+		if existing.MAC != "" {
+			return nil, errdefs.Conflictf("host %s: mac %s already used", hostDef.HostName, iface.MAC)
+		}
+
+		// Vlans are only carried by ovs networks
+		if ifaceDef.VLAN != 0 || len(ifaceDef.Trunk) > 0 {
+			iface.VLAN, iface.Trunk, err = checkVlans(ifaceDef, networks[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "host %s", hostDef.HostName)
+			}
+		}
+
+		// Use the interface's firewall, or the host's, nwfilter cannot filter ovs ports or udp links
+		fw := ifaceDef.Firewall
+		filterable := iface.Type == IfaceNetwork && networks[i].Type != network.TypeOVS
+		if fw != nil && !filterable {
+			return nil, errors.Errorf("host %s: firewalls are not supported on ovs networks or udp links", hostDef.HostName)
+		}
+		if fw == nil && filterable {
+			fw = hostDef.Firewall
+		}
+		if fw != nil {
+			iface.Firewall, err = encodeFirewall(*fw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "host %s", hostDef.HostName)
+			}
+		}
+
+		// Check the reserved ip fits the network
+		if ifaceDef.IP != "" {
+			iface.IP, err = checkReservation(ifaceDef.IP, networks[i])
+			if err != nil {
+				return nil, errors.Wrapf(err, "host %s", hostDef.HostName)
+			}
+		}
+
+		ifaces = append(ifaces, iface)
+	}
+
+	return ifaces, nil
+}
+
+// CheckAddresses - checks no two interfaces of the hosts share a mac, or an address on a network
+//
+// Hosts are only saved once the deployment is built, so the database cannot
+// catch interfaces of the same template clashing, nor two generated macs
+// hashing to the same address.
+func CheckAddresses(hostDefs []structs.HostDefintion, depName string) (err error) {
+	macs := map[string]string{}
+	addrs := map[string]string{}
+	for _, hostDef := range hostDefs {
+		for i, ifaceDef := range hostDef.Networks {
+			owner := fmt.Sprintf("host %s interface %d", hostDef.HostName, i)
+
+			mac, err := interfaceMAC(ifaceDef, depName, hostDef.HostName, i)
+			if err != nil {
+				return errors.Wrapf(err, "host %s", hostDef.HostName)
+			}
+			if other, ok := macs[mac]; ok {
+				return errors.Errorf("mac %s is used by both %s and %s", mac, other, owner)
+			}
+			macs[mac] = owner
+
+			// Reserved and static addresses, invalid ones are reported when the interfaces are defined
+			ips := []net.IP{net.ParseIP(ifaceDef.IP)}
+			if ip, _, err := net.ParseCIDR(ifaceDef.Address); err == nil {
+				ips = append(ips, ip)
+			}
+			for _, ip := range ips {
+				if ip == nil || ifaceDef.Network == "" {
+					continue
+				}
+				key := ifaceDef.Network + "/" + ip.String()
+				if other, ok := addrs[key]; ok && other != owner {
+					return errors.Errorf("ip %s on network %s is used by both %s and %s", ip, ifaceDef.Network, other, owner)
+				}
+				addrs[key] = owner
+			}
+		}
+	}
+
+	return nil
+}
+
+// reserve - adds the DHCP reservations of the host's interfaces
+func (h *Host) reserve() (err error) {
+	for _, iface := range h.Interfaces {
+		if iface.IP == "" {
+			continue
+		}
+
+		err = network.AddDHCPHost(iface.Network, iface.MAC, iface.IP, h.Name)
+		if err != nil {
+			return err
+		}
+		printing.PrintInfo(fmt.Sprintf("Reserved %s for host %s on network %s", iface.IP, h.Name, iface.Network))
+	}
+
+	return nil
+}
+
+// release - removes the DHCP reservations of the host's interfaces
+func (h *Host) release() (err error) {
+	for _, iface := range h.Interfaces {
+		if iface.IP == "" {
+			continue
+		}
+
+		err = network.RemoveDHCPHost(iface.Network, iface.MAC, iface.IP, h.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadInterfaces - loads the host's interfaces from the database if they are not already loaded
+func (h *Host) loadInterfaces() (err error) {
+	if h.Interfaces != nil || h.ID == 0 {
+		return nil
+	}
+
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	err = db.Where("host_id = ?", h.ID).Order("`index`").Find(&h.Interfaces).Error
+	if err != nil {
+		return errors.Wrap(err, "could not find interfaces")
+	}
+
+	return nil
+}
+
+// checkReservation - checks a reserved ip is a free DHCP address of the network
+func checkReservation(ip string, netwk network.Network) (addr string, err error) {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return "", errors.Errorf("invalid ip %s, reservations must be IPv4", ip)
+	}
+	if netwk.DHCPLower == "" {
+		return "", errors.Errorf("network %s has no DHCP to reserve %s on", netwk.Name, ip)
+	}
+
+	subnet, err := ipam.ParseSubnet(netwk.IP, netwk.Netmask)
+	if err != nil {
+		return "", err
+	}
+	if !subnet.Contains(parsed) || parsed.Equal(net.ParseIP(netwk.IP)) {
+		return "", errors.Errorf("ip %s is not a host address of network %s (%s)", ip, netwk.Name, subnet.String())
+	}
+
+	// Check no other interface holds the address
+	db, err := database.NewSession()
+	if err != nil {
+		return "", err
+	}
+	var existing Interface
+	err = db.Where("network = ? AND ip = ?", netwk.Name, parsed.String()).First(&existing).Error
+	if err == nil {
+		return "", errdefs.Conflictf("ip %s is already reserved on network %s", ip, netwk.Name)
+	} else if err != gorm.ErrRecordNotFound {
+		return "", errors.Wrap(err, "could not check reservations")
+	}
+
+	return parsed.String(), nil
+}
+
+// interfaceXML - the domain interface of a host interface
+func (h *Host) interfaceXML(hostIface Interface) structs.Interface {
+	iface := structs.Interface{}
+	iface.Type = "network"
+	iface.Mac = &structs.InterfaceMac{Address: hostIface.MAC}
+	iface.Source.Network = hostIface.Network
+
+	// Udp links send to the other end's port on the hypervisor
+	if hostIface.Type == IfaceUDP {
+		iface.Type = IfaceUDP
+		iface.Source.Network = ""
+		iface.Source.Address = "127.0.0.1"
+		iface.Source.Port = hostIface.RemotePort
+		iface.Source.Local = &structs.InterfaceSourceLocal{Address: "127.0.0.1", Port: hostIface.LocalPort}
+	}
+	iface.Model.Name = "isa_serial"
+	iface.Model.Type = "virtio"
+	iface.Vlan = hostIface.vlanXML()
+
+	// Reference the interface's firewall
+	if hostIface.Firewall != "" {
+		iface.FilterRef = &structs.InterfaceFilterRef{Filter: firewall.FilterName(h.Name, hostIface.Index)}
+	}
+
+	return iface
+}
+
+// checkVlans - checks the vlan tags are valid for the network
+func checkVlans(ifaceDef structs.InterfaceDefinition, netwk network.Network) (vlan int, trunk string, err error) {
+	if netwk.Type != network.TypeOVS {
+		return 0, "", errors.Errorf("network %s is %s, vlan and trunk need an ovs network", netwk.Name, netwk.Type)
+	}
+
+	if ifaceDef.VLAN < 0 || ifaceDef.VLAN > 4094 {
+		return 0, "", errors.Errorf("invalid vlan %d on network %s", ifaceDef.VLAN, netwk.Name)
+	}
+
+	ids := []string{}
+	for _, id := range ifaceDef.Trunk {
+		if id < 1 || id > 4094 {
+			return 0, "", errors.Errorf("invalid trunk vlan %d on network %s", id, netwk.Name)
+		}
+		ids = append(ids, strconv.Itoa(id))
+	}
+
+	return ifaceDef.VLAN, strings.Join(ids, ","), nil
+}
+
+// vlanXML - the vlan element of the interface, nil when it is untagged
+//
+// A vlan on its own is an access port. With a trunk the vlan is the native,
+// untagged, vlan of the trunk.
+func (i Interface) vlanXML() *structs.InterfaceVlan {
+	if i.Trunk == "" {
+		if i.VLAN == 0 {
+			return nil
+		}
+		return &structs.InterfaceVlan{Tag: []structs.InterfaceVlanTag{{ID: i.VLAN}}}
+	}
+
+	vlan := &structs.InterfaceVlan{Trunk: "yes"}
+	if i.VLAN != 0 {
+		vlan.Tag = append(vlan.Tag, structs.InterfaceVlanTag{ID: i.VLAN, NativeMode: "untagged"})
+	}
+	for _, id := range strings.Split(i.Trunk, ",") {
+		tag, _ := strconv.Atoi(id)
+		if tag != i.VLAN {
+			vlan.Tag = append(vlan.Tag, structs.InterfaceVlanTag{ID: tag})
+		}
+	}
+
+	return vlan
+}
+
+// needsNetworkConfig - reports whether the guest's interfaces need more than the default DHCP config
+func (h *Host) needsNetworkConfig() bool {
+	for _, iface := range h.Interfaces {
+		if iface.Name != "" || iface.Address != "" || iface.Routes != "" || iface.MTU != 0 || iface.Type == IfaceUDP {
+			return true
+		}
+	}
+
+	return false
+}
+
+// networkConfig - the cloud-init network config naming and addressing the guest's interfaces
+func (h *Host) networkConfig() (config []byte, err error) {
+	plan := netplan.NetPlan{}
+	plan.Network.Version = 2
+	plan.Network.Ethernets = map[string]netplan.Ethernet{}
+
+	for _, iface := range h.Interfaces {
+		// Unnamed interfaces keep the name the guest gives them
+		id := iface.Name
+		if id == "" {
+			id = fmt.Sprintf("vngen%d", iface.Index)
+		}
+
+		dhcp4, dhcp6 := iface.DHCP4, iface.DHCP6
+		guestIface := netplan.Iface{
+			Match:   &netplan.Match{MACAddress: iface.MAC},
+			SetName: iface.Name,
+			DHCP4:   &dhcp4,
+			DHCP6:   &dhcp6,
+			MTU:     iface.MTU,
+		}
+		if iface.Address != "" {
+			guestIface.Addresses = []string{iface.Address}
+		}
+		routes, err := iface.GetRoutes()
+		if err != nil {
+			return nil, err
+		}
+		for _, route := range routes {
+			guestIface.Routes = append(guestIface.Routes, netplan.Route{To: route.To, Via: route.Via})
+		}
+
+		plan.Network.Ethernets[id] = netplan.Ethernet{Iface: guestIface}
+	}
+
+	config, err = yaml.Marshal(plan)
+	if err != nil {
+		return nil, errors.Wrapf(err, "host %s: could not create network config", h.Name)
+	}
+
+	return config, nil
+}
+
+// encodeRoutes - checks the routes of an interface and encodes them for the database
+func encodeRoutes(routes []structs.RouteDefinition) (encoded string, err error) {
+	for _, route := range routes {
+		_, _, err := net.ParseCIDR(route.To)
+		if err != nil {
+			return "", errors.Errorf("invalid route destination %q, expected address/prefix", route.To)
+		}
+		if net.ParseIP(route.Via) == nil {
+			return "", errors.Errorf("invalid gateway %q of route to %s", route.Via, route.To)
+		}
+	}
+
+	b, err := json.Marshal(routes)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// GetRoutes - returns the routes installed in the guest through the interface
+func (i Interface) GetRoutes() (routes []structs.RouteDefinition, err error) {
+	if i.Routes == "" {
+		return nil, nil
+	}
+
+	err = json.Unmarshal([]byte(i.Routes), &routes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid routes on interface %d", i.Index)
+	}
+
+	return routes, nil
+}
+
+// validIfaceName - reports whether the name can be given to a linux interface
+func validIfaceName(name string) bool {
+	if len(name) > 15 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// GetUsedUDPPorts - returns the hypervisor ports used by udp links
+func GetUsedUDPPorts() (ports map[int]bool, err error) {
+	db, err := database.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	ifaces := []Interface{}
+	err = db.Where("type = ?", IfaceUDP).Find(&ifaces).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find udp links")
+	}
+
+	ports = map[int]bool{}
+	for _, iface := range ifaces {
+		ports[iface.LocalPort] = true
+	}
+
+	return ports, nil
+}
+
+// getInterfaceByMAC - returns the interface with the mac address
+func getInterfaceByMAC(mac string) (iface Interface, err error) {
+	db, err := database.NewSession()
+	if err != nil {
+		return iface, err
+	}
+
+	err = db.Where("mac = ?", mac).First(&iface).Error
+	if err == gorm.ErrRecordNotFound {
+		return iface, nil
+	} else if err != nil {
+		return iface, errors.Wrap(err, "could not find interface")
+	}
+
+	return iface, nil
+}
+
+// parseMAC - validates and normalises a unicast ethernet mac address
+func parseMAC(mac string) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return "", errors.Errorf("invalid mac %s", mac)
+	}
+	if hw[0]&1 == 1 {
+		return "", errors.Errorf("mac %s is multicast", mac)
+	}
+
+	return strings.ToLower(hw.String()), nil
+}
+
+// interfaceMAC - returns the interface's mac, or one generated from the deployment, host and index
+func interfaceMAC(ifaceDef structs.InterfaceDefinition, depName string, hostName string, index int) (string, error) {
+	if ifaceDef.MAC != "" {
+		return parseMAC(ifaceDef.MAC)
+	}
+	return generateMAC(fmt.Sprintf("%s/%s/%d", depName, hostName, index))
+}
+
+// generateMAC - returns a mac in the qemu range derived from the seed
+func generateMAC(seed string) (string, error) {
+	sum := hash.Hash(seed)
+	return parseMAC(fmt.Sprintf("52:54:00:%02x:%02x:%02x", byte(sum>>16), byte(sum>>8), byte(sum)))
+}
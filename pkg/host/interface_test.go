@@ -0,0 +1,44 @@
+package host_test
+
+import (
+	"strings"
+	"testing"
+
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/host"
+)
+
+// TestCheckAddresses - rejects macs and addresses used twice in a template
+func TestCheckAddresses(t *testing.T) {
+	hosts := []structs.HostDefintion{
+		{HostName: "web", Networks: []structs.InterfaceDefinition{{Network: "front", IP: "10.0.0.10"}, {Network: "back"}}},
+		{HostName: "db", Networks: []structs.InterfaceDefinition{{Network: "back", Address: "10.0.1.10/24"}}},
+	}
+	err := host.CheckAddresses(hosts, "lab")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// The same mac given to two hosts
+	hosts[0].Networks[1].MAC = "52:54:00:aa:bb:cc"
+	hosts[1].Networks[0].MAC = "52:54:00:AA:BB:CC"
+	err = host.CheckAddresses(hosts, "lab")
+	if err == nil || !strings.Contains(err.Error(), "mac 52:54:00:aa:bb:cc") {
+		t.Errorf("expected the mac to be rejected, got %v", err)
+	}
+	hosts[1].Networks[0].MAC = ""
+
+	// A reservation on the address another host is configured with
+	hosts[0].Networks[1].IP = "10.0.1.10"
+	err = host.CheckAddresses(hosts, "lab")
+	if err == nil || !strings.Contains(err.Error(), "ip 10.0.1.10 on network back") {
+		t.Errorf("expected the address to be rejected, got %v", err)
+	}
+
+	// The same address on different networks
+	hosts[0].Networks[1].Network = "other"
+	err = host.CheckAddresses(hosts, "lab")
+	if err != nil {
+		t.Errorf("expected addresses on different networks to be allowed, got %v", err)
+	}
+}
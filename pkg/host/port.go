@@ -0,0 +1,240 @@
+package host
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	structs "nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/utils/iptables"
+	"nenvoy.com/pkg/utils/printing"
+)
+
+// PortForward - Struct for the port forward data in the database
+type PortForward struct {
+	gorm.Model
+	HostID    uint
+	Protocol  string
+	HostPort  int
+	Network   string
+	GuestIP   string
+	GuestPort int
+}
+
+// definePorts - creates the port forwards of a host to its fixed addresses
+func definePorts(hostDef structs.HostDefintion, ifaces []Interface) (ports []PortForward, err error) {
+	for _, portDef := range hostDef.Ports {
+		port, err := definePort(hostDef.HostName, portDef, ifaces)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, other := range ports {
+			if other.Protocol == port.Protocol && other.HostPort == port.HostPort {
+				return nil, errors.Errorf("host %s: port %s/%d is forwarded twice", hostDef.HostName, port.Protocol, port.HostPort)
+			}
+		}
+
+		ports = append(ports, port)
+	}
+
+	return ports, nil
+}
+
+// definePort - checks a port forward and finds the fixed address it forwards to
+func definePort(hostName string, portDef structs.PortDefinition, ifaces []Interface) (port PortForward, err error) {
+	port = PortForward{
+		Protocol:  strings.ToLower(portDef.Protocol),
+		HostPort:  portDef.HostPort,
+		GuestPort: portDef.GuestPort,
+	}
+
+	if port.Protocol == "" {
+		port.Protocol = "tcp"
+	}
+	if port.Protocol != "tcp" && port.Protocol != "udp" {
+		return port, errors.Errorf("host %s: unknown protocol %s, expected tcp or udp", hostName, port.Protocol)
+	}
+	if port.GuestPort == 0 {
+		port.GuestPort = port.HostPort
+	}
+	if port.HostPort < 1 || port.HostPort > 65535 || port.GuestPort < 1 || port.GuestPort > 65535 {
+		return port, errors.Errorf("host %s: invalid port %d -> %d", hostName, port.HostPort, port.GuestPort)
+	}
+
+	// Forward to the fixed ip on the network, or the first fixed ip
+	for _, iface := range ifaces {
+		if iface.IP == "" || (portDef.Network != "" && iface.Network != portDef.Network) {
+			continue
+		}
+		port.Network = iface.Network
+		port.GuestIP = iface.IP
+		break
+	}
+	if port.GuestIP == "" {
+		if portDef.Network != "" {
+			return port, errors.Errorf("host %s: forwarding port %d needs an ip on network %s", hostName, port.HostPort, portDef.Network)
+		}
+		return port, errors.Errorf("host %s: forwarding port %d needs an interface with an ip", hostName, port.HostPort)
+	}
+
+	// The hypervisor port can only be forwarded once
+	existing, err := getPortForward(port.Protocol, port.HostPort)
+	if err != nil {
+		return port, err
+	}
+	if existing.HostPort != 0 {
+		return port, errdefs.Conflictf("host %s: port %s/%d is already forwarded to %s:%d", hostName, port.Protocol, port.HostPort, existing.GuestIP, existing.GuestPort)
+	}
+
+	return port, nil
+}
+
+// forward - the iptables rules of the port forward
+func (p PortForward) forward() iptables.Forward {
+	return iptables.Forward{
+		Protocol:  p.Protocol,
+		HostPort:  p.HostPort,
+		GuestIP:   p.GuestIP,
+		GuestPort: p.GuestPort,
+		Comment:   fmt.Sprintf("vngen %s/%d", p.Protocol, p.HostPort),
+	}
+}
+
+// Active - reports whether the rules of the port forward are in place
+func (p PortForward) Active() bool {
+	return iptables.Active(p.forward())
+}
+
+// applyPorts - adds the rules of the host's port forwards that are missing
+func (h *Host) applyPorts() (err error) {
+	for _, port := range h.Ports {
+		err = iptables.Apply(port.forward())
+		if err != nil {
+			return errors.Wrapf(err, "host %s: could not forward port %s/%d", h.Name, port.Protocol, port.HostPort)
+		}
+	}
+
+	return nil
+}
+
+// removePorts - removes the rules of the host's port forwards
+func (h *Host) removePorts() (err error) {
+	for _, port := range h.Ports {
+		err = iptables.Remove(port.forward())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadPorts - loads the host's port forwards from the database if they are not already loaded
+func (h *Host) loadPorts() (err error) {
+	if h.Ports != nil || h.ID == 0 {
+		return nil
+	}
+
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	err = db.Where("host_id = ?", h.ID).Order("host_port").Find(&h.Ports).Error
+	if err != nil {
+		return errors.Wrap(err, "could not find port forwards")
+	}
+
+	return nil
+}
+
+// AddPort - forwards a hypervisor port to the host and saves it
+func (h *Host) AddPort(portDef structs.PortDefinition) (port PortForward, err error) {
+	err = h.loadInterfaces()
+	if err != nil {
+		return port, err
+	}
+
+	port, err = definePort(h.Name, portDef, h.Interfaces)
+	if err != nil {
+		return port, err
+	}
+	port.HostID = h.ID
+
+	err = iptables.Apply(port.forward())
+	if err != nil {
+		return port, err
+	}
+
+	db, err := database.NewSession()
+	if err != nil {
+		return port, err
+	}
+
+	err = db.Create(&port).Error
+	if err != nil {
+		iptables.Remove(port.forward())
+		return port, errors.Wrap(err, "could not save port forward")
+	}
+
+	printing.PrintSuccess(fmt.Sprintf("Forwarded port %s/%d to %s %s:%d", port.Protocol, port.HostPort, h.Name, port.GuestIP, port.GuestPort))
+	return port, nil
+}
+
+// RemovePort - removes the forward of a hypervisor port to the host
+func (h *Host) RemovePort(protocol string, hostPort int) (err error) {
+	port, err := getPortForward(protocol, hostPort)
+	if err != nil {
+		return err
+	}
+	if port.HostPort == 0 || port.HostID != h.ID {
+		return errors.Errorf("host %s has no forward of port %s/%d", h.Name, protocol, hostPort)
+	}
+
+	err = iptables.Remove(port.forward())
+	if err != nil {
+		return err
+	}
+
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	// Remove from the database
+	db.Delete(&port)
+
+	printing.PrintSuccess(fmt.Sprintf("Removed forward of port %s/%d to %s", port.Protocol, port.HostPort, h.Name))
+	return nil
+}
+
+// GetPorts - returns the host's port forwards
+func (h *Host) GetPorts() (ports []PortForward, err error) {
+	err = h.loadPorts()
+	if err != nil {
+		return nil, err
+	}
+
+	return h.Ports, nil
+}
+
+// getPortForward - returns the forward of the hypervisor port
+func getPortForward(protocol string, hostPort int) (port PortForward, err error) {
+	db, err := database.NewSession()
+	if err != nil {
+		return port, err
+	}
+
+	err = db.Where("protocol = ? AND host_port = ?", protocol, hostPort).First(&port).Error
+	if err == gorm.ErrRecordNotFound {
+		return port, nil
+	} else if err != nil {
+		return port, errors.Wrap(err, "could not find port forward")
+	}
+
+	return port, nil
+}
@@ -0,0 +1,138 @@
+package ipam
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// Plan - Struct for the addressing derived from a subnet
+type Plan struct {
+	Subnet    *net.IPNet
+	Gateway   net.IP
+	Netmask   net.IP
+	DHCPLower net.IP
+	DHCPUpper net.IP
+}
+
+// Allocator - tracks subnets in use and hands out free ones
+type Allocator struct {
+	used []reservation
+}
+
+// reservation - a subnet in use and what is using it
+type reservation struct {
+	subnet *net.IPNet
+	owner  string
+}
+
+// NewAllocator - returns an allocator with no subnets in use
+func NewAllocator() *Allocator {
+	return &Allocator{}
+}
+
+// Reserve - marks the subnet as used by owner, failing if it overlaps another reservation
+func (a *Allocator) Reserve(subnet *net.IPNet, owner string) (err error) {
+	for _, r := range a.used {
+		if Overlaps(r.subnet, subnet) {
+			return errors.Errorf("%s %s overlaps %s %s", owner, subnet.String(), r.owner, r.subnet.String())
+		}
+	}
+
+	a.used = append(a.used, reservation{subnet: subnet, owner: owner})
+	return nil
+}
+
+// Exclude - marks the subnet as used by owner without checking for overlaps
+func (a *Allocator) Exclude(subnet *net.IPNet, owner string) {
+	a.used = append(a.used, reservation{subnet: subnet, owner: owner})
+}
+
+// Allocate - reserves the first free subnet of the given prefix length within the pool
+func (a *Allocator) Allocate(pool *net.IPNet, prefix int, owner string) (subnet *net.IPNet, err error) {
+	poolOnes, bits := pool.Mask.Size()
+	if bits != 32 {
+		return nil, errors.Errorf("ipam pool %s must be IPv4", pool.String())
+	}
+	if prefix < poolOnes || prefix > 30 {
+		return nil, errors.Errorf("cannot allocate /%d subnets from pool %s", prefix, pool.String())
+	}
+
+	start := binary.BigEndian.Uint32(pool.IP.To4())
+	step := uint32(1) << uint(32-prefix)
+	count := uint32(1) << uint(prefix-poolOnes)
+
+	for i := uint32(0); i < count; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+i*step)
+		candidate := &net.IPNet{IP: ip, Mask: net.CIDRMask(prefix, 32)}
+
+		if a.Reserve(candidate, owner) == nil {
+			return candidate, nil
+		}
+	}
+
+	return nil, errors.Errorf("no free /%d subnets left in pool %s", prefix, pool.String())
+}
+
+// NewPlan - derives the gateway, netmask and DHCP range of an IPv4 subnet
+//
+// The gateway is the first usable address and the DHCP range covers the
+// rest of the subnet up to the broadcast address.
+func NewPlan(subnet *net.IPNet) (plan Plan, err error) {
+	ones, bits := subnet.Mask.Size()
+	if bits != 32 || subnet.IP.To4() == nil {
+		return plan, errors.Errorf("subnet %s must be IPv4", subnet.String())
+	}
+	if ones > 30 {
+		return plan, errors.Errorf("subnet %s is too small, need at least a /30", subnet.String())
+	}
+
+	network := binary.BigEndian.Uint32(subnet.IP.To4().Mask(subnet.Mask))
+	broadcast := network | ^binary.BigEndian.Uint32(net.IP(subnet.Mask).To4())
+
+	plan = Plan{
+		Subnet:    &net.IPNet{IP: uint32ToIP(network), Mask: subnet.Mask},
+		Gateway:   uint32ToIP(network + 1),
+		Netmask:   net.IP(subnet.Mask).To4(),
+		DHCPLower: uint32ToIP(network + 2),
+		DHCPUpper: uint32ToIP(broadcast - 1),
+	}
+
+	return plan, nil
+}
+
+// ParseSubnet - parses an address and dotted netmask into a subnet
+func ParseSubnet(addr string, netmask string) (subnet *net.IPNet, err error) {
+	ip := net.ParseIP(addr).To4()
+	mask := net.ParseIP(netmask).To4()
+	if ip == nil || mask == nil {
+		return nil, errors.Errorf("invalid address %s/%s", addr, netmask)
+	}
+
+	ipMask := net.IPMask(mask)
+	if _, bits := ipMask.Size(); bits == 0 {
+		return nil, errors.Errorf("invalid netmask %s", netmask)
+	}
+
+	return &net.IPNet{IP: ip.Mask(ipMask), Mask: ipMask}, nil
+}
+
+// Overlaps - reports whether two subnets share any addresses
+func Overlaps(a *net.IPNet, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// String - returns a summary of the plan
+func (p Plan) String() string {
+	return fmt.Sprintf("%s gateway %s dhcp %s - %s", p.Subnet.String(), p.Gateway, p.DHCPLower, p.DHCPUpper)
+}
+
+// uint32ToIP - converts a big endian integer to an IPv4 address
+func uint32ToIP(v uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
@@ -0,0 +1,58 @@
+package ipam_test
+
+import (
+	"net"
+	"testing"
+
+	"nenvoy.com/pkg/ipam"
+)
+
+// TestNewPlan
+func TestNewPlan(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/24")
+
+	plan, err := ipam.NewPlan(subnet)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	if plan.Gateway.String() != "10.1.0.1" || plan.Netmask.String() != "255.255.255.0" ||
+		plan.DHCPLower.String() != "10.1.0.2" || plan.DHCPUpper.String() != "10.1.0.254" {
+		t.Errorf("unexpected plan %s", plan.String())
+	}
+
+	_, tiny, _ := net.ParseCIDR("10.1.0.0/31")
+	if _, err = ipam.NewPlan(tiny); err == nil {
+		t.Errorf("expected /31 to be too small")
+	}
+}
+
+// TestAllocate
+func TestAllocate(t *testing.T) {
+	_, pool, _ := net.ParseCIDR("10.100.0.0/16")
+	_, existing, _ := net.ParseCIDR("10.100.0.0/23")
+
+	alloc := ipam.NewAllocator()
+	alloc.Exclude(existing, "network existing")
+
+	// The first two /24s are taken by the /23
+	subnet, err := alloc.Allocate(pool, 24, "network a")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if subnet.String() != "10.100.2.0/24" {
+		t.Errorf("expected 10.100.2.0/24, got %s", subnet.String())
+	}
+
+	// Overlapping reservations are rejected
+	_, overlap, _ := net.ParseCIDR("10.100.2.128/25")
+	if err = alloc.Reserve(overlap, "network b"); err == nil {
+		t.Errorf("expected %s to overlap", overlap.String())
+	}
+
+	// Exhausted pools fail
+	_, small, _ := net.ParseCIDR("10.100.2.0/24")
+	if _, err = alloc.Allocate(small, 24, "network c"); err == nil {
+		t.Errorf("expected pool %s to be exhausted", small.String())
+	}
+}
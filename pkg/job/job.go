@@ -0,0 +1,238 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/events"
+)
+
+// Statuses of a job
+const (
+	// StatusPending - recorded but not started
+	StatusPending = "pending"
+	// StatusRunning - running in the background
+	StatusRunning = "running"
+	// StatusCancelling - asked to stop, which it does at its next step
+	StatusCancelling = "cancelling"
+	// StatusSucceeded - finished without error
+	StatusSucceeded = "succeeded"
+	// StatusFailed - finished with an error
+	StatusFailed = "failed"
+	// StatusCancelled - stopped before finishing
+	StatusCancelled = "cancelled"
+)
+
+// Job - Struct for a long running operation in the database
+type Job struct {
+	gorm.Model
+	Kind       string
+	Target     string
+	Owner      string
+	Status     string
+	Progress   int
+	Logs       string
+	Error      string
+	FinishedAt *time.Time
+}
+
+// Func - the work of a job, which stops when ctx is cancelled and reports its steps to the tracker
+type Func func(ctx context.Context, tracker *Tracker) error
+
+// Tracker - records the steps of a running job
+type Tracker struct {
+	mu     sync.Mutex
+	id     uint
+	kind   string
+	target string
+	logs   []string
+}
+
+// active - the running jobs and how to cancel them
+var active = struct {
+	sync.Mutex
+	cancels map[uint]context.CancelFunc
+	targets map[string]uint
+}{cancels: map[uint]context.CancelFunc{}, targets: map[string]uint{}}
+
+// Finished - reports whether the job has stopped running
+func (j Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// Run - records a job of the kind on the target and runs it in the background
+//
+// Only one job runs on a target at a time, so a deployment is not started
+// while it is being destroyed.
+func Run(kind string, target string, owner string, run Func) (j Job, err error) {
+	db, err := database.NewSession()
+	if err != nil {
+		return j, err
+	}
+
+	active.Lock()
+	defer active.Unlock()
+
+	if id, ok := active.targets[target]; ok {
+		return j, errdefs.Conflictf("job %d is already running on %s", id, target)
+	}
+
+	j = Job{Kind: kind, Target: target, Owner: owner, Status: StatusRunning}
+	err = db.Create(&j).Error
+	if err != nil {
+		return j, errors.Wrap(err, "failed to create job")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	active.cancels[j.ID] = cancel
+	active.targets[target] = j.ID
+
+	publish(j.ID, kind, target, j.Status, "")
+	go func() {
+		tracker := &Tracker{id: j.ID, kind: kind, target: target}
+		err := run(ctx, tracker)
+		tracker.finish(ctx, err)
+
+		active.Lock()
+		delete(active.cancels, j.ID)
+		delete(active.targets, target)
+		active.Unlock()
+		cancel()
+	}()
+
+	return j, nil
+}
+
+// GetJob - returns the job with the id
+func GetJob(id uint) (j Job, err error) {
+	db, err := database.NewSession()
+	if err != nil {
+		return j, err
+	}
+
+	err = db.First(&j, id).Error
+	if err == gorm.ErrRecordNotFound {
+		return j, errdefs.NotFoundf("job %d not found", id)
+	} else if err != nil {
+		return j, errors.Wrap(err, "failed to find job")
+	}
+
+	return j, nil
+}
+
+// Cancel - asks the running job to stop at its next step
+func Cancel(id uint) (j Job, err error) {
+	j, err = GetJob(id)
+	if err != nil {
+		return j, err
+	}
+	if j.Finished() {
+		return j, errdefs.Conflictf("job %d has already %s", id, j.Status)
+	}
+
+	active.Lock()
+	cancel, ok := active.cancels[id]
+	active.Unlock()
+	if !ok {
+		return j, errdefs.Conflictf("job %d is not running on this server", id)
+	}
+
+	db, err := database.NewSession()
+	if err != nil {
+		return j, err
+	}
+	err = db.Model(&j).Where("status = ?", StatusRunning).Update("status", StatusCancelling).Error
+	if err != nil {
+		return j, errors.Wrap(err, "failed to cancel job")
+	}
+	cancel()
+
+	return GetJob(id)
+}
+
+// Recover - migrates the jobs table and fails the jobs left running by a server that stopped
+//
+// The api server runs it once as it starts, before any job is run.
+func Recover() (err error) {
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	err = db.AutoMigrate(&Job{})
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate database: ")
+	}
+
+	now := time.Now()
+	err = db.Model(&Job{}).Where("status IN ?", []string{StatusPending, StatusRunning, StatusCancelling}).
+		Updates(map[string]interface{}{"status": StatusFailed, "error": "the api server stopped while the job was running", "finished_at": &now}).Error
+	if err != nil {
+		return errors.Wrap(err, "failed to recover jobs")
+	}
+
+	return nil
+}
+
+// Step - records a step of the job and how far through it is, from 0 to 100
+func (t *Tracker) Step(message string, percent int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.logs = append(t.logs, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), message))
+
+	db, err := database.NewSession()
+	if err != nil {
+		return
+	}
+	db.Model(&Job{}).Where("id = ?", t.id).Updates(map[string]interface{}{"progress": percent, "logs": strings.Join(t.logs, "\n")})
+
+	publish(t.id, t.kind, t.target, "progress", fmt.Sprintf("%d%% %s", percent, message))
+}
+
+// finish - records how the job ended
+func (t *Tracker) finish(ctx context.Context, err error) {
+	status := StatusSucceeded
+	message := "Finished"
+	if err != nil && ctx.Err() != nil {
+		status, message = StatusCancelled, "Cancelled"
+	} else if err != nil {
+		status, message = StatusFailed, "Failed"
+	}
+
+	t.mu.Lock()
+	t.logs = append(t.logs, fmt.Sprintf("%s %s", time.Now().Format(time.RFC3339), message))
+	updates := map[string]interface{}{"status": status, "logs": strings.Join(t.logs, "\n"), "finished_at": time.Now()}
+	t.mu.Unlock()
+
+	if status == StatusSucceeded {
+		updates["progress"] = 100
+	}
+	if err != nil {
+		updates["error"] = err.Error()
+	}
+
+	db, dbErr := database.NewSession()
+	if dbErr != nil {
+		return
+	}
+	db.Model(&Job{}).Where("id = ?", t.id).Updates(updates)
+
+	detail := ""
+	if err != nil {
+		detail = err.Error()
+	}
+	publish(t.id, t.kind, t.target, status, detail)
+}
+
+// publish - publishes a change to a job, under the deployment it runs on
+func publish(id uint, kind string, target string, action string, detail string) {
+	events.Publish(events.Event{Kind: events.KindJob, Name: fmt.Sprintf("%d", id), Deployment: target, Action: action, Detail: strings.TrimSpace(kind + " " + detail)})
+}
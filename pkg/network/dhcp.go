@@ -0,0 +1,61 @@
+package network
+
+import (
+	"encoding/xml"
+
+	"github.com/pkg/errors"
+	libvirt "libvirt.org/libvirt-go"
+
+	"nenvoy.com/pkg/config"
+	structs "nenvoy.com/pkg/constants"
+)
+
+// AddDHCPHost - reserves an ip for a mac address on the named network
+func AddDHCPHost(networkName string, mac string, ip string, hostName string) (err error) {
+	return updateNetwork(networkName, libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_IP_DHCP_HOST,
+		structs.NetworkDHCPHost{Mac: mac, Name: hostName, IP: ip})
+}
+
+// RemoveDHCPHost - removes the reservation of an ip for a mac address on the named network
+func RemoveDHCPHost(networkName string, mac string, ip string, hostName string) (err error) {
+	return updateNetwork(networkName, libvirt.NETWORK_UPDATE_COMMAND_DELETE, libvirt.NETWORK_SECTION_IP_DHCP_HOST,
+		structs.NetworkDHCPHost{Mac: mac, Name: hostName, IP: ip})
+}
+
+// updateNetwork - applies an update to a section of the network, live if it is running, and to its config
+func updateNetwork(networkName string, command libvirt.NetworkUpdateCommand, section libvirt.NetworkUpdateSection, element interface{}) (err error) {
+	xmlBytes, err := xml.Marshal(element)
+	if err != nil {
+		return err
+	}
+
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	network, err := conn.LookupNetworkByName(networkName)
+	if err != nil {
+		return err
+	}
+	defer network.Free()
+
+	// Only running networks can be updated live
+	flags := libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+	active, err := network.IsActive()
+	if err != nil {
+		return err
+	}
+	if active {
+		flags |= libvirt.NETWORK_UPDATE_AFFECT_LIVE
+	}
+
+	err = network.Update(command, section, -1, string(xmlBytes), flags)
+	if err != nil {
+		return errors.Wrapf(err, "failed to update network %s", networkName)
+	}
+
+	return nil
+}
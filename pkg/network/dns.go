@@ -0,0 +1,178 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	structs "nenvoy.com/pkg/constants"
+)
+
+// DNS record types supported in the template
+const (
+	// RecordA - an IPv4 address
+	RecordA = "A"
+	// RecordAAAA - an IPv6 address
+	RecordAAAA = "AAAA"
+	// RecordCNAME - an alias for another name
+	RecordCNAME = "CNAME"
+	// RecordSRV - the host and port of a service
+	RecordSRV = "SRV"
+)
+
+// ValidateDNS - defaults the domain and checks the custom records of a deployment
+func ValidateDNS(def *structs.DNSDefinition, deploymentName string) (err error) {
+	def.Domain = strings.Trim(strings.ToLower(def.Domain), ".")
+	if def.Domain == "" {
+		def.Domain = structs.DNSDomain
+	}
+	if !validName(def.Domain) {
+		return errors.Errorf("invalid dns domain %q", def.Domain)
+	}
+
+	// The deployment name becomes a label of the domain
+	if strings.Contains(deploymentName, ".") || !validName(deploymentName) {
+		return errors.Errorf("deployment name %q is not a valid dns label", deploymentName)
+	}
+
+	for i := range def.Records {
+		record := &def.Records[i]
+		record.Type = strings.ToUpper(record.Type)
+		if record.Type == "" {
+			record.Type = RecordA
+		}
+		if !validName(strings.TrimSuffix(record.Name, ".")) {
+			return errors.Errorf("dns record %d: invalid name %q", i, record.Name)
+		}
+
+		switch record.Type {
+		case RecordA:
+			if ip := net.ParseIP(record.Value); ip == nil || ip.To4() == nil {
+				return errors.Errorf("dns record %s: invalid ipv4 address %q", record.Name, record.Value)
+			}
+		case RecordAAAA:
+			if ip := net.ParseIP(record.Value); ip == nil || ip.To4() != nil {
+				return errors.Errorf("dns record %s: invalid ipv6 address %q", record.Name, record.Value)
+			}
+		case RecordCNAME:
+			if !validName(strings.TrimSuffix(record.Value, ".")) {
+				return errors.Errorf("dns record %s: invalid cname target %q", record.Name, record.Value)
+			}
+		case RecordSRV:
+			// libvirt limits the service to 15 characters without the underscore
+			record.Name = strings.TrimPrefix(record.Name, "_")
+			if strings.Contains(record.Name, ".") || len(record.Name) > 15 {
+				return errors.Errorf("dns record %s: srv names are the service, e.g. http", record.Name)
+			}
+			record.Protocol = strings.TrimPrefix(strings.ToLower(record.Protocol), "_")
+			if record.Protocol == "" {
+				record.Protocol = "tcp"
+			}
+			if record.Protocol != "tcp" && record.Protocol != "udp" {
+				return errors.Errorf("dns record %s: unknown srv protocol %s, expected tcp or udp", record.Name, record.Protocol)
+			}
+			if !validName(strings.TrimSuffix(record.Value, ".")) {
+				return errors.Errorf("dns record %s: invalid srv target %q", record.Name, record.Value)
+			}
+			if record.Port < 1 || record.Port > 65535 {
+				return errors.Errorf("dns record %s: invalid srv port %d", record.Name, record.Port)
+			}
+		default:
+			return errors.Errorf("dns record %s: unknown type %s, expected A, AAAA, CNAME or SRV", record.Name, record.Type)
+		}
+	}
+
+	return nil
+}
+
+// SetDNS - registers the network's hosts under the domain and serves the custom records
+//
+// Bridge, macvtap and ovs networks have no dnsmasq of their own so are left unchanged.
+func (n *Network) SetDNS(domain string, records []structs.DNSRecordDefinition) {
+	if n.Type == TypeBridge || n.Type == TypeMacvtap || n.Type == TypeOVS {
+		return
+	}
+
+	n.Domain = domain
+	n.Records = records
+}
+
+// createDNSXML - adds the domain, records and dnsmasq options to the network definition
+func (n *Network) createDNSXML(network *structs.Network) {
+	if n.Domain == "" {
+		return
+	}
+
+	// DHCP clients are registered under the domain, which is never forwarded upstream
+	network.Domain = &structs.NetworkDomain{Name: n.Domain, LocalOnly: "yes"}
+
+	dns := &structs.NetworkDNS{}
+	hosts := map[string]int{}
+	for _, record := range n.Records {
+		switch record.Type {
+		case RecordA, RecordAAAA:
+			// Names of the same address share a host element
+			i, ok := hosts[record.Value]
+			if !ok {
+				i = len(dns.Host)
+				hosts[record.Value] = i
+				dns.Host = append(dns.Host, structs.NetworkDNSHost{IP: record.Value})
+			}
+			dns.Host[i].Hostname = append(dns.Host[i].Hostname, qualify(record.Name, n.Domain))
+		case RecordSRV:
+			dns.Srv = append(dns.Srv, structs.NetworkDNSSrv{
+				Service:  record.Name,
+				Protocol: record.Protocol,
+				Domain:   n.Domain,
+				Target:   qualify(record.Value, n.Domain),
+				Port:     record.Port,
+				Priority: record.Priority,
+				Weight:   record.Weight,
+			})
+		case RecordCNAME:
+			// libvirt has no cname element so pass it straight to dnsmasq
+			if network.Dnsmasq == nil {
+				network.XMLNSDnsmasq = structs.DnsmasqNamespace
+				network.Dnsmasq = &structs.DnsmasqOptions{}
+			}
+			network.Dnsmasq.Option = append(network.Dnsmasq.Option, structs.DnsmasqOption{
+				Value: fmt.Sprintf("cname=%s,%s", qualify(record.Name, n.Domain), qualify(record.Value, n.Domain)),
+			})
+		}
+	}
+
+	if len(dns.Host) > 0 || len(dns.Srv) > 0 {
+		network.DNS = dns
+	}
+}
+
+// qualify - returns the name within the domain, names ending in a dot are already qualified
+func qualify(name string, domain string) string {
+	if strings.HasSuffix(name, ".") {
+		return strings.TrimSuffix(name, ".")
+	}
+
+	return fmt.Sprintf("%s.%s", name, domain)
+}
+
+// validName - reports whether the name is made of valid dns labels
+func validName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
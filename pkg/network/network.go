@@ -3,30 +3,50 @@ package network
 import (
 	"encoding/xml"
 	"fmt"
+	"strconv"
 
+	"nenvoy.com/pkg/config"
 	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/utils/ovs"
 	"nenvoy.com/pkg/utils/printing"
 
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
 	libvirt "libvirt.org/libvirt-go"
+	"nenvoy.com/pkg/errdefs"
 
 	structs "nenvoy.com/pkg/constants"
 )
 
-var errNameUsed = errors.New("Network name already used")
-var errIPUsed = errors.New("Network IP already used")
+var errNameUsed = errdefs.Conflictf("Network name already used")
+var errIPUsed = errdefs.Conflictf("Network IP already used")
 
 //Network - Struct for the network data in the database
 type Network struct {
 	gorm.Model
-	Name         string
-	IP           string
-	DHCPLower    string
-	DHCPUpper    string
-	Netmask      string
-	Type         string
-	DeploymentID uint
+	Name          string
+	IP            string
+	DHCPLower     string
+	DHCPUpper     string
+	Netmask       string
+	Type          string
+	HostBridge    string
+	HostDev       string
+	MacvtapMode   string
+	IPv6          string `gorm:"column:ipv6"`
+	IPv6Prefix    int    `gorm:"column:ipv6_prefix"`
+	IPv6Mode      string `gorm:"column:ipv6_mode"`
+	IPv6DHCPLower string `gorm:"column:ipv6_dhcp_lower"`
+	IPv6DHCPUpper string `gorm:"column:ipv6_dhcp_upper"`
+	MTU           int    `gorm:"column:mtu"`
+	STP           string `gorm:"column:stp"`
+	Delay         int
+	BridgeName    string
+	NATPortStart  int `gorm:"column:nat_port_start"`
+	NATPortEnd    int `gorm:"column:nat_port_end"`
+	Domain        string
+	Records       []structs.DNSRecordDefinition `gorm:"-"`
+	DeploymentID  uint
 }
 
 // createNetworkXML - Create the network definition file
@@ -37,21 +57,71 @@ func (n *Network) createNetworkXML() (domainDef string, err error) {
 	// Set the name of the network
 	network.Name = n.Name
 
-	// Set the forward mode
-	network.Forward.Mode = n.Type
-
-	// Sort the bridge
-	network.Bridge.Name = n.Name
-	network.Bridge.Stp = "on"
-	network.Bridge.Delay = "0"
-
-	// Ip Address setup
-	network.IP.Address = n.IP
-	network.IP.Netmask = n.Netmask
-
-	// Setup the DHCP server
-	network.IP.Dhcp.Range.Start = n.DHCPLower
-	network.IP.Dhcp.Range.End = n.DHCPUpper
+	switch n.Type {
+	case TypeBridge:
+		// Join the existing host bridge
+		network.Forward = &structs.NetworkForward{Mode: "bridge"}
+		network.Bridge = &structs.NetworkBridge{Name: n.HostBridge}
+	case TypeOVS:
+		// Join the Open vSwitch bridge, created by vngen unless an existing one is given
+		network.Forward = &structs.NetworkForward{Mode: "bridge"}
+		network.Bridge = &structs.NetworkBridge{Name: n.GetOVSBridgeName()}
+		network.VirtualPort = &structs.NetworkVirtualPort{Type: "openvswitch"}
+	case TypeMacvtap:
+		// Attach directly to the host device
+		network.Forward = &structs.NetworkForward{Mode: n.MacvtapMode}
+		network.Forward.Interface = []structs.NetworkForwardInterface{{Dev: n.HostDev}}
+	default:
+		// Set the forward mode, isolated networks have none
+		if n.Type != TypeIsolated {
+			network.Forward = &structs.NetworkForward{Mode: n.Type}
+		}
+		if n.NATPortStart != 0 {
+			network.Forward.NAT = &structs.NetworkNAT{Port: &structs.NetworkNATPort{Start: n.NATPortStart, End: n.NATPortEnd}}
+		}
+
+		// Sort the bridge, named after the network unless overridden
+		bridge := n.BridgeName
+		if bridge == "" {
+			bridge = n.Name
+		}
+		stp := n.STP
+		if stp == "" {
+			stp = "on"
+		}
+		network.Bridge = &structs.NetworkBridge{Name: bridge, Stp: stp, Delay: strconv.Itoa(n.Delay)}
+		if n.MTU != 0 {
+			network.MTU = &structs.NetworkMTU{Size: n.MTU}
+		}
+
+		// Ip Address setup
+		if n.IP != "" {
+			ipv4 := structs.NetworkIP{Address: n.IP, Netmask: n.Netmask}
+
+			// Setup the DHCP server
+			if n.DHCPLower != "" {
+				ipv4.Dhcp = &structs.NetworkDHCP{}
+				ipv4.Dhcp.Range.Start = n.DHCPLower
+				ipv4.Dhcp.Range.End = n.DHCPUpper
+			}
+			network.IP = append(network.IP, ipv4)
+		}
+
+		// IPv6 setup, libvirt advertises the prefix for SLAAC when there is no DHCPv6 range
+		if n.IPv6 != "" {
+			ipv6 := structs.NetworkIP{Family: "ipv6", Address: n.IPv6, Prefix: n.IPv6Prefix}
+
+			if n.IPv6Mode == IPv6ModeDHCP {
+				ipv6.Dhcp = &structs.NetworkDHCP{}
+				ipv6.Dhcp.Range.Start = n.IPv6DHCPLower
+				ipv6.Dhcp.Range.End = n.IPv6DHCPUpper
+			}
+			network.IP = append(network.IP, ipv6)
+		}
+
+		// Domain and records served by dnsmasq
+		n.createDNSXML(&network)
+	}
 
 	xmlBytes, err := xml.MarshalIndent(network, "", "	")
 	if err != nil {
@@ -68,8 +138,16 @@ func (n *Network) CreateNetwork() (err error) {
 	if err != nil {
 		return err
 	}
+	// Create the Open vSwitch bridge for the network
+	if n.Type == TypeOVS && n.HostBridge == "" {
+		err = ovs.AddBridge(n.GetOVSBridgeName())
+		if err != nil {
+			return err
+		}
+	}
+
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
@@ -100,7 +178,7 @@ func (n *Network) CreateNetwork() (err error) {
 func (n *Network) Destroy() (err error) {
 
 	// Connect to the libvirt socket
-	conn, err := libvirt.NewConnect("qemu:///system")
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
 	if err != nil {
 		return err
 	}
@@ -123,6 +201,14 @@ func (n *Network) Destroy() (err error) {
 		return err
 	}
 
+	// Remove the Open vSwitch bridge vngen created
+	if n.Type == TypeOVS && n.HostBridge == "" {
+		err = ovs.DeleteBridge(n.GetOVSBridgeName())
+		if err != nil {
+			printing.PrintWarning(err.Error())
+		}
+	}
+
 	db, err := database.NewSession()
 	if err != nil {
 		return err
@@ -136,28 +222,136 @@ func (n *Network) Destroy() (err error) {
 	return nil
 }
 
+// GetBridgeName - returns the name of the bridge libvirt created for the network
+func (n *Network) GetBridgeName() (bridge string, err error) {
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return bridge, err
+	}
+	defer conn.Close()
+
+	network, err := conn.LookupNetworkByName(n.Name)
+	if err != nil {
+		return bridge, err
+	}
+	defer network.Free()
+
+	return network.GetBridgeName()
+}
+
+// GetNetworkState - returns whether libvirt is running the network, active or inactive
+func (n *Network) GetNetworkState() (state string, err error) {
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return state, err
+	}
+	defer conn.Close()
+
+	network, err := conn.LookupNetworkByName(n.Name)
+	if err != nil {
+		return state, err
+	}
+	defer network.Free()
+
+	active, err := network.IsActive()
+	if err != nil {
+		return state, err
+	}
+	if active {
+		return "active", nil
+	}
+
+	return "inactive", nil
+}
+
+// GetXML - returns the libvirt XML of the network, live if it is running
+func (n *Network) GetXML() (netXML string, err error) {
+	// Connect to the libvirt socket
+	conn, err := libvirt.NewConnect(config.Get().LibvirtURI)
+	if err != nil {
+		return netXML, err
+	}
+	defer conn.Close()
+
+	network, err := conn.LookupNetworkByName(n.Name)
+	if err != nil {
+		return netXML, err
+	}
+	defer network.Free()
+
+	return network.GetXMLDesc(0)
+}
+
+// GetOVSBridgeName - returns the Open vSwitch bridge of an ovs network
+func (n *Network) GetOVSBridgeName() string {
+	if n.HostBridge != "" {
+		return n.HostBridge
+	}
+	return n.Name
+}
+
 // DefineNetwork - Defines the network struct to be added to the database and creates the xml file
 func DefineNetwork(net structs.NetworkDefinition) (network Network, err error) {
+	// Check the definition is valid for the network type
+	err = validateDefinition(&net)
+	if err != nil {
+		return network, errdefs.Invalid(err)
+	}
+
 	// Check if the name exists in the database
 	netTest, err := GetNetworkByName(net.NetworkName)
-	if netTest != (Network{}) {
-		return network, errNameUsed
+	if netTest.Name != "" {
+		return network, errors.Wrapf(errNameUsed, "network %s", net.NetworkName)
 	}
 
 	// Check the IP Addresses
-	netTest, err = GetNetworkByIP(net.NetworkAddr)
-	if netTest != (Network{}) {
-		return network, errIPUsed
+	if net.NetworkAddr != "" {
+		netTest, err = GetNetworkByIP(net.NetworkAddr)
+		if netTest.Name != "" {
+			return network, errIPUsed
+		}
+	}
+	if net.IPv6 != nil {
+		netTest, err = GetNetworkByIP(net.IPv6.Address)
+		if netTest.Name != "" {
+			return network, errIPUsed
+		}
 	}
 
 	// Create network struct for database
 	network = Network{
-		Name:      net.NetworkName,
-		IP:        net.NetworkAddr,
-		DHCPLower: net.DHCPLower,
-		DHCPUpper: net.DHCPUpper,
-		Netmask:   net.Netmask,
-		Type:      net.Type,
+		Name:        net.NetworkName,
+		IP:          net.NetworkAddr,
+		DHCPLower:   net.DHCPLower,
+		DHCPUpper:   net.DHCPUpper,
+		Netmask:     net.Netmask,
+		Type:        net.Type,
+		HostBridge:  net.HostBridge,
+		HostDev:     net.HostDev,
+		MacvtapMode: net.MacvtapMode,
+		MTU:         net.MTU,
+		BridgeName:  net.BridgeName,
+	}
+	if net.STP != nil && !*net.STP {
+		network.STP = "off"
+	}
+	if net.Delay != nil {
+		network.Delay = *net.Delay
+	}
+	if net.NATPorts != "" {
+		network.NATPortStart, network.NATPortEnd, err = parsePortRange(net.NATPorts)
+		if err != nil {
+			return network, err
+		}
+	}
+	if net.IPv6 != nil {
+		network.IPv6 = net.IPv6.Address
+		network.IPv6Prefix = net.IPv6.Prefix
+		network.IPv6Mode = net.IPv6.Mode
+		network.IPv6DHCPLower = net.IPv6.DHCPLower
+		network.IPv6DHCPUpper = net.IPv6.DHCPUpper
 	}
 
 	if err != nil {
@@ -217,7 +411,7 @@ func GetNetworkByName(name string) (network Network, err error) {
 	return network, nil
 }
 
-//GetNetworkByIP - returns the network with a given ip
+//GetNetworkByIP - returns the network with a given ipv4 or ipv6 address
 func GetNetworkByIP(ip string) (network Network, err error) {
 	// Connect and open the database
 	db, err := database.NewSession()
@@ -225,7 +419,7 @@ func GetNetworkByIP(ip string) (network Network, err error) {
 		return network, err
 	}
 
-	err = db.Where("ip = ?", ip).First(&network).Error
+	err = db.Where("ip = ? OR ipv6 = ?", ip, ip).First(&network).Error
 	if err == gorm.ErrRecordNotFound {
 		return network, nil
 	} else if err != nil {
@@ -0,0 +1,140 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/errdefs"
+)
+
+// Resolve - looks up a name on the dnsmasq of the network serving it
+//
+// The network is found from the name's domain unless networkName is given,
+// and each network sharing the domain is queried until one answers.
+// A and AAAA lookups return addresses, CNAME the canonical name and SRV
+// records as "priority weight port target".
+func Resolve(ctx context.Context, name string, recordType string, networkName string) (answers []string, err error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	recordType = strings.ToUpper(recordType)
+	if recordType == "" {
+		recordType = RecordA
+	}
+	switch recordType {
+	case RecordA, RecordAAAA, RecordCNAME, RecordSRV:
+	default:
+		return nil, errdefs.Invalidf("unknown record type %s, expected A, AAAA, CNAME or SRV", recordType)
+	}
+
+	networks, err := NetworksForName(name, networkName)
+	if err != nil {
+		return nil, err
+	}
+
+	// A deployment's networks share its domain, but each dnsmasq only knows the hosts on its network
+	for _, netwk := range networks {
+		answers, err = resolveOn(ctx, netwk, name, recordType)
+		if err == nil {
+			return answers, nil
+		}
+	}
+
+	return nil, err
+}
+
+// resolveOn - looks up a name on the dnsmasq of the network
+func resolveOn(ctx context.Context, netwk Network, name string, recordType string) (answers []string, err error) {
+	// dnsmasq listens on the network's own address
+	server := netwk.IP
+	if server == "" {
+		server = netwk.IPv6
+	}
+	if server == "" {
+		return nil, errors.Errorf("network %s has no address to query", netwk.Name)
+	}
+
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{Timeout: 2 * time.Second}
+			return d.DialContext(ctx, network, net.JoinHostPort(server, "53"))
+		},
+	}
+
+	switch recordType {
+	case RecordA, RecordAAAA:
+		addrs, err := resolver.LookupIPAddr(ctx, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not resolve %s on network %s", name, netwk.Name)
+		}
+		wantV4 := recordType == RecordA
+		for _, addr := range addrs {
+			if (addr.IP.To4() != nil) == wantV4 {
+				answers = append(answers, addr.IP.String())
+			}
+		}
+	case RecordCNAME:
+		cname, err := resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not resolve %s on network %s", name, netwk.Name)
+		}
+		answers = append(answers, cname)
+	case RecordSRV:
+		_, srvs, err := resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not resolve %s on network %s", name, netwk.Name)
+		}
+		for _, srv := range srvs {
+			answers = append(answers, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target))
+		}
+	}
+
+	if len(answers) == 0 {
+		return nil, errdefs.NotFoundf("no %s records for %s on network %s", recordType, name, netwk.Name)
+	}
+
+	return answers, nil
+}
+
+// NetworksForName - returns the named network, or every network whose domain is the longest match for the name
+func NetworksForName(name string, networkName string) (networks []Network, err error) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if networkName != "" {
+		netwk, err := GetNetworkByName(networkName)
+		if err != nil {
+			return nil, err
+		}
+		if netwk.Name == "" {
+			return nil, errdefs.NotFoundf("network %s not found", networkName)
+		}
+		return []Network{netwk}, nil
+	}
+
+	all, err := GetNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	domain := ""
+	for _, n := range all {
+		if n.Domain == "" || len(n.Domain) < len(domain) {
+			continue
+		}
+		if name != n.Domain && !strings.HasSuffix(name, "."+n.Domain) {
+			continue
+		}
+		if len(n.Domain) > len(domain) {
+			domain = n.Domain
+			networks = nil
+		}
+		networks = append(networks, n)
+	}
+	if len(networks) == 0 {
+		return nil, errdefs.NotFoundf("no network serves %s, give the network to query", name)
+	}
+
+	return networks, nil
+}
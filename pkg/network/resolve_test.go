@@ -0,0 +1,75 @@
+package network_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/database"
+	"nenvoy.com/pkg/network"
+)
+
+// TestNetworksForName - returns every network of the deployment serving the name's domain
+func TestNetworksForName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen-network")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	previous := config.Get()
+	defer config.Set(previous)
+	c := previous
+	c.DBPath = filepath.Join(dir, "main.db")
+	config.Set(c)
+
+	db, err := database.NewSession()
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	err = db.AutoMigrate(&network.Network{})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	for _, netwk := range []network.Network{
+		{Name: "lab-front", IP: "10.0.1.1", Domain: "lab.vngen"},
+		{Name: "lab-back", IP: "10.0.2.1", Domain: "lab.vngen"},
+		{Name: "other", IP: "10.0.3.1", Domain: "other.vngen"},
+	} {
+		err = db.Create(&netwk).Error
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+	}
+
+	networks, err := network.NetworksForName("db.lab.vngen.", "")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	names := []string{}
+	for _, netwk := range networks {
+		names = append(names, netwk.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "lab-back,lab-front" {
+		t.Errorf("expected both lab networks, got %v", names)
+	}
+
+	// The network given is the only one queried
+	networks, err = network.NetworksForName("db.lab.vngen", "lab-back")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if len(networks) != 1 || networks[0].Name != "lab-back" {
+		t.Errorf("expected lab-back, got %+v", networks)
+	}
+
+	_, err = network.NetworksForName("db.missing.vngen", "")
+	if err == nil {
+		t.Errorf("expected no network to serve db.missing.vngen")
+	}
+}
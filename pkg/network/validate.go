@@ -0,0 +1,288 @@
+package network
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	structs "nenvoy.com/pkg/constants"
+)
+
+// Network modes supported in the template
+const (
+	// TypeNAT - NAT to the outside world through the host
+	TypeNAT = "nat"
+	// TypeRoute - routed to the outside world without NAT
+	TypeRoute = "route"
+	// TypeOpen - routed with no firewall rules added by libvirt
+	TypeOpen = "open"
+	// TypeIsolated - no connectivity beyond the network and the host
+	TypeIsolated = "isolated"
+	// TypeBridge - attach guests to an existing bridge on the host
+	TypeBridge = "bridge"
+	// TypeMacvtap - attach guests directly to a host device using macvtap
+	TypeMacvtap = "macvtap"
+	// TypeOVS - attach guests to an Open vSwitch bridge, which supports vlans
+	TypeOVS = "ovs"
+)
+
+// IPv6 addressing modes
+const (
+	// IPv6ModeSLAAC - guests configure themselves from router advertisements
+	IPv6ModeSLAAC = "slaac"
+	// IPv6ModeDHCP - guests lease addresses from a DHCPv6 range
+	IPv6ModeDHCP = "dhcp"
+)
+
+// macvtapModes - the libvirt forward modes for macvtap networks
+var macvtapModes = map[string]bool{"bridge": true, "vepa": true, "private": true, "passthrough": true}
+
+// validateDefinition - checks a network definition is complete and consistent for its type
+func validateDefinition(def *structs.NetworkDefinition) (err error) {
+	if def.NetworkName == "" {
+		return errors.New("network name is required")
+	}
+
+	// NAT is the default, and routed is accepted for route
+	switch def.Type {
+	case "":
+		def.Type = TypeNAT
+	case "routed":
+		def.Type = TypeRoute
+	}
+
+	hasAddr := def.NetworkAddr != "" || def.Netmask != ""
+	hasRange := def.DHCPLower != "" || def.DHCPUpper != ""
+
+	switch def.Type {
+	case TypeNAT:
+		if !hasAddr {
+			return errors.Errorf("network %s: nat networks need a netaddr and netmask", def.NetworkName)
+		}
+	case TypeRoute, TypeOpen:
+		if !hasAddr && def.IPv6 == nil {
+			return errors.Errorf("network %s: %s networks need a netaddr and netmask or an ipv6 address", def.NetworkName, def.Type)
+		}
+	case TypeIsolated:
+	case TypeBridge:
+		if def.HostBridge == "" {
+			return errors.Errorf("network %s: bridge networks need the hostbridge to attach to", def.NetworkName)
+		}
+	case TypeOVS:
+	case TypeMacvtap:
+		if def.HostDev == "" {
+			return errors.Errorf("network %s: macvtap networks need the hostdev to attach to", def.NetworkName)
+		}
+		if def.MacvtapMode == "" {
+			def.MacvtapMode = "bridge"
+		}
+		if !macvtapModes[def.MacvtapMode] {
+			return errors.Errorf("network %s: unknown macvtapmode %s, expected bridge, vepa, private or passthrough", def.NetworkName, def.MacvtapMode)
+		}
+	default:
+		return errors.Errorf("network %s: unknown type %s, expected nat, route, open, isolated, bridge, macvtap or ovs", def.NetworkName, def.Type)
+	}
+
+	// Settings that only apply to other types
+	if def.HostBridge != "" && def.Type != TypeBridge && def.Type != TypeOVS {
+		return errors.Errorf("network %s: hostbridge is only used by bridge and ovs networks", def.NetworkName)
+	}
+	if (def.HostDev != "" || def.MacvtapMode != "") && def.Type != TypeMacvtap {
+		return errors.Errorf("network %s: hostdev and macvtapmode are only used by macvtap networks", def.NetworkName)
+	}
+
+	// Bridges are only tuned where libvirt creates them
+	err = validateBridge(def)
+	if err != nil {
+		return err
+	}
+
+	// Bridge, macvtap and ovs networks are addressed by the network they join
+	if def.Type == TypeBridge || def.Type == TypeMacvtap || def.Type == TypeOVS {
+		if hasAddr || hasRange || def.IPv6 != nil || (def.DHCP != nil && *def.DHCP) {
+			return errors.Errorf("network %s: %s networks cannot have an address or DHCP", def.NetworkName, def.Type)
+		}
+		return nil
+	}
+
+	// DHCP is enabled by giving a range
+	if def.DHCP != nil && *def.DHCP && !hasRange {
+		return errors.Errorf("network %s: dhcp is enabled but no dhcplower and dhcpupper range is given", def.NetworkName)
+	}
+	if def.DHCP != nil && !*def.DHCP && hasRange {
+		return errors.Errorf("network %s: dhcp is disabled but a dhcp range is given", def.NetworkName)
+	}
+	if hasRange && !hasAddr {
+		return errors.Errorf("network %s: dhcp needs a netaddr and netmask", def.NetworkName)
+	}
+
+	if hasAddr {
+		err = validateAddressing(def)
+		if err != nil {
+			return err
+		}
+	}
+
+	if def.IPv6 != nil {
+		return validateIPv6(def.NetworkName, def.IPv6)
+	}
+
+	return nil
+}
+
+// validateAddressing - checks the address, netmask and DHCP range agree
+func validateAddressing(def *structs.NetworkDefinition) (err error) {
+	addr := net.ParseIP(def.NetworkAddr).To4()
+	if addr == nil {
+		return errors.Errorf("network %s: invalid netaddr %q", def.NetworkName, def.NetworkAddr)
+	}
+
+	maskIP := net.ParseIP(def.Netmask).To4()
+	if maskIP == nil {
+		return errors.Errorf("network %s: invalid netmask %q", def.NetworkName, def.Netmask)
+	}
+	mask := net.IPMask(maskIP)
+	if ones, bits := mask.Size(); bits == 0 || ones == 0 {
+		return errors.Errorf("network %s: invalid netmask %q", def.NetworkName, def.Netmask)
+	}
+	subnet := net.IPNet{IP: addr.Mask(mask), Mask: mask}
+
+	if def.DHCPLower == "" && def.DHCPUpper == "" {
+		return nil
+	}
+
+	lower := net.ParseIP(def.DHCPLower).To4()
+	upper := net.ParseIP(def.DHCPUpper).To4()
+	if lower == nil || upper == nil {
+		return errors.Errorf("network %s: invalid dhcp range %q - %q", def.NetworkName, def.DHCPLower, def.DHCPUpper)
+	}
+	if !subnet.Contains(lower) || !subnet.Contains(upper) {
+		return errors.Errorf("network %s: dhcp range %s - %s is outside %s", def.NetworkName, lower, upper, subnet.String())
+	}
+	if bytes.Compare(lower, upper) > 0 {
+		return errors.Errorf("network %s: dhcplower %s is above dhcpupper %s", def.NetworkName, lower, upper)
+	}
+
+	return nil
+}
+
+// validateIPv6 - checks the IPv6 address, prefix and addressing mode agree
+func validateIPv6(name string, def *structs.IPv6Definition) (err error) {
+	addr := net.ParseIP(def.Address)
+	if addr == nil || addr.To4() != nil {
+		return errors.Errorf("network %s: invalid ipv6 address %q", name, def.Address)
+	}
+
+	if def.Prefix == 0 {
+		def.Prefix = 64
+	}
+	if def.Prefix < 1 || def.Prefix > 128 {
+		return errors.Errorf("network %s: invalid ipv6 prefix %d", name, def.Prefix)
+	}
+	subnet := net.IPNet{IP: addr.Mask(net.CIDRMask(def.Prefix, 128)), Mask: net.CIDRMask(def.Prefix, 128)}
+
+	hasRange := def.DHCPLower != "" || def.DHCPUpper != ""
+
+	// DHCPv6 when a range is given, otherwise SLAAC from router advertisements
+	if def.Mode == "" {
+		def.Mode = IPv6ModeSLAAC
+		if hasRange {
+			def.Mode = IPv6ModeDHCP
+		}
+	}
+
+	switch def.Mode {
+	case IPv6ModeSLAAC:
+		if hasRange {
+			return errors.Errorf("network %s: slaac cannot be used with an ipv6 dhcp range", name)
+		}
+		if def.Prefix != 64 {
+			return errors.Errorf("network %s: slaac needs a /64 prefix, not /%d", name, def.Prefix)
+		}
+		return nil
+	case IPv6ModeDHCP:
+		if !hasRange {
+			return errors.Errorf("network %s: ipv6 dhcp needs a dhcplower and dhcpupper range", name)
+		}
+	default:
+		return errors.Errorf("network %s: unknown ipv6 mode %s, expected dhcp or slaac", name, def.Mode)
+	}
+
+	lower := net.ParseIP(def.DHCPLower)
+	upper := net.ParseIP(def.DHCPUpper)
+	if lower == nil || upper == nil || lower.To4() != nil || upper.To4() != nil {
+		return errors.Errorf("network %s: invalid ipv6 dhcp range %q - %q", name, def.DHCPLower, def.DHCPUpper)
+	}
+	if !subnet.Contains(lower) || !subnet.Contains(upper) {
+		return errors.Errorf("network %s: ipv6 dhcp range %s - %s is outside %s", name, lower, upper, subnet.String())
+	}
+	if bytes.Compare(lower, upper) > 0 {
+		return errors.Errorf("network %s: ipv6 dhcplower %s is above dhcpupper %s", name, lower, upper)
+	}
+
+	return nil
+}
+
+// validateBridge - checks the mtu, stp, delay, bridge name and nat ports of a network
+func validateBridge(def *structs.NetworkDefinition) (err error) {
+	ownBridge := def.Type == TypeNAT || def.Type == TypeRoute || def.Type == TypeOpen || def.Type == TypeIsolated
+	if !ownBridge && (def.MTU != 0 || def.STP != nil || def.Delay != nil || def.BridgeName != "") {
+		return errors.Errorf("network %s: mtu, stp, delay and bridgename cannot be set on %s networks", def.NetworkName, def.Type)
+	}
+
+	if def.MTU != 0 && (def.MTU < 68 || def.MTU > 65535) {
+		return errors.Errorf("network %s: invalid mtu %d, expected 68 to 65535", def.NetworkName, def.MTU)
+	}
+	if def.Delay != nil && *def.Delay < 0 {
+		return errors.Errorf("network %s: invalid forward delay %d", def.NetworkName, *def.Delay)
+	}
+	if def.BridgeName != "" && !validBridgeName(def.BridgeName) {
+		return errors.Errorf("network %s: invalid bridgename %q, expected up to 15 letters, digits, - or _", def.NetworkName, def.BridgeName)
+	}
+
+	if def.NATPorts != "" {
+		if def.Type != TypeNAT {
+			return errors.Errorf("network %s: natports are only used by nat networks", def.NetworkName)
+		}
+		if _, _, err := parsePortRange(def.NATPorts); err != nil {
+			return errors.Wrapf(err, "network %s", def.NetworkName)
+		}
+	}
+
+	return nil
+}
+
+// validBridgeName - reports whether the name can be given to a linux bridge
+func validBridgeName(name string) bool {
+	if len(name) > 15 {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePortRange - parses a range of ports written as start-end
+func parsePortRange(ports string) (start int, end int, err error) {
+	bounds := strings.SplitN(ports, "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, errors.Errorf("invalid port range %q, expected start-end", ports)
+	}
+
+	start, err = strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil || start < 1 || start > 65535 {
+		return 0, 0, errors.Errorf("invalid port range %q", ports)
+	}
+	end, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil || end < start || end > 65535 {
+		return 0, 0, errors.Errorf("invalid port range %q", ports)
+	}
+
+	return start, end, nil
+}
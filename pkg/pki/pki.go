@@ -0,0 +1,238 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/config"
+	"nenvoy.com/pkg/utils/certgen"
+	"nenvoy.com/pkg/utils/osystem"
+)
+
+// organisation - the organisation of the certificates vngen issues
+const organisation = "vngen"
+
+// clientName - the names client certificates can be issued for
+var clientName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// PKI - the certificate authority and certificates of the api server, kept in a directory
+type PKI struct {
+	Dir string
+}
+
+// New - returns the pki kept in the directory
+func New(dir string) PKI {
+	return PKI{Dir: dir}
+}
+
+// Default - returns the pki kept in the application directory
+func Default() PKI {
+	return New(filepath.Join(config.Get().AppDir, "pki"))
+}
+
+// CACert - the path of the CA certificate, which clients trust the server with
+func (p PKI) CACert() string {
+	return filepath.Join(p.Dir, "ca.crt")
+}
+
+// caKey - the path of the CA private key
+func (p PKI) caKey() string {
+	return filepath.Join(p.Dir, "ca.key")
+}
+
+// ServerCert - the paths of the server's certificate and key
+func (p PKI) ServerCert() (certPath string, keyPath string) {
+	return filepath.Join(p.Dir, "server.crt"), filepath.Join(p.Dir, "server.key")
+}
+
+// ClientCert - the paths of a client's certificate and key
+func (p PKI) ClientCert(name string) (certPath string, keyPath string) {
+	return filepath.Join(p.Dir, "clients", name+".crt"), filepath.Join(p.Dir, "clients", name+".key")
+}
+
+// EnsureCA - creates the CA unless it already exists
+func (p PKI) EnsureCA() (err error) {
+	exists, err := osystem.PathExists(p.CACert())
+	if err != nil || exists {
+		return err
+	}
+
+	err = os.MkdirAll(p.Dir, 0700)
+	if err != nil {
+		return errors.Wrapf(err, "could not create %s", p.Dir)
+	}
+
+	err = certgen.CreateCA(p.CACert(), p.caKey(), "vngen CA")
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(p.caKey(), 0600)
+}
+
+// EnsureServer - issues the server certificate for the names and addresses, unless it already exists
+//
+// An existing certificate is checked against the CA, so certificates from
+// another CA are not served by mistake, and is issued again when it was
+// issued for other names or addresses.
+func (p PKI) EnsureServer(dnsNames []string, ips []net.IP) (err error) {
+	err = p.EnsureCA()
+	if err != nil {
+		return err
+	}
+
+	certPath, keyPath := p.ServerCert()
+	exists, err := osystem.PathExists(certPath)
+	if err != nil {
+		return err
+	}
+	dnsNames = append(dnsNames, "localhost")
+	if exists {
+		err = certgen.VerifySignatureFrom(certPath, keyPath, p.CACert(), p.caKey())
+		if err != nil {
+			return errors.Wrapf(err, "server certificate %s was not issued by %s", certPath, p.CACert())
+		}
+
+		cert, _, err := certgen.ReadCertFromFile(certPath, keyPath)
+		if err != nil {
+			return err
+		}
+		if sameNames(cert, dnsNames, ips) {
+			return nil
+		}
+	}
+
+	commonName := "localhost"
+	if len(dnsNames) > 1 {
+		commonName = dnsNames[0]
+	}
+	err = certgen.CreateCertKeyPair(certPath, keyPath, p.CACert(), p.caKey(), commonName, organisation, ips, dnsNames)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(keyPath, 0600)
+}
+
+// sameNames - reports whether the certificate was issued for exactly the names and addresses
+func sameNames(cert *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	want, have := map[string]bool{}, map[string]bool{}
+	for _, name := range dnsNames {
+		want["dns:"+name] = true
+	}
+	// Every certificate is also issued for the loopback addresses
+	for _, ip := range append(ips, net.IPv4(127, 0, 0, 1), net.IPv6loopback) {
+		want["ip:"+ip.String()] = true
+	}
+	for _, name := range cert.DNSNames {
+		have["dns:"+name] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		have["ip:"+ip.String()] = true
+	}
+
+	return reflect.DeepEqual(want, have)
+}
+
+// IssueClient - issues a client certificate, which authenticates as the name
+func (p PKI) IssueClient(name string) (certPath string, keyPath string, err error) {
+	if !clientName.MatchString(name) {
+		return "", "", errors.Errorf("invalid client name %q", name)
+	}
+
+	exists, err := osystem.PathExists(p.CACert())
+	if err != nil {
+		return "", "", err
+	}
+	if !exists {
+		return "", "", errors.Errorf("no CA in %s, run the api with --tls first", p.Dir)
+	}
+
+	certPath, keyPath = p.ClientCert(name)
+	exists, err = osystem.PathExists(certPath)
+	if err != nil {
+		return "", "", err
+	}
+	if exists {
+		return "", "", errors.Errorf("a certificate was already issued to %s", name)
+	}
+
+	err = os.MkdirAll(filepath.Dir(certPath), 0700)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "could not create %s", filepath.Dir(certPath))
+	}
+
+	err = certgen.CreateCertKeyPair(certPath, keyPath, p.CACert(), p.caKey(), name, organisation, nil, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	return certPath, keyPath, os.Chmod(keyPath, 0600)
+}
+
+// ServerTLSConfig - the TLS config serving the server certificate, requiring CA issued client certificates with clientAuth
+func (p PKI) ServerTLSConfig(certPath string, keyPath string, clientAuth bool) (config *tls.Config, err error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load %s and %s", certPath, keyPath)
+	}
+
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientAuth {
+		config.ClientCAs, err = loadPool(p.CACert())
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// ClientTLSConfig - the TLS config trusting the CA, presenting the client certificate if given
+func ClientTLSConfig(caPath string, certPath string, keyPath string) (config *tls.Config, err error) {
+	config = &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caPath != "" {
+		config.RootCAs, err = loadPool(caPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if certPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not load %s and %s", certPath, keyPath)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+// loadPool - returns a pool of the certificates in the PEM file
+func loadPool(path string) (pool *x509.CertPool, err error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates in %s", path)
+	}
+
+	return pool, nil
+}
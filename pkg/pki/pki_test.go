@@ -0,0 +1,146 @@
+package pki_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"nenvoy.com/pkg/pki"
+	"nenvoy.com/pkg/utils/certgen"
+)
+
+// TestMutualTLS - serves with a server certificate, accepting only clients issued by the CA
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen-pki")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := pki.New(dir)
+
+	// Clients cannot be issued before the CA exists
+	_, _, err = p.IssueClient("alice")
+	if err == nil {
+		t.Fatalf("issued a client certificate without a CA")
+	}
+
+	err = p.EnsureServer([]string{"vngen.test"}, nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// The existing server certificate is kept
+	err = p.EnsureServer([]string{"vngen.test"}, nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	certPath, keyPath, err := p.IssueClient("alice")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	_, _, err = p.IssueClient("alice")
+	if err == nil {
+		t.Fatalf("issued a second certificate to alice")
+	}
+	_, _, err = p.IssueClient("../alice")
+	if err == nil {
+		t.Fatalf("issued a certificate to an invalid name")
+	}
+
+	serverCert, serverKey := p.ServerCert()
+	config, err := p.ServerTLSConfig(serverCert, serverKey, true)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	// Clients with a certificate from the CA are accepted
+	clientConfig, err := pki.ClientTLSConfig(p.CACert(), certPath, keyPath)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "alice" {
+		t.Fatalf("expected the client to be alice, got %q", body)
+	}
+
+	// Clients without a certificate are refused
+	clientConfig, err = pki.ClientTLSConfig(p.CACert(), "", "")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	_, err = client.Get(server.URL)
+	if err == nil {
+		t.Fatalf("accepted a client without a certificate")
+	}
+}
+
+// TestEnsureServerNames - issues the server certificate again when the names or addresses change
+func TestEnsureServerNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vngen-pki")
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := pki.New(dir)
+	certPath, keyPath := p.ServerCert()
+
+	err = p.EnsureServer([]string{"vngen.test"}, nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	first, _, err := certgen.ReadCertFromFile(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	// The same names keep the certificate
+	err = p.EnsureServer([]string{"vngen.test"}, nil)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cert, _, err := certgen.ReadCertFromFile(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if cert.SerialNumber.Cmp(first.SerialNumber) != 0 {
+		t.Errorf("expected the certificate to be kept")
+	}
+
+	err = p.EnsureServer([]string{"vngen.example"}, []net.IP{net.ParseIP("192.0.2.10")})
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	cert, _, err = certgen.ReadCertFromFile(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err := cert.VerifyHostname("vngen.example"); err != nil {
+		t.Errorf("expected the certificate to be issued for vngen.example: %s", err)
+	}
+	if err := cert.VerifyHostname("192.0.2.10"); err != nil {
+		t.Errorf("expected the certificate to be issued for 192.0.2.10: %s", err)
+	}
+	if err := cert.VerifyHostname("vngen.test"); err == nil {
+		t.Errorf("expected the certificate to no longer be issued for vngen.test")
+	}
+}
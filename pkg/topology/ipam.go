@@ -0,0 +1,138 @@
+package topology
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/ipam"
+	"nenvoy.com/pkg/network"
+	netutils "nenvoy.com/pkg/utils/network"
+	"nenvoy.com/pkg/utils/printing"
+
+	structs "nenvoy.com/pkg/constants"
+)
+
+// planNetworks - resolves network cidrs into addresses and checks for overlapping subnets
+//
+// Every IPv4 network in the template is checked against the networks
+// already in the database, the hypervisor's own interfaces and the other
+// networks in the template. Networks with cidr auto are given the first
+// free subnet from the ipam pool.
+func planNetworks(vnDef *structs.VirtualNetworkDefinition) (err error) {
+	alloc, err := newAllocator()
+	if err != nil {
+		return err
+	}
+
+	// Get the pool for automatic allocations
+	pool := vnDef.IPAM.Pool
+	if pool == "" {
+		pool = constants.IPAMPool
+	}
+	_, poolNet, err := net.ParseCIDR(pool)
+	if err != nil {
+		return errors.Wrapf(err, "invalid ipam pool %s", pool)
+	}
+	prefix := vnDef.IPAM.Prefix
+	if prefix == 0 {
+		prefix = constants.IPAMPrefix
+	}
+
+	for i := range vnDef.Networks {
+		def := &vnDef.Networks[i]
+		owner := "network " + def.NetworkName
+
+		var subnet *net.IPNet
+		switch {
+		case def.CIDR == "" && def.NetworkAddr == "":
+			// Nothing to plan for networks without IPv4 addressing
+			continue
+		case def.CIDR == "":
+			// Invalid addressing is reported when the network is defined
+			subnet, err = ipam.ParseSubnet(def.NetworkAddr, def.Netmask)
+			if err != nil {
+				continue
+			}
+			err = alloc.Reserve(subnet, owner)
+			if err != nil {
+				return err
+			}
+			continue
+		case def.NetworkAddr != "" || def.Netmask != "" || def.DHCPLower != "" || def.DHCPUpper != "":
+			return errors.Errorf("network %s: cidr cannot be combined with netaddr, netmask or a dhcp range", def.NetworkName)
+		case def.CIDR == "auto":
+			subnet, err = alloc.Allocate(poolNet, prefix, owner)
+			if err != nil {
+				return err
+			}
+		default:
+			_, subnet, err = net.ParseCIDR(def.CIDR)
+			if err != nil {
+				return errors.Errorf("network %s: invalid cidr %s", def.NetworkName, def.CIDR)
+			}
+			err = alloc.Reserve(subnet, owner)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Derive the gateway and DHCP range from the subnet
+		plan, err := ipam.NewPlan(subnet)
+		if err != nil {
+			return errors.Wrapf(err, "network %s", def.NetworkName)
+		}
+
+		def.NetworkAddr = plan.Gateway.String()
+		def.Netmask = plan.Netmask.String()
+		if def.DHCP == nil || *def.DHCP {
+			def.DHCPLower = plan.DHCPLower.String()
+			def.DHCPUpper = plan.DHCPUpper.String()
+		}
+
+		printing.PrintInfo(fmt.Sprintf("Planned network %s as %s", def.NetworkName, plan.String()))
+	}
+
+	return nil
+}
+
+// newAllocator - returns an allocator excluding existing networks and hypervisor interfaces
+func newAllocator() (alloc *ipam.Allocator, err error) {
+	alloc = ipam.NewAllocator()
+
+	// Networks already defined by vngen
+	networks, err := network.GetNetworks()
+	if err != nil {
+		return nil, err
+	}
+	for _, netwk := range networks {
+		if netwk.IP == "" {
+			continue
+		}
+		subnet, err := ipam.ParseSubnet(netwk.IP, netwk.Netmask)
+		if err != nil {
+			continue
+		}
+		alloc.Exclude(subnet, "network "+netwk.Name)
+	}
+
+	// Addresses on the hypervisor's own interfaces
+	ifaces, err := netutils.GetInterfaceNetworks()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get hypervisor interfaces")
+	}
+	names := []string{}
+	for name := range ifaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, subnet := range ifaces[name] {
+			alloc.Exclude(subnet, "interface "+name)
+		}
+	}
+
+	return alloc, nil
+}
@@ -0,0 +1,199 @@
+package topology
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/constants"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/network"
+	"nenvoy.com/pkg/utils/hash"
+
+	structs "nenvoy.com/pkg/constants"
+)
+
+// Link modes supported in the template
+const (
+	// LinkBridge - the ends share an isolated bridge of their own
+	LinkBridge = "bridge"
+	// LinkUDP - the ends send frames to each other over udp sockets on the hypervisor
+	LinkUDP = "udp"
+)
+
+// linkEnd - one side of a link, as host:ifname
+type linkEnd struct {
+	host  string
+	iface string
+}
+
+// planLinks - turns the links of the template into host interfaces
+//
+// Bridge links add an isolated network without addressing, udp links
+// connect the two interfaces directly. The link interfaces are added after
+// the host's own networks, in the order the links are listed, so they keep
+// their place inside the guest.
+func planLinks(vnDef *structs.VirtualNetworkDefinition) (err error) {
+	if len(vnDef.Links) == 0 {
+		return nil
+	}
+
+	hosts := map[string]*structs.HostDefintion{}
+	for i := range vnDef.Host {
+		hosts[vnDef.Host[i].HostName] = &vnDef.Host[i]
+	}
+
+	usedPorts, err := host.GetUsedUDPPorts()
+	if err != nil {
+		return err
+	}
+	nextPort := constants.LinkUDPPortBase
+
+	for _, link := range vnDef.Links {
+		ends, err := parseLink(link.Link)
+		if err != nil {
+			return err
+		}
+		for _, end := range ends {
+			if hosts[end.host] == nil {
+				return errors.Errorf("link %s: host %s is not in the template", link.Link, end.host)
+			}
+		}
+		if ends[0].host == ends[1].host {
+			return errors.Errorf("link %s: both ends are on host %s", link.Link, ends[0].host)
+		}
+
+		addrs, err := linkAddresses(link)
+		if err != nil {
+			return err
+		}
+
+		ifaceDefs := [2]structs.InterfaceDefinition{}
+		for i, end := range ends {
+			ifaceDefs[i] = structs.InterfaceDefinition{Name: end.iface, Address: addrs[i]}
+		}
+
+		switch strings.ToLower(link.Mode) {
+		case "", LinkBridge:
+			name := linkNetworkName(vnDef.Deployment.DeploymentName, link.Link)
+			vnDef.Networks = append(vnDef.Networks, structs.NetworkDefinition{NetworkName: name, Type: network.TypeIsolated})
+			for i := range ifaceDefs {
+				ifaceDefs[i].Network = name
+			}
+		case LinkUDP:
+			ports := [2]int{}
+			for i := range ports {
+				for usedPorts[nextPort] {
+					nextPort++
+				}
+				if nextPort > 65535 {
+					return errors.Errorf("link %s: no free udp ports left", link.Link)
+				}
+				ports[i] = nextPort
+				usedPorts[nextPort] = true
+			}
+			ifaceDefs[0].UDP = &structs.UDPTunnel{LocalPort: ports[0], RemotePort: ports[1]}
+			ifaceDefs[1].UDP = &structs.UDPTunnel{LocalPort: ports[1], RemotePort: ports[0]}
+		default:
+			return errors.Errorf("link %s: unknown mode %s, expected bridge or udp", link.Link, link.Mode)
+		}
+
+		for i, end := range ends {
+			hosts[end.host].Networks = append(hosts[end.host].Networks, ifaceDefs[i])
+		}
+	}
+
+	return nil
+}
+
+// parseLink - splits a link written as hostA:ifname <-> hostB:ifname
+func parseLink(link string) (ends [2]linkEnd, err error) {
+	sides := strings.Split(link, "<->")
+	if len(sides) != 2 {
+		return ends, errors.Errorf("invalid link %q, expected hostA:ifname <-> hostB:ifname", link)
+	}
+
+	for i, side := range sides {
+		parts := strings.SplitN(strings.TrimSpace(side), ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return ends, errors.Errorf("invalid link %q, expected hostA:ifname <-> hostB:ifname", link)
+		}
+		ends[i] = linkEnd{host: parts[0], iface: parts[1]}
+	}
+
+	return ends, nil
+}
+
+// linkAddresses - returns the addresses of the two ends, taking the first two of the subnet unless they are given
+func linkAddresses(link structs.LinkDefinition) (addrs [2]string, err error) {
+	if link.Subnet == "" && len(link.Addresses) == 0 {
+		return addrs, nil
+	}
+
+	var subnet *net.IPNet
+	if link.Subnet != "" {
+		_, subnet, err = net.ParseCIDR(link.Subnet)
+		if err != nil {
+			return addrs, errors.Errorf("link %s: invalid subnet %s", link.Link, link.Subnet)
+		}
+	}
+
+	// Addresses without a prefix take the subnet's
+	if len(link.Addresses) > 0 {
+		if len(link.Addresses) != 2 {
+			return addrs, errors.Errorf("link %s: expected 2 addresses, got %d", link.Link, len(link.Addresses))
+		}
+		for i, addr := range link.Addresses {
+			if !strings.Contains(addr, "/") {
+				if subnet == nil {
+					return addrs, errors.Errorf("link %s: address %s needs a prefix or the link a subnet", link.Link, addr)
+				}
+				ones, _ := subnet.Mask.Size()
+				addr = fmt.Sprintf("%s/%d", addr, ones)
+			}
+			ip, _, err := net.ParseCIDR(addr)
+			if err != nil {
+				return addrs, errors.Errorf("link %s: invalid address %s", link.Link, addr)
+			}
+			if subnet != nil && !subnet.Contains(ip) {
+				return addrs, errors.Errorf("link %s: address %s is not in subnet %s", link.Link, addr, subnet.String())
+			}
+			addrs[i] = addr
+		}
+		return addrs, nil
+	}
+
+	// A /31 or /127 uses both of its addresses, larger subnets skip the network address
+	ones, bits := subnet.Mask.Size()
+	first := subnet.IP
+	if bits-ones > 1 {
+		first = nextIP(first)
+	}
+	second := nextIP(first)
+	if bits-ones < 1 || !subnet.Contains(second) {
+		return addrs, errors.Errorf("link %s: subnet %s is too small for two addresses", link.Link, subnet.String())
+	}
+
+	addrs[0] = fmt.Sprintf("%s/%d", first.String(), ones)
+	addrs[1] = fmt.Sprintf("%s/%d", second.String(), ones)
+	return addrs, nil
+}
+
+// linkNetworkName - the name of a bridge link's network, short enough for the bridge it creates
+func linkNetworkName(depName string, link string) string {
+	return fmt.Sprintf("vnl%08x", hash.Hash(depName+"/"+link))
+}
+
+// nextIP - returns the address after ip
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
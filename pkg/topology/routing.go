@@ -0,0 +1,325 @@
+package topology
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"nenvoy.com/pkg/host"
+	"nenvoy.com/pkg/ipam"
+	"nenvoy.com/pkg/network"
+	"nenvoy.com/pkg/utils/printing"
+
+	structs "nenvoy.com/pkg/constants"
+)
+
+// attachment - an interface of a host and the IPv4 subnet it is on
+type attachment struct {
+	host   int
+	iface  int
+	subnet string
+}
+
+// planRoutes - addresses the routers and routes the other hosts through them
+//
+// Routers get a static address at the top of each network they are attached
+// to, reserved through DHCP where the network has it. Every host, routers
+// included, then gets a route to each subnet it is not attached to through
+// the nearest router, so traffic crosses as few routers as possible.
+func planRoutes(vnDef *structs.VirtualNetworkDefinition) (err error) {
+	routers := false
+	for i := range vnDef.Host {
+		hst := &vnDef.Host[i]
+		hst.Role = strings.ToLower(hst.Role)
+		switch hst.Role {
+		case "":
+		case host.RoleRouter:
+			routers = true
+		default:
+			return errors.Errorf("host %s: unknown role %s, expected router", hst.HostName, hst.Role)
+		}
+	}
+	if !routers {
+		return nil
+	}
+
+	networks, err := templateNetworks(vnDef)
+	if err != nil {
+		return err
+	}
+
+	// Give the routers their addresses
+	used := usedAddresses(vnDef)
+	for i := range vnDef.Host {
+		hst := &vnDef.Host[i]
+		if hst.Role != host.RoleRouter {
+			continue
+		}
+		for j := range hst.Networks {
+			err = addressRouter(hst.HostName, &hst.Networks[j], networks, used)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Find the subnets of every interface, and the routers' addresses on them
+	attached := []attachment{}
+	gateways := map[string]map[int]string{}
+	for i, hst := range vnDef.Host {
+		for j, ifaceDef := range hst.Networks {
+			subnet, ip := interfaceSubnet(ifaceDef, networks)
+			if subnet == "" {
+				continue
+			}
+			attached = append(attached, attachment{host: i, iface: j, subnet: subnet})
+			if hst.Role == host.RoleRouter && ip != "" {
+				if gateways[subnet] == nil {
+					gateways[subnet] = map[int]string{}
+				}
+				gateways[subnet][i] = ip
+			}
+		}
+	}
+
+	// The next hop from each subnet to every subnet reachable through routers
+	subnets := map[string]bool{}
+	for _, a := range attached {
+		subnets[a.subnet] = true
+	}
+	hops := map[string]map[string]nextHop{}
+	for subnet := range subnets {
+		hops[subnet] = findHops(subnet, attached, gateways)
+	}
+
+	for i := range vnDef.Host {
+		hst := &vnDef.Host[i]
+
+		// Subnets the host is on need no route
+		local := map[string]bool{}
+		for _, a := range attached {
+			if a.host == i {
+				local[a.subnet] = true
+			}
+		}
+
+		for _, dest := range sortedKeys(subnets) {
+			if local[dest] {
+				continue
+			}
+
+			// Route through the interface with the nearest router
+			best, bestIface := nextHop{}, -1
+			for _, a := range attached {
+				if a.host != i {
+					continue
+				}
+				hop, ok := hops[a.subnet][dest]
+				if !ok || hop.router == i {
+					continue
+				}
+				if bestIface == -1 || hop.distance < best.distance {
+					best, bestIface = hop, a.iface
+				}
+			}
+			if bestIface == -1 {
+				continue
+			}
+
+			ifaceDef := &hst.Networks[bestIface]
+			if hasRoute(hst.Networks, dest) {
+				continue
+			}
+			ifaceDef.Routes = append(ifaceDef.Routes, structs.RouteDefinition{To: dest, Via: best.via})
+			printing.PrintInfo(fmt.Sprintf("Routing %s from host %s via %s", dest, hst.HostName, best.via))
+		}
+	}
+
+	return nil
+}
+
+// nextHop - the router to send traffic for a subnet to
+type nextHop struct {
+	router   int
+	via      string
+	distance int
+}
+
+// findHops - searches outwards from the subnet through the routers, one router at a time
+func findHops(from string, attached []attachment, gateways map[string]map[int]string) (hops map[string]nextHop) {
+	hops = map[string]nextHop{}
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+
+	for len(queue) > 0 {
+		subnet := queue[0]
+		queue = queue[1:]
+
+		for _, router := range sortedInts(gateways[subnet]) {
+			// Traffic leaves the first subnet through this router, and later ones through the first hop
+			hop := hops[subnet]
+			if subnet == from {
+				hop = nextHop{router: router, via: gateways[subnet][router]}
+			}
+			hop.distance = hops[subnet].distance + 1
+
+			for _, a := range attached {
+				if a.host != router || visited[a.subnet] {
+					continue
+				}
+				visited[a.subnet] = true
+				hops[a.subnet] = hop
+				queue = append(queue, a.subnet)
+			}
+		}
+	}
+
+	return hops
+}
+
+// templateNetworks - returns the networks the hosts can attach to, from the template or the database
+func templateNetworks(vnDef *structs.VirtualNetworkDefinition) (networks map[string]structs.NetworkDefinition, err error) {
+	networks = map[string]structs.NetworkDefinition{}
+	for _, def := range vnDef.Networks {
+		networks[def.NetworkName] = def
+	}
+
+	for _, hst := range vnDef.Host {
+		for _, ifaceDef := range hst.Networks {
+			if ifaceDef.Network == "" {
+				continue
+			}
+			if _, ok := networks[ifaceDef.Network]; ok {
+				continue
+			}
+			netwk, err := network.GetNetworkByName(ifaceDef.Network)
+			if err != nil {
+				return nil, err
+			}
+			networks[ifaceDef.Network] = structs.NetworkDefinition{
+				NetworkName: netwk.Name,
+				NetworkAddr: netwk.IP,
+				Netmask:     netwk.Netmask,
+				DHCPLower:   netwk.DHCPLower,
+				DHCPUpper:   netwk.DHCPUpper,
+			}
+		}
+	}
+
+	return networks, nil
+}
+
+// usedAddresses - the addresses the template already gives out on each network
+func usedAddresses(vnDef *structs.VirtualNetworkDefinition) (used map[string]bool) {
+	used = map[string]bool{}
+	for _, def := range vnDef.Networks {
+		if def.NetworkAddr != "" {
+			used[def.NetworkAddr] = true
+		}
+	}
+	for _, hst := range vnDef.Host {
+		for _, ifaceDef := range hst.Networks {
+			if ifaceDef.IP != "" {
+				used[ifaceDef.IP] = true
+			}
+			if ip, _, err := net.ParseCIDR(ifaceDef.Address); err == nil {
+				used[ip.String()] = true
+			}
+		}
+	}
+
+	return used
+}
+
+// addressRouter - gives a router interface the highest free address of its network
+func addressRouter(hostName string, ifaceDef *structs.InterfaceDefinition, networks map[string]structs.NetworkDefinition, used map[string]bool) (err error) {
+	if ifaceDef.IP != "" || ifaceDef.Address != "" || ifaceDef.UDP != nil {
+		return nil
+	}
+
+	def := networks[ifaceDef.Network]
+	if def.NetworkAddr == "" {
+		return nil
+	}
+	subnet, err := ipam.ParseSubnet(def.NetworkAddr, def.Netmask)
+	if err != nil {
+		return errors.Wrapf(err, "network %s", def.NetworkName)
+	}
+
+	// Count down from the address below the broadcast address
+	base := binary.BigEndian.Uint32(subnet.IP)
+	ones, _ := subnet.Mask.Size()
+	broadcast := base | (1<<uint(32-ones) - 1)
+	for addr := broadcast - 1; addr > base; addr-- {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, addr)
+		if used[ip.String()] {
+			continue
+		}
+		used[ip.String()] = true
+
+		// Reserve the address where the network has DHCP, otherwise set it in the guest
+		if def.DHCPLower != "" {
+			ifaceDef.IP = ip.String()
+		} else {
+			ifaceDef.Address = fmt.Sprintf("%s/%d", ip.String(), ones)
+		}
+		printing.PrintInfo(fmt.Sprintf("Addressed router %s as %s on network %s", hostName, ip.String(), def.NetworkName))
+		return nil
+	}
+
+	return errors.Errorf("host %s: no free address for the router on network %s", hostName, def.NetworkName)
+}
+
+// interfaceSubnet - returns the IPv4 subnet of an interface and its address on it, if known
+func interfaceSubnet(ifaceDef structs.InterfaceDefinition, networks map[string]structs.NetworkDefinition) (subnet string, ip string) {
+	// Addresses set in the guest carry their own prefix
+	if addr, ipNet, err := net.ParseCIDR(ifaceDef.Address); err == nil && addr.To4() != nil {
+		return ipNet.String(), addr.String()
+	}
+
+	def, ok := networks[ifaceDef.Network]
+	if !ok || def.NetworkAddr == "" {
+		return "", ""
+	}
+	ipNet, err := ipam.ParseSubnet(def.NetworkAddr, def.Netmask)
+	if err != nil {
+		return "", ""
+	}
+
+	return ipNet.String(), ifaceDef.IP
+}
+
+// hasRoute - reports whether the template already routes the subnet through one of the interfaces
+func hasRoute(ifaceDefs []structs.InterfaceDefinition, dest string) bool {
+	for _, ifaceDef := range ifaceDefs {
+		for _, route := range ifaceDef.Routes {
+			if _, ipNet, err := net.ParseCIDR(route.To); err == nil && ipNet.String() == dest {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sortedKeys - returns the keys of the set in order
+func sortedKeys(set map[string]bool) (keys []string) {
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedInts - returns the keys of the map in order
+func sortedInts(m map[int]string) (keys []int) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
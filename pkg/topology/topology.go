@@ -1,8 +1,11 @@
 package topology
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"strings"
 
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -10,6 +13,8 @@ import (
 	"nenvoy.com/pkg/constants"
 	"nenvoy.com/pkg/database"
 	"nenvoy.com/pkg/deployment"
+	"nenvoy.com/pkg/errdefs"
+	"nenvoy.com/pkg/events"
 	"nenvoy.com/pkg/host"
 	"nenvoy.com/pkg/network"
 	"nenvoy.com/pkg/utils/printing"
@@ -42,8 +47,28 @@ func BuildFromFile(filename string) (err error) {
 
 }
 
+// Progress - receives the steps of a long running operation as they happen
+type Progress interface {
+	// Step - records the step and how far through the operation it is, from 0 to 100
+	Step(message string, percent int)
+}
+
+// noProgress - discards the steps of operations run from the command line
+type noProgress struct{}
+
+// Step - discards the step
+func (noProgress) Step(message string, percent int) {}
+
 //Build - Build the virtual network
 func Build(vnDef structs.VirtualNetworkDefinition) (err error) {
+	return BuildContext(context.Background(), vnDef, noProgress{})
+}
+
+// BuildContext - Build the virtual network, reporting its progress
+//
+// Once ctx is cancelled the build stops before creating the next network or
+// host, and everything created so far is cleaned up.
+func BuildContext(ctx context.Context, vnDef structs.VirtualNetworkDefinition, progress Progress) (err error) {
 
 	printing.PrintInfo(fmt.Sprintf("Creating deployment %s...", vnDef.Deployment.DeploymentName))
 
@@ -53,72 +78,91 @@ func Build(vnDef structs.VirtualNetworkDefinition) (err error) {
 		return err
 	}
 
-	// Ensure the hosts, networks and deployments are migrated
-	err = migrateDatabase(db)
+	// Deployment names are required and unique
+	err = CheckDeploymentName(vnDef.Deployment.DeploymentName)
 	if err != nil {
 		return err
 	}
 
+	// Resolve network cidrs and check for overlapping subnets
+	progress.Step(fmt.Sprintf("Planning deployment %s", vnDef.Deployment.DeploymentName), 0)
+	err = planNetworks(&vnDef)
+	if err != nil {
+		return errdefs.Invalid(errors.Wrap(err, "failed to plan networks"))
+	}
+
+	// Add the interfaces and networks of the point-to-point links
+	err = planLinks(&vnDef)
+	if err != nil {
+		return errdefs.Invalid(errors.Wrap(err, "failed to plan links"))
+	}
+
+	// Address the routers and route the other hosts through them
+	err = planRoutes(&vnDef)
+	if err != nil {
+		return errdefs.Invalid(errors.Wrap(err, "failed to plan routes"))
+	}
+
+	// Default the dns domain and check the custom records
+	err = network.ValidateDNS(&vnDef.DNS, vnDef.Deployment.DeploymentName)
+	if err != nil {
+		return errdefs.Invalid(errors.Wrap(err, "failed to plan dns"))
+	}
+
+	// Check the template does not use a mac or address twice before anything is created
+	err = host.CheckAddresses(vnDef.Host, vnDef.Deployment.DeploymentName)
+	if err != nil {
+		return errdefs.Invalid(errors.Wrap(err, "failed to plan addresses"))
+	}
+
 	//Create the deployment from the virtual network definition
-	dep := &deployment.Deployment{Name: vnDef.Deployment.DeploymentName}
+	dep := &deployment.Deployment{Name: vnDef.Deployment.DeploymentName, Owner: vnDef.Deployment.Owner}
 
 	// Create the networks
-	err = createNetworks(vnDef, dep)
+	err = createNetworks(ctx, vnDef, dep, progress)
 	if err != nil {
 		creationError := errors.Wrap(err, "failed to create networks")
 		cleanupDeployment(dep)
+		events.Publish(events.Event{Kind: events.KindDeployment, Name: dep.Name, Deployment: dep.Name, Action: "failed", Detail: creationError.Error()})
 		return creationError
 	}
 
 	// Create the hosts
-	err = createHosts(vnDef, dep)
+	err = createHosts(ctx, vnDef, dep, progress)
 	if err != nil {
 		creationError := errors.Wrap(err, "failed to create hosts")
 		cleanupDeployment(dep)
+		events.Publish(events.Event{Kind: events.KindDeployment, Name: dep.Name, Deployment: dep.Name, Action: "failed", Detail: creationError.Error()})
 		return creationError
 	}
 
 	// Write the deployment to the database
 	db.Create(dep)
 
+	events.Publish(events.Event{Kind: events.KindDeployment, Name: dep.Name, Deployment: dep.Name, Action: "created"})
 	return nil
 
 }
 
 // StartDeployment - Starts the deployment by name
 func StartDeployment(depName string) (err error) {
-	// Get the deployment
-	dep, err := deployment.GetDeploymentByName(depName)
-	if err != nil {
-		return err
-	}
-
-	// Get the hosts which have the same deployment ID
-	hosts, err := host.GetHostsByDeployment(dep.ID)
-	if err != nil {
-		return err
-	}
-
-	for _, hst := range hosts {
-		// Start the host
-		err := hst.Start()
-		if err != nil {
-			return err
-		}
-	}
+	return StartDeploymentContext(context.Background(), depName, noProgress{})
+}
 
-	return nil
+// StartDeploymentContext - Starts the deployment by name, stopping before the next host once ctx is cancelled
+func StartDeploymentContext(ctx context.Context, depName string, progress Progress) (err error) {
+	return eachHost(ctx, depName, "Starting", progress, (*host.Host).Start)
 }
 
 // StartHost - Starts the host by name
 func StartHost(name string) (err error) {
 	// Get the hosts which have the same deployment ID
-	hst, err := host.GetHostByName(name)
+	hst, err := findHost(name)
 	if err != nil {
 		return err
 	}
 
-	//Start the host
+	// Start the host
 	err = hst.Start()
 	if err != nil {
 		return err
@@ -129,38 +173,23 @@ func StartHost(name string) (err error) {
 
 // RestartDeployment - Restarts the deployment by name
 func RestartDeployment(depName string) (err error) {
-	// Get the deployment
-	dep, err := deployment.GetDeploymentByName(depName)
-	if err != nil {
-		return err
-	}
-
-	// Get the hosts which have the same deployment ID
-	hosts, err := host.GetHostsByDeployment(dep.ID)
-	if err != nil {
-		return err
-	}
-
-	for _, hst := range hosts {
-		// Start the host
-		err := hst.Restart()
-		if err != nil {
-			return err
-		}
-	}
+	return RestartDeploymentContext(context.Background(), depName, noProgress{})
+}
 
-	return nil
+// RestartDeploymentContext - Restarts the deployment by name, stopping before the next host once ctx is cancelled
+func RestartDeploymentContext(ctx context.Context, depName string, progress Progress) (err error) {
+	return eachHost(ctx, depName, "Restarting", progress, (*host.Host).Restart)
 }
 
 // RestartHost - Restarts the host by name
 func RestartHost(name string) (err error) {
 	// Get the hosts which have the same deployment ID
-	hst, err := host.GetHostByName(name)
+	hst, err := findHost(name)
 	if err != nil {
 		return err
 	}
 
-	//Start the host
+	// Start the host
 	err = hst.Restart()
 	if err != nil {
 		return err
@@ -171,38 +200,23 @@ func RestartHost(name string) (err error) {
 
 // StopDeployment - Stops the deployment by name
 func StopDeployment(depName string) (err error) {
-	// Get the deployment
-	dep, err := deployment.GetDeploymentByName(depName)
-	if err != nil {
-		return err
-	}
-
-	// Get the hosts which have the same deployment ID
-	hosts, err := host.GetHostsByDeployment(dep.ID)
-	if err != nil {
-		return err
-	}
-
-	for _, hst := range hosts {
-		// Start the host
-		err := hst.Stop()
-		if err != nil {
-			return err
-		}
-	}
+	return StopDeploymentContext(context.Background(), depName, noProgress{})
+}
 
-	return nil
+// StopDeploymentContext - Stops the deployment by name, stopping before the next host once ctx is cancelled
+func StopDeploymentContext(ctx context.Context, depName string, progress Progress) (err error) {
+	return eachHost(ctx, depName, "Stopping", progress, (*host.Host).Stop)
 }
 
 // StopHost - Stops the host by name
 func StopHost(name string) (err error) {
 	// Get the hosts which have the same deployment ID
-	hst, err := host.GetHostByName(name)
+	hst, err := findHost(name)
 	if err != nil {
 		return err
 	}
 
-	//Start the host
+	// Start the host
 	err = hst.Stop()
 	if err != nil {
 		return err
@@ -211,8 +225,20 @@ func StopHost(name string) (err error) {
 	return nil
 }
 
-// DestroyDeployment - Stops the deployment by name
+// DestroyDeployment - Destroys the deployment by name with its hosts and networks
 func DestroyDeployment(depName string) (err error) {
+	return DestroyDeploymentContext(context.Background(), depName, noProgress{})
+}
+
+// DestroyDeploymentContext - Destroys the deployment by name, reporting its progress
+//
+// A cancelled ctx only stops the destroy before it starts, as a deployment
+// that is half destroyed can neither be used nor rebuilt.
+func DestroyDeploymentContext(ctx context.Context, depName string, progress Progress) (err error) {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
 	// Get the deployment
 	dep, err := deployment.GetDeploymentByName(depName)
 	if err != nil {
@@ -225,23 +251,25 @@ func DestroyDeployment(depName string) (err error) {
 		return err
 	}
 
+	// Get the networks which have the same deployment ID
+	networks, err := network.GetNetworksByDeployment(dep.ID)
+	if err != nil {
+		return err
+	}
+	steps := len(hosts) + len(networks) + 1
+
 	// Destroy hosts
-	for _, hst := range hosts {
-		// Start the host
+	for i, hst := range hosts {
+		progress.Step(fmt.Sprintf("Destroying host %s", hst.Name), 100*i/steps)
 		err := hst.Destroy()
 		if err != nil {
 			return err
 		}
 	}
 
-	// Get the hosts which have the same deployment ID
-	networks, err := network.GetNetworksByDeployment(dep.ID)
-	if err != nil {
-		return err
-	}
-
 	// Destroy networks
-	for _, netwk := range networks {
+	for i, netwk := range networks {
+		progress.Step(fmt.Sprintf("Destroying network %s", netwk.Name), 100*(len(hosts)+i)/steps)
 		err := netwk.Destroy()
 		if err != nil {
 			return err
@@ -254,18 +282,48 @@ func DestroyDeployment(depName string) (err error) {
 		return err
 	}
 
+	events.Publish(events.Event{Kind: events.KindDeployment, Name: dep.Name, Deployment: dep.Name, Action: "destroyed"})
+	return nil
+}
+
+// eachHost - runs the action on every host of the deployment, stopping before the next host once ctx is cancelled
+func eachHost(ctx context.Context, depName string, verb string, progress Progress, action func(*host.Host) error) (err error) {
+	// Get the deployment
+	dep, err := deployment.GetDeploymentByName(depName)
+	if err != nil {
+		return err
+	}
+
+	// Get the hosts which have the same deployment ID
+	hosts, err := host.GetHostsByDeployment(dep.ID)
+	if err != nil {
+		return err
+	}
+
+	for i := range hosts {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		progress.Step(fmt.Sprintf("%s host %s", verb, hosts[i].Name), 100*i/len(hosts))
+
+		err := action(&hosts[i])
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 //DestroyHost - Destroys a single host
 func DestroyHost(name string) (err error) {
 	// Get the hosts which have the same deployment ID
-	hst, err := host.GetHostByName(name)
+	hst, err := findHost(name)
 	if err != nil {
 		return err
 	}
 
-	//Start the host
+	// Start the host
 	err = hst.Destroy()
 	if err != nil {
 		return err
@@ -282,6 +340,16 @@ func migrateDatabase(db *gorm.DB) (err error) {
 		return errors.Wrap(err, "failed to migrate database: ")
 	}
 
+	err = db.AutoMigrate(&host.Interface{})
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate database: ")
+	}
+
+	err = db.AutoMigrate(&host.PortForward{})
+	if err != nil {
+		return errors.Wrap(err, "failed to migrate database: ")
+	}
+
 	err = db.AutoMigrate(&network.Network{})
 	if err != nil {
 		return errors.Wrap(err, "failed to migrate database: ")
@@ -295,17 +363,53 @@ func migrateDatabase(db *gorm.DB) (err error) {
 	return nil
 }
 
+// CheckDeploymentName - checks a deployment name is given and not already used
+func CheckDeploymentName(name string) (err error) {
+	// Connect and open the database
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	// Ensure the hosts, networks and deployments are migrated
+	err = migrateDatabase(db)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		return errdefs.Invalidf("deployment name is required")
+	}
+	_, err = deployment.GetDeploymentByName(name)
+	if err == nil {
+		return errdefs.Conflictf("deployment %s already exists", name)
+	} else if !errdefs.IsNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
 // createNetworks - Creates the networks in KVM and adds them to the deployment
-func createNetworks(vnDef constants.VirtualNetworkDefinition, dep *deployment.Deployment) (err error) {
+func createNetworks(ctx context.Context, vnDef constants.VirtualNetworkDefinition, dep *deployment.Deployment, progress Progress) (err error) {
 	printing.PrintInfo("Creating networks...")
 
 	// Create the network definitions and create them
-	for _, netwr := range vnDef.Networks {
+	for i, netwr := range vnDef.Networks {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		progress.Step(fmt.Sprintf("Creating network %s", netwr.NetworkName), buildPercent(i, vnDef))
+
 		net, err := network.DefineNetwork(netwr)
 		if err != nil {
 			return err
 		}
 
+		// Register hosts as <host>.<deployment>.<domain>
+		records := append(hostRecords(vnDef, netwr.NetworkName), vnDef.DNS.Records...)
+		net.SetDNS(fmt.Sprintf("%s.%s", strings.ToLower(dep.Name), vnDef.DNS.Domain), records)
+
 		// Create the network
 		err = net.CreateNetwork()
 		if err != nil {
@@ -315,25 +419,103 @@ func createNetworks(vnDef constants.VirtualNetworkDefinition, dep *deployment.De
 		// Append the network to the deployment
 		dep.Networks = append(dep.Networks, net)
 
-		printing.PrintSuccess(fmt.Sprintf("Created %s network %s with ip %s", netwr.Type, netwr.NetworkName, netwr.NetworkAddr))
+		ips := []string{}
+		if net.IP != "" {
+			ips = append(ips, net.IP)
+		}
+		if net.IPv6 != "" {
+			ips = append(ips, fmt.Sprintf("%s/%d", net.IPv6, net.IPv6Prefix))
+		}
+		if len(ips) == 0 {
+			printing.PrintSuccess(fmt.Sprintf("Created %s network %s", net.Type, net.Name))
+		} else {
+			printing.PrintSuccess(fmt.Sprintf("Created %s network %s with ip %s", net.Type, net.Name, strings.Join(ips, ", ")))
+		}
 	}
 
 	return nil
 }
 
+// hostRecords - the A and AAAA records of the hosts with a reserved or static address on the network
+//
+// dnsmasq only names DHCP clients from their leases, so hosts configured with
+// an address, routers and the ends of links are registered up front.
+func hostRecords(vnDef constants.VirtualNetworkDefinition, networkName string) (records []constants.DNSRecordDefinition) {
+	for _, hst := range vnDef.Host {
+		for _, ifaceDef := range hst.Networks {
+			if ifaceDef.Network != networkName {
+				continue
+			}
+
+			ips := []net.IP{net.ParseIP(ifaceDef.IP)}
+			if ip, _, err := net.ParseCIDR(ifaceDef.Address); err == nil {
+				ips = append(ips, ip)
+			}
+			for _, ip := range ips {
+				if ip == nil {
+					continue
+				}
+				recordType := network.RecordA
+				if ip.To4() == nil {
+					recordType = network.RecordAAAA
+				}
+				records = append(records, constants.DNSRecordDefinition{Name: strings.ToLower(hst.HostName), Type: recordType, Value: ip.String()})
+			}
+		}
+	}
+
+	return records
+}
+
 // createHosts - Creates the hosts in KVM and adds them to the deployment
-func createHosts(vnDef constants.VirtualNetworkDefinition, dep *deployment.Deployment) (err error) {
+func createHosts(ctx context.Context, vnDef constants.VirtualNetworkDefinition, dep *deployment.Deployment, progress Progress) (err error) {
 
 	printing.PrintInfo("Creating hosts...")
 
-	// Create the host definition files and create the hosts
+	// Hosts are only saved once the deployment is built, so check the template forwards each port once
+	forwarded := map[string]string{}
 	for _, hst := range vnDef.Host {
-		hostDB, err := host.DefineHost(hst)
+		for _, port := range hst.Ports {
+			key := fmt.Sprintf("%s/%d", strings.ToLower(port.Protocol), port.HostPort)
+			if port.Protocol == "" {
+				key = fmt.Sprintf("tcp/%d", port.HostPort)
+			}
+			if other, ok := forwarded[key]; ok && other != hst.HostName {
+				return errors.Errorf("port %s is forwarded to both %s and %s", key, other, hst.HostName)
+			}
+			forwarded[key] = hst.HostName
+		}
+	}
+
+	// Create the host definition files and create the hosts
+	for i, hst := range vnDef.Host {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		progress.Step(fmt.Sprintf("Creating host %s", hst.HostName), buildPercent(len(vnDef.Networks)+i, vnDef))
+
+		// Find the networks the host is attached to
+		networks := []network.Network{}
+		for _, iface := range hst.Networks {
+			// The ends of udp links have no network
+			if iface.UDP != nil {
+				networks = append(networks, network.Network{})
+				continue
+			}
+
+			netwk, err := findNetwork(dep, iface.Network)
+			if err != nil {
+				return errors.Wrapf(err, "host %s", hst.HostName)
+			}
+			networks = append(networks, netwk)
+		}
+
+		hostDB, err := host.DefineHost(hst, dep.Name, networks)
 		if err != nil {
 			return err
 		}
 
-		err = hostDB.CreateHost(hst.Networks)
+		err = hostDB.CreateHost()
 		if err != nil {
 			return err
 		}
@@ -347,6 +529,43 @@ func createHosts(vnDef constants.VirtualNetworkDefinition, dep *deployment.Deplo
 	return nil
 }
 
+// buildPercent - how far through the build creating the step'th network or host is
+func buildPercent(step int, vnDef constants.VirtualNetworkDefinition) int {
+	return 100 * step / (len(vnDef.Networks) + len(vnDef.Host) + 1)
+}
+
+// findHost - returns the host by name, or a not found error
+func findHost(name string) (hst host.Host, err error) {
+	hst, err = host.GetHostByName(name)
+	if err != nil {
+		return hst, err
+	}
+	if hst.Name == "" {
+		return hst, errdefs.NotFoundf("host %s not found", name)
+	}
+
+	return hst, nil
+}
+
+// findNetwork - returns a network being created in the deployment or already in the database
+func findNetwork(dep *deployment.Deployment, name string) (netwk network.Network, err error) {
+	for _, netwk := range dep.Networks {
+		if netwk.Name == name {
+			return netwk, nil
+		}
+	}
+
+	netwk, err = network.GetNetworkByName(name)
+	if err != nil {
+		return netwk, err
+	}
+	if netwk.Name == "" {
+		return netwk, errdefs.NotFoundf("network %s not found", name)
+	}
+
+	return netwk, nil
+}
+
 func cleanupDeployment(dep *deployment.Deployment) {
 	printing.PrintWarning("Build failed, starting cleanup...")
 	printing.PrintInfo("Starting cleanup due to error...")
@@ -363,3 +582,62 @@ func cleanupDeployment(dep *deployment.Deployment) {
 
 	printing.PrintSuccess("Cleanup finished")
 }
+
+// AddPort - Forwards a hypervisor port to the host by name
+func AddPort(name string, portDef structs.PortDefinition) (err error) {
+	// Connect and open the database
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	// Ensure the port forwards table exists for hosts built before it was added
+	err = migrateDatabase(db)
+	if err != nil {
+		return err
+	}
+
+	hst, err := findHost(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = hst.AddPort(portDef)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemovePort - Removes the forward of a hypervisor port to the host by name
+func RemovePort(name string, protocol string, hostPort int) (err error) {
+	hst, err := findHost(name)
+	if err != nil {
+		return err
+	}
+
+	return hst.RemovePort(protocol, hostPort)
+}
+
+// SetFirewall - Replaces the firewall of the host by name on the network, or on all its interfaces
+func SetFirewall(name string, networkName string, def structs.FirewallDefinition) (err error) {
+	// Connect and open the database
+	db, err := database.NewSession()
+	if err != nil {
+		return err
+	}
+
+	// Ensure the interfaces table has the firewall column for hosts built before it was added
+	err = migrateDatabase(db)
+	if err != nil {
+		return err
+	}
+
+	hst, err := findHost(name)
+	if err != nil {
+		return err
+	}
+
+	return hst.SetFirewall(networkName, def)
+}
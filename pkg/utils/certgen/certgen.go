@@ -82,7 +82,7 @@ func CreateCertKeyPair(certPath, keyPath, CACertPath, CAKeyPath, commonName, org
 func GenCACSR(commonName string) (caCSR *x509.Certificate) {
 
 	caCSR = &x509.Certificate{
-		SerialNumber: big.NewInt(2019),
+		SerialNumber: randomSerial(),
 		Subject: pkix.Name{
 			CommonName: commonName,
 		},
@@ -97,6 +97,15 @@ func GenCACSR(commonName string) (caCSR *x509.Certificate) {
 	return caCSR
 }
 
+// randomSerial - Generate a random serial number, clients reject certificates from one CA sharing a serial
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
 // GenPKey - Generate a RSA private key, default 4096
 func GenPKey() (caPrivKey *rsa.PrivateKey, err error) {
 
@@ -157,7 +166,7 @@ func GenCSR(commonName string, organisation string, ipAddresses []net.IP, dnsNam
 	}
 
 	csr = &x509.Certificate{
-		SerialNumber: big.NewInt(1658),
+		SerialNumber: randomSerial(),
 		Subject:      subject,
 		IPAddresses:  ipAddresses,
 		DNSNames:     dnsNames,
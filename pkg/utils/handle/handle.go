@@ -4,8 +4,10 @@ import (
 	"log"
 	"os"
 	"os/user"
+	"path/filepath"
 	"runtime/debug"
 
+	"nenvoy.com/pkg/config"
 	"nenvoy.com/pkg/utils/printing"
 )
 
@@ -13,13 +15,14 @@ import (
 func Error(inerr error) {
 	if inerr != nil {
 		//If the directiory doesnt exit, make it
-		err := os.MkdirAll("/tmp/nenvoy/", 0777)
+		logFile := config.Get().LogFile
+		err := os.MkdirAll(filepath.Dir(logFile), 0777)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		//create log file file with desired read/write permissions if it doesnt already exist
-		f, err := os.OpenFile("/tmp/nenvoy/nenvn.log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
+		f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0777)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,108 @@
+package iptables
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	cmd "nenvoy.com/pkg/utils/cmd"
+)
+
+// Forward - a port on the hypervisor forwarded to a guest address
+type Forward struct {
+	Protocol  string
+	HostPort  int
+	GuestIP   string
+	GuestPort int
+	// Comment - tags the rules so they can be told apart from other rules
+	Comment string
+}
+
+// rule - an iptables rule and where it goes
+type rule struct {
+	table  string
+	chain  string
+	insert bool
+	spec   []string
+}
+
+// rules - the DNAT rule and the rule letting the forwarded traffic through
+func (f Forward) rules() []rule {
+	hostPort := strconv.Itoa(f.HostPort)
+	guestPort := strconv.Itoa(f.GuestPort)
+
+	return []rule{
+		{
+			// Rewrite connections to the hypervisor's own addresses
+			table: "nat",
+			chain: "PREROUTING",
+			spec: []string{"-p", f.Protocol, "--dport", hostPort, "-m", "addrtype", "--dst-type", "LOCAL",
+				"-m", "comment", "--comment", f.Comment, "-j", "DNAT", "--to-destination", fmt.Sprintf("%s:%d", f.GuestIP, f.GuestPort)},
+		},
+		{
+			// libvirt rejects new connections into NAT networks, so accept ahead of its rules
+			table:  "filter",
+			chain:  "FORWARD",
+			insert: true,
+			spec: []string{"-d", f.GuestIP, "-p", f.Protocol, "--dport", guestPort, "-m", "conntrack", "--ctstate", "NEW",
+				"-m", "comment", "--comment", f.Comment, "-j", "ACCEPT"},
+		},
+	}
+}
+
+// Apply - adds the rules of the forward that are missing
+func Apply(f Forward) (err error) {
+	for _, r := range f.rules() {
+		if exists(r) {
+			continue
+		}
+
+		args := []string{"-t", r.table, "-A", r.chain}
+		if r.insert {
+			args = []string{"-t", r.table, "-I", r.chain, "1"}
+		}
+
+		_, stderr, err := cmd.Output("iptables", append(args, r.spec...)...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to add %s %s rule: %s", r.table, r.chain, stderr)
+		}
+	}
+
+	return nil
+}
+
+// Remove - deletes the rules of the forward, ignoring rules already gone
+func Remove(f Forward) (err error) {
+	for _, r := range f.rules() {
+		if !exists(r) {
+			continue
+		}
+
+		args := append([]string{"-t", r.table, "-D", r.chain}, r.spec...)
+		_, stderr, err := cmd.Output("iptables", args...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove %s %s rule: %s", r.table, r.chain, stderr)
+		}
+	}
+
+	return nil
+}
+
+// Active - reports whether all the rules of the forward are in place
+func Active(f Forward) bool {
+	for _, r := range f.rules() {
+		if !exists(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// exists - checks for the rule with iptables -C
+func exists(r rule) bool {
+	args := append([]string{"-t", r.table, "-C", r.chain}, r.spec...)
+	_, _, err := cmd.Output("iptables", args...)
+	return err == nil
+}
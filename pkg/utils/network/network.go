@@ -22,8 +22,24 @@ type Ethernet struct {
 }
 
 type Iface struct {
+	Match     *Match   `yaml:"match,omitempty"`
+	SetName   string   `yaml:"set-name,omitempty"`
 	Addresses []string `yaml:"addresses,omitempty"`
 	DHCP4     *bool    `yaml:"dhcp4,omitempty"`
+	DHCP6     *bool    `yaml:"dhcp6,omitempty"`
+	MTU       int      `yaml:"mtu,omitempty"`
+	Routes    []Route  `yaml:"routes,omitempty"`
+}
+
+// Route - a static route of a netplan interface
+type Route struct {
+	To  string `yaml:"to"`
+	Via string `yaml:"via"`
+}
+
+// Match - selects the interface a netplan config applies to
+type Match struct {
+	MACAddress string `yaml:"macaddress,omitempty"`
 }
 
 var ipNotFoundErr = errors.New("IP Address of interface not found")
@@ -47,8 +63,7 @@ func UpdateNetplanStatic(adapter string, ip string, prefix string) (err error) {
 
 	//Add the new interface into the struct
 	newIface := Iface{
-		[]string{ip + "/" + prefix},
-		nil,
+		Addresses: []string{ip + "/" + prefix},
 	}
 	n.Network.Ethernets[adapter] = Ethernet{newIface}
 
@@ -170,6 +185,37 @@ func GetInterface(ipAddr net.IP) (ifaceName string, err error) {
 	return "", nil
 }
 
+// GetInterfaceNetworks - Returns the IPv4 networks assigned to each interface by interface name
+func GetInterfaceNetworks() (networks map[string][]*net.IPNet, err error) {
+
+	// Get interfaces of localhost
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	networks = map[string][]*net.IPNet{}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, errors.Wrap(err, "Could not collect addresses")
+		}
+
+		for _, addr := range addrs {
+			_, ipNet, err := net.ParseCIDR(addr.String())
+			if err != nil {
+				return nil, errors.Wrap(err, "Could not parse ip")
+			}
+
+			if ipNet.IP.To4() != nil {
+				networks[iface.Name] = append(networks[iface.Name], ipNet)
+			}
+		}
+	}
+
+	return networks, nil
+}
+
 // InterfaceExists - Checks if an interface exists
 func InterfaceExists(ifaceName string) (exists bool, err error) {
 	// Get interfaces of localhost
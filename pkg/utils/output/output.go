@@ -0,0 +1,288 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// FormatTable - the default columns as a table
+	FormatTable = ""
+	// FormatWide - every column as a table
+	FormatWide = "wide"
+	// FormatJSON - the objects as the api marshals them
+	FormatJSON = "json"
+	// FormatYAML - the objects as the api marshals them, in YAML
+	FormatYAML = "yaml"
+	// FormatName - kind/name of each object, one per line
+	FormatName = "name"
+	// FormatCustomColumns - the prefix of custom-columns=HEADER:.Field,..., a table of the columns given
+	FormatCustomColumns = "custom-columns="
+)
+
+// Column - a column of a table, either a field of the objects or a value computed from them
+type Column struct {
+	Header string
+	// Field - the dotted path of the field, as the objects are marshalled to JSON
+	Field string
+	// Value - computes the column instead of reading a field, when set
+	Value func(item Item) string
+	// Wide - only shown with -o wide
+	Wide bool
+}
+
+// Item - an object being printed, as the fields it is marshalled to JSON with
+type Item map[string]interface{}
+
+// Printer - prints objects of a kind in a format
+type Printer struct {
+	Kind    string
+	Format  string
+	Columns []Column
+}
+
+// NewPrinter - returns a printer of the kind's objects in the format, with the columns of its tables
+func NewPrinter(format string, kind string, columns []Column) (p *Printer, err error) {
+	p = &Printer{Kind: kind, Format: format}
+
+	switch {
+	case format == FormatTable:
+		for _, column := range columns {
+			if !column.Wide {
+				p.Columns = append(p.Columns, column)
+			}
+		}
+	case format == FormatWide:
+		p.Columns = columns
+	case format == FormatJSON, format == FormatYAML, format == FormatName:
+	case strings.HasPrefix(format, FormatCustomColumns):
+		p.Columns, err = parseCustomColumns(strings.TrimPrefix(format, FormatCustomColumns))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected json, yaml, wide, name or custom-columns=HEADER:.Field,...", format)
+	}
+
+	return p, nil
+}
+
+// IsTable - reports whether the objects are printed as a table, for people rather than scripts
+func (p *Printer) IsTable() bool {
+	return p.Format == FormatTable || p.Format == FormatWide
+}
+
+// Print - writes the slice of objects in the printer's format
+func (p *Printer) Print(w io.Writer, items interface{}) (err error) {
+	switch {
+	case p.Format == FormatJSON:
+		buf, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", buf)
+		return err
+	case p.Format == FormatYAML:
+		buf, err := toYAML(items)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf)
+		return err
+	}
+
+	rows, err := Items(items)
+	if err != nil {
+		return err
+	}
+
+	if p.Format == FormatName {
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s/%s\n", p.Kind, row.Get("Name"))
+		}
+		return nil
+	}
+
+	// Create the table and print the rows
+	tw := tabwriter.NewWriter(w, 1, 1, 1, ' ', 0)
+	headers := []string{}
+	for _, column := range p.Columns {
+		headers = append(headers, column.Header)
+	}
+	fmt.Fprintf(tw, "%s\t\n", strings.Join(headers, "\t"))
+
+	for _, row := range rows {
+		values := []string{}
+		for _, column := range p.Columns {
+			values = append(values, row.Column(column))
+		}
+		fmt.Fprintf(tw, "%s\n", strings.Join(values, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// Column - returns the object's value in the column
+func (i Item) Column(column Column) string {
+	if column.Value != nil {
+		return column.Value(i)
+	}
+	return i.Get(column.Field)
+}
+
+// Get - returns the field at the dotted path as text, matching names in any case, empty if it is not set
+func (i Item) Get(path string) string {
+	var value interface{} = map[string]interface{}(i)
+	for _, name := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = nil
+		for key, field := range fields {
+			if strings.EqualFold(key, name) {
+				value = field
+				break
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		buf, _ := json.Marshal(v)
+		return string(buf)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Requirement - a field of the objects compared with a value
+type Requirement struct {
+	Field  string
+	Equals bool
+	Value  string
+}
+
+// Selector - the requirements an object must meet to be printed, every object if empty
+type Selector []Requirement
+
+// ParseSelector - parses a comma separated list of field=value and field!=value
+func ParseSelector(selector string) (s Selector, err error) {
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		r := Requirement{Equals: true}
+		parts := strings.SplitN(term, "!=", 2)
+		if len(parts) == 2 {
+			r.Equals = false
+		} else {
+			parts = strings.SplitN(strings.Replace(term, "==", "=", 1), "=", 2)
+		}
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid selector %q, expected field=value or field!=value", term)
+		}
+		r.Field, r.Value = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		s = append(s, r)
+	}
+
+	return s, nil
+}
+
+// Match - reports whether the object meets every requirement
+func (s Selector) Match(item Item) bool {
+	for _, r := range s {
+		if (item.Get(r.Field) == r.Value) != r.Equals {
+			return false
+		}
+	}
+	return true
+}
+
+// Select - returns the objects of the slice matching the selector, in a slice of the same type
+func Select(items interface{}, s Selector) (selected interface{}, err error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return nil, errors.Errorf("expected a slice of objects, got %T", items)
+	}
+
+	rows, err := Items(items)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := reflect.MakeSlice(v.Type(), 0, v.Len())
+	for i, row := range rows {
+		if s.Match(row) {
+			matched = reflect.Append(matched, v.Index(i))
+		}
+	}
+
+	return matched.Interface(), nil
+}
+
+// Items - returns the slice of objects as the fields they are marshalled to JSON with
+func Items(items interface{}) (rows []Item, err error) {
+	buf, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// Numbers are kept as written, rather than as floats
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+	err = decoder.Decode(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "expected a slice of objects")
+	}
+
+	return rows, nil
+}
+
+// toYAML - returns the objects in YAML, with the keys and order they are marshalled to JSON with
+func toYAML(items interface{}) (buf []byte, err error) {
+	buf, err = json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is YAML, so reading it keeps the api's keys
+	objects := []yaml.MapSlice{}
+	err = yaml.Unmarshal(buf, &objects)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return []byte("[]\n"), nil
+	}
+
+	return yaml.Marshal(objects)
+}
+
+// parseCustomColumns - parses HEADER:.Field,... into columns
+func parseCustomColumns(spec string) (columns []Column, err error) {
+	for _, column := range strings.Split(spec, ",") {
+		parts := strings.SplitN(column, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || strings.TrimPrefix(parts[1], ".") == "" {
+			return nil, fmt.Errorf("invalid custom column %q, expected HEADER:.Field", column)
+		}
+		columns = append(columns, Column{Header: parts[0], Field: parts[1]})
+	}
+
+	return columns, nil
+}
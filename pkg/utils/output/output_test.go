@@ -0,0 +1,92 @@
+package output_test
+
+import (
+	"bytes"
+	"testing"
+
+	"nenvoy.com/pkg/utils/output"
+)
+
+// host - an object printed in the tests
+type host struct {
+	Name       string
+	State      string
+	RAM        int
+	Deployment string
+}
+
+var hosts = []host{
+	{Name: "web1", State: "running", RAM: 2048, Deployment: "lab"},
+	{Name: "db1", State: "off", RAM: 1048576, Deployment: "prod"},
+}
+
+var columns = []output.Column{
+	{Header: "Name", Field: "Name"},
+	{Header: "State", Value: func(i output.Item) string { return "<" + i.Get("state") + ">" }},
+	{Header: "RAM", Field: "RAM", Wide: true},
+}
+
+// TestPrint - prints the objects in every format
+func TestPrint(t *testing.T) {
+	tests := map[string]string{
+		"":     "Name State \nweb1 <running>\ndb1  <off>\n",
+		"wide": "Name State     RAM \nweb1 <running> 2048\ndb1  <off>     1048576\n",
+		"custom-columns=HOST:.Name,DEP:.deployment": "HOST DEP \nweb1 lab\ndb1  prod\n",
+		"name": "host/web1\nhost/db1\n",
+		"yaml": "- Name: web1\n  State: running\n  RAM: 2048\n  Deployment: lab\n- Name: db1\n  State: \"off\"\n  RAM: 1048576\n  Deployment: prod\n",
+	}
+	for format, expected := range tests {
+		p, err := output.NewPrinter(format, "host", columns)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		buf := &bytes.Buffer{}
+		err = p.Print(buf, hosts)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		if buf.String() != expected {
+			t.Errorf("format %q printed\n%q, expected\n%q", format, buf.String(), expected)
+		}
+	}
+
+	for _, format := range []string{"xml", "custom-columns=NAME", "custom-columns=NAME:."} {
+		_, err := output.NewPrinter(format, "host", columns)
+		if err == nil {
+			t.Errorf("format %q was accepted", format)
+		}
+	}
+}
+
+// TestSelect - keeps the objects matching every requirement, in a slice of their type
+func TestSelect(t *testing.T) {
+	tests := map[string][]string{
+		"":                         {"web1", "db1"},
+		"deployment=lab":           {"web1"},
+		"state!=running":           {"db1"},
+		"ram==1048576,state=off":   {"db1"},
+		"deployment=lab,state=off": {},
+	}
+	for selector, expected := range tests {
+		s, err := output.ParseSelector(selector)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		selected, err := output.Select(hosts, s)
+		if err != nil {
+			t.Fatalf("%s", err)
+		}
+		names := []string{}
+		for _, h := range selected.([]host) {
+			names = append(names, h.Name)
+		}
+		if len(names) != len(expected) || (len(names) > 0 && names[0] != expected[0]) {
+			t.Errorf("selector %q selected %v, expected %v", selector, names, expected)
+		}
+	}
+
+	_, err := output.ParseSelector("running")
+	if err == nil {
+		t.Errorf("selector without a value was accepted")
+	}
+}
@@ -0,0 +1,27 @@
+package ovs
+
+import (
+	"github.com/pkg/errors"
+
+	cmd "nenvoy.com/pkg/utils/cmd"
+)
+
+// AddBridge - creates the Open vSwitch bridge if it does not already exist
+func AddBridge(name string) (err error) {
+	_, stderr, err := cmd.Output("ovs-vsctl", "--may-exist", "add-br", name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create ovs bridge %s: %s", name, stderr)
+	}
+
+	return nil
+}
+
+// DeleteBridge - removes the Open vSwitch bridge if it exists
+func DeleteBridge(name string) (err error) {
+	_, stderr, err := cmd.Output("ovs-vsctl", "--if-exists", "del-br", name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove ovs bridge %s: %s", name, stderr)
+	}
+
+	return nil
+}
@@ -0,0 +1,356 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter - decides whether an ethernet frame should be kept
+//
+// Filters are compiled from a subset of the tcpdump expression syntax:
+// the protocols ether, vlan, arp, ip, ip6, tcp, udp, icmp and icmp6,
+// [src|dst] host ADDR, [src|dst] net CIDR, [src|dst] port N and
+// portrange N-M, combined with and/&&, or/|| and not/! and grouped with
+// parentheses. A protocol may qualify a port, as in "tcp port 22".
+type Filter func(frame []byte) bool
+
+// packet - the fields of a decoded frame that filters match against
+type packet struct {
+	vlan      bool
+	etherType uint16
+	proto     int
+	src, dst  net.IP
+	sport     int
+	dport     int
+	hasPorts  bool
+}
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeVLAN = 0x8100
+	etherTypeIPv6 = 0x86dd
+
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+	protoSCTP   = 132
+)
+
+// decode - extracts the fields used by filters from an ethernet frame
+func decode(frame []byte) (p packet) {
+	p.proto = -1
+	if len(frame) < 14 {
+		return p
+	}
+
+	offset := 12
+	p.etherType = binary.BigEndian.Uint16(frame[offset:])
+	for p.etherType == etherTypeVLAN && len(frame) >= offset+6 {
+		p.vlan = true
+		offset += 4
+		p.etherType = binary.BigEndian.Uint16(frame[offset:])
+	}
+	payload := frame[offset+2:]
+
+	l4 := []byte(nil)
+	switch p.etherType {
+	case etherTypeIPv4:
+		if len(payload) < 20 {
+			return p
+		}
+		ihl := int(payload[0]&0x0f) * 4
+		p.proto = int(payload[9])
+		p.src = net.IP(payload[12:16])
+		p.dst = net.IP(payload[16:20])
+		if len(payload) > ihl {
+			l4 = payload[ihl:]
+		}
+	case etherTypeIPv6:
+		if len(payload) < 40 {
+			return p
+		}
+		p.proto = int(payload[6])
+		p.src = net.IP(payload[8:24])
+		p.dst = net.IP(payload[24:40])
+		l4 = payload[40:]
+	case etherTypeARP:
+		if len(payload) < 28 {
+			return p
+		}
+		p.src = net.IP(payload[14:18])
+		p.dst = net.IP(payload[24:28])
+	}
+
+	switch p.proto {
+	case protoTCP, protoUDP, protoSCTP:
+		if len(l4) >= 4 {
+			p.sport = int(binary.BigEndian.Uint16(l4[0:]))
+			p.dport = int(binary.BigEndian.Uint16(l4[2:]))
+			p.hasPorts = true
+		}
+	}
+
+	return p
+}
+
+// predicate - a compiled filter primitive
+type predicate func(p *packet) bool
+
+// CompileFilter - compiles a filter expression, an empty expression keeps every frame
+func CompileFilter(expr string) (Filter, error) {
+	tokens := tokenise(expr)
+	if len(tokens) == 0 {
+		return func([]byte) bool { return true }, nil
+	}
+
+	c := &compiler{tokens: tokens}
+	pred, err := c.parseOr()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid filter %q", expr)
+	}
+	if c.pos != len(c.tokens) {
+		return nil, errors.Errorf("invalid filter %q: unexpected %q", expr, c.tokens[c.pos])
+	}
+
+	return func(frame []byte) bool {
+		p := decode(frame)
+		return pred(&p)
+	}, nil
+}
+
+// tokenise - splits a filter expression into words, operators and parentheses
+func tokenise(expr string) (tokens []string) {
+	for _, sep := range []string{"(", ")", "!", "&&", "||"} {
+		expr = strings.ReplaceAll(expr, sep, " "+sep+" ")
+	}
+
+	return strings.Fields(expr)
+}
+
+// compiler - recursive descent parser over the filter tokens
+type compiler struct {
+	tokens []string
+	pos    int
+}
+
+// peek - returns the next token without consuming it
+func (c *compiler) peek() string {
+	if c.pos < len(c.tokens) {
+		return c.tokens[c.pos]
+	}
+	return ""
+}
+
+// next - consumes and returns the next token
+func (c *compiler) next() (tok string, err error) {
+	if c.pos >= len(c.tokens) {
+		return "", errors.New("unexpected end of expression")
+	}
+	tok = c.tokens[c.pos]
+	c.pos++
+	return tok, nil
+}
+
+// parseOr - expr := term { or term }
+func (c *compiler) parseOr() (predicate, error) {
+	left, err := c.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for c.peek() == "or" || c.peek() == "||" {
+		c.pos++
+		right, err := c.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(p *packet) bool { return l(p) || right(p) }
+	}
+
+	return left, nil
+}
+
+// parseAnd - term := factor { and factor }
+func (c *compiler) parseAnd() (predicate, error) {
+	left, err := c.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for c.peek() == "and" || c.peek() == "&&" {
+		c.pos++
+		right, err := c.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(p *packet) bool { return l(p) && right(p) }
+	}
+
+	return left, nil
+}
+
+// parseNot - factor := not factor | ( expr ) | primitive
+func (c *compiler) parseNot() (predicate, error) {
+	switch c.peek() {
+	case "not", "!":
+		c.pos++
+		inner, err := c.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(p *packet) bool { return !inner(p) }, nil
+	case "(":
+		c.pos++
+		inner, err := c.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, err := c.next(); err != nil || tok != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return inner, nil
+	}
+
+	return c.parsePrimitive()
+}
+
+// parsePrimitive - parses a protocol, host, net or port primitive
+func (c *compiler) parsePrimitive() (predicate, error) {
+	tok, err := c.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case "ether":
+		return func(p *packet) bool { return true }, nil
+	case "vlan":
+		return func(p *packet) bool { return p.vlan }, nil
+	case "arp":
+		return etherTypeIs(etherTypeARP), nil
+	case "ip":
+		return etherTypeIs(etherTypeIPv4), nil
+	case "ip6":
+		return etherTypeIs(etherTypeIPv6), nil
+	case "icmp":
+		return protoIs(protoICMP), nil
+	case "icmp6":
+		return protoIs(protoICMPv6), nil
+	case "tcp", "udp", "sctp":
+		proto := map[string]int{"tcp": protoTCP, "udp": protoUDP, "sctp": protoSCTP}[tok]
+		isProto := protoIs(proto)
+		// A protocol may qualify the port primitive that follows it
+		switch c.peek() {
+		case "port", "portrange", "src", "dst":
+			ports, err := c.parsePrimitive()
+			if err != nil {
+				return nil, err
+			}
+			return func(p *packet) bool { return isProto(p) && ports(p) }, nil
+		}
+		return isProto, nil
+	case "src", "dst":
+		kind, err := c.next()
+		if err != nil {
+			return nil, err
+		}
+		return c.parseQualified(tok, kind)
+	case "host", "net", "port", "portrange":
+		return c.parseQualified("", tok)
+	}
+
+	return nil, errors.Errorf("unknown primitive %q", tok)
+}
+
+// parseQualified - parses the argument of a host, net, port or portrange primitive
+func (c *compiler) parseQualified(dir string, kind string) (predicate, error) {
+	arg, err := c.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "host":
+		ip := net.ParseIP(arg)
+		if ip == nil {
+			return nil, errors.Errorf("invalid host address %q", arg)
+		}
+		return matchAddr(dir, func(a net.IP) bool { return a.Equal(ip) }), nil
+	case "net":
+		_, ipNet, err := net.ParseCIDR(arg)
+		if err != nil {
+			return nil, errors.Errorf("invalid network %q", arg)
+		}
+		return matchAddr(dir, func(a net.IP) bool { return ipNet.Contains(a) }), nil
+	case "port":
+		port, err := strconv.Atoi(arg)
+		if err != nil || port < 0 || port > 65535 {
+			return nil, errors.Errorf("invalid port %q", arg)
+		}
+		return matchPort(dir, port, port), nil
+	case "portrange":
+		bounds := strings.SplitN(arg, "-", 2)
+		if len(bounds) != 2 {
+			return nil, errors.Errorf("invalid port range %q", arg)
+		}
+		low, errLow := strconv.Atoi(bounds[0])
+		high, errHigh := strconv.Atoi(bounds[1])
+		if errLow != nil || errHigh != nil || low > high {
+			return nil, errors.Errorf("invalid port range %q", arg)
+		}
+		return matchPort(dir, low, high), nil
+	}
+
+	return nil, errors.Errorf("expected host, net, port or portrange after %s, got %q", dir, kind)
+}
+
+// etherTypeIs - matches frames of the given ethertype
+func etherTypeIs(etherType uint16) predicate {
+	return func(p *packet) bool { return p.etherType == etherType }
+}
+
+// protoIs - matches IPv4 or IPv6 packets carrying the given protocol
+func protoIs(proto int) predicate {
+	return func(p *packet) bool { return p.proto == proto }
+}
+
+// matchAddr - matches the source and/or destination address
+func matchAddr(dir string, match func(net.IP) bool) predicate {
+	return func(p *packet) bool {
+		src := p.src != nil && match(p.src)
+		dst := p.dst != nil && match(p.dst)
+		switch dir {
+		case "src":
+			return src
+		case "dst":
+			return dst
+		}
+		return src || dst
+	}
+}
+
+// matchPort - matches the source and/or destination port within a range
+func matchPort(dir string, low int, high int) predicate {
+	return func(p *packet) bool {
+		if !p.hasPorts {
+			return false
+		}
+		src := p.sport >= low && p.sport <= high
+		dst := p.dport >= low && p.dport <= high
+		switch dir {
+		case "src":
+			return src
+		case "dst":
+			return dst
+		}
+		return src || dst
+	}
+}
@@ -0,0 +1,126 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// FormatPcap - classic libpcap file format
+	FormatPcap = "pcap"
+	// FormatPcapNG - pcap next generation file format
+	FormatPcapNG = "pcapng"
+
+	// DefaultSnapLen - the default maximum number of bytes captured per packet
+	DefaultSnapLen = 262144
+
+	// linkTypeEthernet - LINKTYPE_ETHERNET, all vngen devices are ethernet
+	linkTypeEthernet = 1
+)
+
+// Writer - writes captured packets in a capture file format
+type Writer interface {
+	WritePacket(ts time.Time, data []byte, origLen int) error
+}
+
+// NewWriter - returns a writer for the given format and writes the file header
+func NewWriter(w io.Writer, format string, snapLen int) (Writer, error) {
+	if snapLen <= 0 {
+		snapLen = DefaultSnapLen
+	}
+
+	switch format {
+	case FormatPcap, "":
+		pw := &pcapWriter{w: w}
+		return pw, pw.writeHeader(snapLen)
+	case FormatPcapNG:
+		nw := &pcapngWriter{w: w}
+		return nw, nw.writeHeader(snapLen)
+	}
+
+	return nil, errors.Errorf("unknown capture format %q, expected %s or %s", format, FormatPcap, FormatPcapNG)
+}
+
+// pcapWriter - writes the classic libpcap format with microsecond timestamps
+type pcapWriter struct {
+	w io.Writer
+}
+
+// writeHeader - writes the pcap global header
+func (p *pcapWriter) writeHeader(snapLen int) (err error) {
+	hdr := make([]byte, 24)
+	binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(hdr[4:], 2)
+	binary.LittleEndian.PutUint16(hdr[6:], 4)
+	binary.LittleEndian.PutUint32(hdr[16:], uint32(snapLen))
+	binary.LittleEndian.PutUint32(hdr[20:], linkTypeEthernet)
+
+	_, err = p.w.Write(hdr)
+	return err
+}
+
+// WritePacket - writes a single packet record
+func (p *pcapWriter) WritePacket(ts time.Time, data []byte, origLen int) (err error) {
+	rec := make([]byte, 16+len(data))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(ts.Unix()))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(ts.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(rec[8:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(rec[12:], uint32(origLen))
+	copy(rec[16:], data)
+
+	_, err = p.w.Write(rec)
+	return err
+}
+
+// pcapngWriter - writes a single section, single interface pcapng file
+type pcapngWriter struct {
+	w io.Writer
+}
+
+// writeHeader - writes the section header and interface description blocks
+func (p *pcapngWriter) writeHeader(snapLen int) (err error) {
+	// Section header block
+	shb := make([]byte, 28)
+	binary.LittleEndian.PutUint32(shb[0:], 0x0a0d0d0a)
+	binary.LittleEndian.PutUint32(shb[4:], 28)
+	binary.LittleEndian.PutUint32(shb[8:], 0x1a2b3c4d)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	binary.LittleEndian.PutUint16(shb[14:], 0)
+	binary.LittleEndian.PutUint64(shb[16:], 0xffffffffffffffff)
+	binary.LittleEndian.PutUint32(shb[24:], 28)
+
+	// Interface description block, default timestamp resolution is microseconds
+	idb := make([]byte, 20)
+	binary.LittleEndian.PutUint32(idb[0:], 1)
+	binary.LittleEndian.PutUint32(idb[4:], 20)
+	binary.LittleEndian.PutUint16(idb[8:], linkTypeEthernet)
+	binary.LittleEndian.PutUint32(idb[12:], uint32(snapLen))
+	binary.LittleEndian.PutUint32(idb[16:], 20)
+
+	_, err = p.w.Write(append(shb, idb...))
+	return err
+}
+
+// WritePacket - writes a single enhanced packet block
+func (p *pcapngWriter) WritePacket(ts time.Time, data []byte, origLen int) (err error) {
+	padded := (len(data) + 3) &^ 3
+	total := 32 + padded
+	usec := uint64(ts.UnixNano() / 1000)
+
+	epb := make([]byte, total)
+	binary.LittleEndian.PutUint32(epb[0:], 6)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(total))
+	binary.LittleEndian.PutUint32(epb[8:], 0)
+	binary.LittleEndian.PutUint32(epb[12:], uint32(usec>>32))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(usec))
+	binary.LittleEndian.PutUint32(epb[20:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(epb[24:], uint32(origLen))
+	copy(epb[28:], data)
+	binary.LittleEndian.PutUint32(epb[total-4:], uint32(total))
+
+	_, err = p.w.Write(epb)
+	return err
+}
@@ -0,0 +1,99 @@
+package pcap_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"nenvoy.com/pkg/utils/pcap"
+)
+
+// tcpFrame - builds an ethernet/IPv4/TCP frame between two endpoints
+func tcpFrame(src, dst string, sport, dport uint16) []byte {
+	frame := make([]byte, 14+20+20)
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	ip := frame[14:]
+	ip[0] = 0x45
+	ip[9] = 6
+	copy(ip[12:], net.ParseIP(src).To4())
+	copy(ip[16:], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(ip[20:], sport)
+	binary.BigEndian.PutUint16(ip[22:], dport)
+	return frame
+}
+
+// TestCompileFilter
+func TestCompileFilter(t *testing.T) {
+	ssh := tcpFrame("20.0.0.2", "20.0.0.3", 40000, 22)
+
+	cases := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"tcp", true},
+		{"udp", false},
+		{"ip and not arp", true},
+		{"tcp port 22", true},
+		{"udp port 22", false},
+		{"dst port 22 && src host 20.0.0.2", true},
+		{"src port 22", false},
+		{"portrange 20-25", true},
+		{"net 20.0.0.0/24", true},
+		{"host 10.0.0.1 or (tcp and dst host 20.0.0.3)", true},
+		{"!tcp", false},
+	}
+
+	for _, c := range cases {
+		filter, err := pcap.CompileFilter(c.expr)
+		if err != nil {
+			t.Fatalf("failed to compile %q: %s", c.expr, err)
+		}
+		if filter(ssh) != c.match {
+			t.Errorf("filter %q: expected match %t", c.expr, c.match)
+		}
+	}
+
+	for _, expr := range []string{"port", "host nowhere", "(tcp", "tcp or", "bogus"} {
+		if _, err := pcap.CompileFilter(expr); err == nil {
+			t.Errorf("expected %q to fail to compile", expr)
+		}
+	}
+}
+
+// TestWriters
+func TestWriters(t *testing.T) {
+	frame := tcpFrame("20.0.0.2", "20.0.0.3", 40000, 22)
+
+	// pcap: 24 byte header plus 16 byte record header
+	buf := new(bytes.Buffer)
+	w, err := pcap.NewWriter(buf, pcap.FormatPcap, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err = w.WritePacket(time.Now(), frame, len(frame)); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if binary.LittleEndian.Uint32(buf.Bytes()) != 0xa1b2c3d4 || buf.Len() != 24+16+len(frame) {
+		t.Errorf("unexpected pcap output of %d bytes", buf.Len())
+	}
+
+	// pcapng: section and interface blocks plus a padded packet block
+	buf.Reset()
+	w, err = pcap.NewWriter(buf, pcap.FormatPcapNG, 0)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	if err = w.WritePacket(time.Now(), frame[:53], 53); err != nil {
+		t.Fatalf("%s", err)
+	}
+	if binary.LittleEndian.Uint32(buf.Bytes()) != 0x0a0d0d0a || buf.Len() != 28+20+32+56 {
+		t.Errorf("unexpected pcapng output of %d bytes", buf.Len())
+	}
+
+	if _, err = pcap.NewWriter(buf, "csv", 0); err == nil {
+		t.Errorf("expected unknown format to fail")
+	}
+}
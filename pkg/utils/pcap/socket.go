@@ -0,0 +1,110 @@
+package pcap
+
+import (
+	"net"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// Linux packet socket constants, see packet(7)
+const (
+	ethPAll             = 0x0003
+	solPacket           = 263
+	packetAddMembership = 1
+	packetMrPromisc     = 1
+)
+
+// packetMreq - struct packet_mreq from linux/if_packet.h
+type packetMreq struct {
+	ifindex int32
+	mrType  uint16
+	alen    uint16
+	address [8]byte
+}
+
+// Handle - an AF_PACKET socket bound to a single interface
+type Handle struct {
+	fd      int
+	snapLen int
+	buf     []byte
+}
+
+// OpenLive - opens a promiscuous packet socket on the named interface
+func OpenLive(ifaceName string, snapLen int) (handle *Handle, err error) {
+	if snapLen <= 0 {
+		snapLen = DefaultSnapLen
+	}
+
+	iface, err := net.InterfaceByName(ifaceName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not find interface %s", ifaceName)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPAll)))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not open packet socket")
+	}
+
+	// Only receive frames from the requested interface
+	err = syscall.Bind(fd, &syscall.SockaddrLinklayer{Protocol: htons(ethPAll), Ifindex: iface.Index})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrapf(err, "could not bind to interface %s", ifaceName)
+	}
+
+	// Bridges only pass frames between other ports up to the stack when promiscuous
+	mreq := packetMreq{ifindex: int32(iface.Index), mrType: packetMrPromisc}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd), solPacket, packetAddMembership,
+		uintptr(unsafe.Pointer(&mreq)), unsafe.Sizeof(mreq), 0)
+	if errno != 0 {
+		syscall.Close(fd)
+		return nil, errors.Wrapf(errno, "could not set %s promiscuous", ifaceName)
+	}
+
+	// Time out reads so that callers can check for cancellation
+	tv := syscall.NsecToTimeval(int64(250 * time.Millisecond))
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, errors.Wrap(err, "could not set socket timeout")
+	}
+
+	return &Handle{fd: fd, snapLen: snapLen, buf: make([]byte, 65536)}, nil
+}
+
+// ReadPacket - reads the next frame, data is nil if the read timed out
+//
+// The returned slice is only valid until the next call to ReadPacket.
+func (h *Handle) ReadPacket() (data []byte, ts time.Time, origLen int, err error) {
+	n, _, err := syscall.Recvfrom(h.fd, h.buf, syscall.MSG_TRUNC)
+	ts = time.Now()
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return nil, ts, 0, nil
+	} else if err != nil {
+		return nil, ts, 0, errors.Wrap(err, "failed to read from packet socket")
+	}
+
+	// With MSG_TRUNC n is the length on the wire
+	origLen = n
+	if n > len(h.buf) {
+		n = len(h.buf)
+	}
+	if n > h.snapLen {
+		n = h.snapLen
+	}
+
+	return h.buf[:n], ts, origLen, nil
+}
+
+// Close - closes the packet socket
+func (h *Handle) Close() error {
+	return syscall.Close(h.fd)
+}
+
+// htons - converts a short to network byte order
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}